@@ -1,54 +1,40 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
-	"github.com/tanema/mal/wotlisp/src/core"
-	"github.com/tanema/mal/wotlisp/src/env"
 	"github.com/tanema/mal/wotlisp/src/printer"
-	"github.com/tanema/mal/wotlisp/src/reader"
 	"github.com/tanema/mal/wotlisp/src/readline"
-	"github.com/tanema/mal/wotlisp/src/runtime"
 	"github.com/tanema/mal/wotlisp/src/types"
+	"github.com/tanema/mal/wotlisp/src/wot"
 )
 
 func main() {
-	defaultEnv := core.DefaultNamespace()
+	interp := wot.New(wot.WithLineReader(readline.Readline))
 	if len(os.Args) > 1 {
-		runFile(defaultEnv, os.Args[1], os.Args[2:]...)
+		runFile(interp, os.Args[1], os.Args[2:]...)
 	} else {
-		runREPL(defaultEnv)
+		runREPL(interp)
 	}
 }
 
-func runFile(e *env.Env, path string, argv ...string) {
+func runFile(interp *wot.Interpreter, path string, argv ...string) {
 	targv := make([]types.Base, len(argv))
 	for i, arg := range argv {
 		targv[i] = types.Base(arg)
 	}
-	e.Set("*ARGV*", types.NewList(targv...))
-	fmt.Println(rep(`(load-file "`+os.Args[1]+`")`, e))
-}
-
-func runREPL(env *env.Env) error {
-	for {
-		text, err := readline.Readline("user> ")
-		if err != nil {
-			return err
-		}
-		fmt.Println(rep(text, env))
+	interp.Define("*ARGV*", types.NewList(targv...))
+	if _, err := interp.LoadFile(context.Background(), path); err != nil {
+		fmt.Fprintln(os.Stderr, printer.Print(err, true))
+		os.Exit(1)
 	}
 }
 
-func rep(in string, e *env.Env) string {
-	ast, parseErr := reader.ReadString(in)
-	if parseErr != nil {
-		return parseErr.Error()
-	}
-	val, evalErr := runtime.Eval(e, ast)
-	if evalErr != nil {
-		return printer.Print(evalErr, true)
+func runREPL(interp *wot.Interpreter) error {
+	if _, err := interp.EvalString(context.Background(), `(println (str "Mal [" *host-language* "]"))`); err != nil {
+		return err
 	}
-	return printer.Print(val, true)
+	return interp.REPL(context.Background(), "user> ")
 }
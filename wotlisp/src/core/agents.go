@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// agent creates an agent with its initial state, (agent state :validator fn)
+func agent(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a)%2 != 1 {
+		return nil, arityError("agent", a)
+	}
+	agent := types.NewAgent(a[0])
+	for i := 1; i < len(a); i += 2 {
+		if a[i] != types.Keyword("validator") {
+			return nil, types.Errorf(types.TypeError, "agent: unknown option %v", a[i])
+		} else if err := agent.SetValidator(e, a[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return agent, nil
+}
+
+func isagent(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, is := a[0].(*types.Agent)
+	return is, nil
+}
+
+func asAgent(name string, a []types.Base, n int) (*types.Agent, error) {
+	agent, ok := a[n-1].(*types.Agent)
+	if !ok {
+		return nil, argError(name, n, "an agent", a[n-1])
+	}
+	return agent, nil
+}
+
+// send queues (f state args...) on the agent, to run on a limited pool of
+// goroutines so f should not block.
+func send(e types.Env, a []types.Base) (types.Base, error) {
+	return dispatch("send", e, a, true)
+}
+
+// sendOff is like send but f runs on a goroutine of its own so it can block
+func sendOff(e types.Env, a []types.Base) (types.Base, error) {
+	return dispatch("send-off", e, a, false)
+}
+
+// dispatch sends an action to an agent. The action is evaluated with a
+// context forked from the sender so it is cancelled with the evaluation that
+// sent it. Actions sent in a transaction are held until it commits.
+func dispatch(name string, e types.Env, a []types.Base, pooled bool) (types.Base, error) {
+	if len(a) < 2 {
+		return nil, arityError(name, a)
+	}
+	agent, err := asAgent(name, a, 1)
+	if err != nil {
+		return nil, err
+	} else if err := agent.Err(); err != nil {
+		return nil, types.Errorf(types.StateError, "%v: agent has failed and must be restarted", name).Wrap(err)
+	}
+	fn := a[1]
+	action := types.Func(func(e types.Env, args []types.Base) (types.Base, error) {
+		ctx, cancel := runtime.Fork(types.ContextOf(e))
+		defer cancel()
+		return types.CallFunc(types.WithContext(e, ctx), fn, args)
+	})
+	ctx := types.ContextOf(e)
+	if txn := types.TransactionOf(ctx); txn != nil {
+		sender := types.WithContext(e, types.WithoutTransaction(ctx))
+		return agent, txn.AfterCommit(func() { agent.Send(sender, action, a[2:], pooled) })
+	}
+	return agent, agent.Send(e, action, a[2:], pooled)
+}
+
+// await waits for every action sent to the agents so far to finish
+func await(e types.Env, a []types.Base) (types.Base, error) {
+	return nil, awaitAgents("await", types.ContextOf(e), a)
+}
+
+// awaitFor is await with a timeout in milliseconds, (await-for ms & agents).
+// It returns false if the timeout passes first.
+func awaitFor(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 1 {
+		return nil, arityError("await-for", a)
+	}
+	ms, ok := types.ToInt(a[0])
+	if !ok {
+		return nil, argError("await-for", 1, "an integer", a[0])
+	}
+	ctx := types.ContextOf(e)
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+	defer cancel()
+	err := awaitAgents("await-for", waitCtx, a[1:])
+	if err != nil && ctx.Err() == nil && waitCtx.Err() == context.DeadlineExceeded {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func awaitAgents(name string, ctx context.Context, a []types.Base) error {
+	if types.TransactionOf(ctx) != nil {
+		return types.Errorf(types.StateError, "%v: cannot wait for agents in a transaction", name)
+	}
+	for i := range a {
+		agent, err := asAgent(name, a, i+1)
+		if err != nil {
+			return err
+		} else if err := agent.Await(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// agentError is the error that failed the agent as catch* would bind it, nil
+// if the agent has not failed.
+func agentError(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	agent, err := asAgent("agent-error", a, 1)
+	if err != nil {
+		return nil, err
+	} else if err := agent.Err(); err != nil {
+		return runtime.CaughtValue(err), nil
+	}
+	return nil, nil
+}
+
+// restartAgent sets the state of a failed agent and runs its queued actions,
+// (restart-agent agent state :clear-actions true) drops them instead.
+func restartAgent(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 2 || len(a)%2 != 0 {
+		return nil, arityError("restart-agent", a)
+	}
+	agent, err := asAgent("restart-agent", a, 1)
+	if err != nil {
+		return nil, err
+	}
+	clear := false
+	for i := 2; i < len(a); i += 2 {
+		if a[i] != types.Keyword("clear-actions") {
+			return nil, types.Errorf(types.TypeError, "restart-agent: unknown option %v", a[i])
+		}
+		clear = truthy(a[i+1])
+	}
+	return a[1], agent.Restart(e, a[1], clear)
+}
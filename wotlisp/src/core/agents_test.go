@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func TestAgentBuiltins(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(agent? (agent 0))`, `true`},
+		{`(agent? (atom 0))`, `false`},
+		{`(let* [a (agent 0)] (do (send a + 1 2) (send-off a * 10) (await a) @a))`, `30`},
+		{`(let* [a (agent 0)] (do (send a inc) (await-for 1000 a)))`, `true`},
+		{`(let* [a (agent 0) b (agent 1)] (do (send a inc) (send b inc) (await a b) [@a @b]))`, `[1 2]`},
+		{`(let* [a (agent 0)] (agent-error a))`, `nil`},
+		{`(let* [a (agent 0)] (do (send a (fn* [s] (throw :oops))) (try* (await a) (catch* e nil)) (agent-error a)))`, `:oops`},
+		{`(let* [a (agent 0)] (do (send a (fn* [s] (throw :oops))) (try* (await a) (catch* e nil)) (restart-agent a 5) (send a inc) (await a) [@a (agent-error a)]))`, `[6 nil]`},
+		{`(let* [a (agent 0)] (do (send a (fn* [s] (throw :oops))) (send a inc) (try* (await a) (catch* e nil)) (restart-agent a 5 :clear-actions true) (await a) @a))`, `5`},
+		{`(let* [a (agent 1 :validator (fn* [s] (> s 0)))] (do (send a -) (try* (await a) (catch* e nil)) [@a (nil? (agent-error a))]))`, `[1 false]`},
+		{`(let* [a (agent 0) r (ref 0)] (do (dosync (send a inc) (alter r inc)) (await a) [@a @r]))`, `[1 1]`},
+		{`(let* [a (agent 0)] (do (try* (dosync (send a inc) (throw :abort)) (catch* e e)) (await a) @a))`, `0`},
+	})
+}
+
+func TestAgentBuiltinErrors(t *testing.T) {
+	cases := []struct {
+		src     string
+		errType types.ErrorType
+	}{
+		{`(agent)`, types.ArityError},
+		{`(agent 0 :validator)`, types.ArityError},
+		{`(agent 0 :watch number?)`, types.TypeError},
+		{`(send (atom 0) inc)`, types.TypeError},
+		{`(send (agent 0))`, types.ArityError},
+		{`(await 1)`, types.TypeError},
+		{`(await-for :soon (agent 0))`, types.TypeError},
+		{`(dosync (await (agent 0)))`, types.StateError},
+		{`(restart-agent (agent 0) 1)`, types.StateError},
+		{`(restart-agent (agent 0) 1 :clear)`, types.ArityError},
+		{`(let* [a (agent 0)] (do (send a (fn* [s] (throw :oops))) (try* (await a) (catch* e nil)) (send a inc)))`, types.StateError},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			if _, err := evalIn(NewNamespace(Options{Out: ioutil.Discard}), c.src); !errors.Is(err, c.errType) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			}
+		})
+	}
+}
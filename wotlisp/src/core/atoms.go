@@ -0,0 +1,161 @@
+package core
+
+import "github.com/tanema/mal/wotlisp/src/types"
+
+func atom(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	return types.NewAtom(a[0]), nil
+}
+
+func isatom(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, is := a[0].(*types.Atom)
+	return is, nil
+}
+
+// watchable is a reference with a validator and watches, an atom or an agent
+type watchable interface {
+	SetValidator(e types.Env, fn types.Base) error
+	Validator() types.Base
+	AddWatch(key, fn types.Base)
+	RemoveWatch(key types.Base)
+}
+
+func asWatchable(name string, a []types.Base) (watchable, error) {
+	ref, ok := a[0].(watchable)
+	if !ok {
+		return nil, argError(name, 1, "an atom or agent", a[0])
+	}
+	return ref, nil
+}
+
+// asAtom returns the first argument as an atom for the builtin name
+func asAtom(name string, a []types.Base) (*types.Atom, error) {
+	atom, ok := a[0].(*types.Atom)
+	if !ok {
+		return nil, argError(name, 1, "an atom", a[0])
+	}
+	return atom, nil
+}
+
+// deref reads the value of an atom, ref or agent or waits for the value of a future
+// or promise, (deref ref timeout-ms timeout-val) gives up waiting after the
+// timeout.
+func deref(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 1 && len(a) != 3 {
+		return nil, arityError("deref", a)
+	}
+	switch ref := a[0].(type) {
+	case *types.Atom:
+		if len(a) == 3 {
+			return nil, types.Errorf(types.ArityError, "deref: an atom cannot be dereferenced with a timeout")
+		}
+		return ref.Deref(), nil
+	case *types.Ref:
+		if len(a) == 3 {
+			return nil, types.Errorf(types.ArityError, "deref: a ref cannot be dereferenced with a timeout")
+		} else if txn := types.TransactionOf(types.ContextOf(e)); txn != nil {
+			return txn.Get(ref)
+		}
+		return ref.Deref(), nil
+	case *types.Agent:
+		if len(a) == 3 {
+			return nil, types.Errorf(types.ArityError, "deref: an agent cannot be dereferenced with a timeout")
+		}
+		return ref.Deref(), nil
+	case types.Awaitable:
+		return awaitRef(e, ref, a[1:])
+	}
+	return nil, argError("deref", 1, "an atom, ref, agent, future or promise", a[0])
+}
+
+func reset(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	atom, err := asAtom("reset!", a)
+	if err != nil {
+		return nil, err
+	}
+	return atom.Reset(e, a[1])
+}
+
+// swap sets the atom to (f old args...), calling f again if another swap
+// changed the atom while it was running.
+func swap(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 2 {
+		return nil, arityError("swap!", a)
+	}
+	atom, err := asAtom("swap!", a)
+	if err != nil {
+		return nil, err
+	}
+	return atom.Swap(e, a[1], a[2:])
+}
+
+// compareAndSet sets the atom to the new value only if its value is
+// identical to the old one.
+func compareAndSet(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 3); err != nil {
+		return nil, err
+	}
+	atom, err := asAtom("compare-and-set!", a)
+	if err != nil {
+		return nil, err
+	}
+	return atom.CompareAndSet(e, a[1], a[2])
+}
+
+// addWatch adds (f key ref old new) to be called after the atom or agent
+// changes
+func addWatch(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 3); err != nil {
+		return nil, err
+	}
+	ref, err := asWatchable("add-watch", a)
+	if err != nil {
+		return nil, err
+	}
+	ref.AddWatch(a[1], a[2])
+	return ref, nil
+}
+
+func removeWatch(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	ref, err := asWatchable("remove-watch", a)
+	if err != nil {
+		return nil, err
+	}
+	ref.RemoveWatch(a[1])
+	return ref, nil
+}
+
+// setValidator sets the function every new value of the atom or agent must
+// pass, nil removes it.
+func setValidator(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	ref, err := asWatchable("set-validator!", a)
+	if err != nil {
+		return nil, err
+	}
+	return nil, ref.SetValidator(e, a[1])
+}
+
+func getValidator(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	ref, err := asWatchable("get-validator", a)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Validator(), nil
+}
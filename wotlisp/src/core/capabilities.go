@@ -0,0 +1,77 @@
+package core
+
+import (
+	"os"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// Capability is a set of builtins that reach outside of the interpreter. A
+// namespace only installs the builtins of the capabilities it is given so
+// untrusted code cannot use the others.
+type Capability string
+
+const (
+	// Pure builtins only compute values, they are always installed
+	Pure Capability = "pure"
+	// IORead builtins read files and input, slurp, load-file and readline
+	IORead Capability = "io-read"
+	// IOWrite builtins write files and output, spit, prn and println
+	IOWrite Capability = "io-write"
+	// Process builtins read the state of the host process, getenv
+	Process Capability = "process"
+	// Network builtins use the network. None of the builtins need it yet but
+	// hosts can check for it before defining their own.
+	Network Capability = "network"
+)
+
+// capabilities are the capabilities of the builtins and vars that are not pure
+var capabilities = map[types.Symbol]Capability{
+	"slurp":     IORead,
+	"load-file": IORead,
+	"readline":  IORead,
+	"*in*":      IORead,
+	"spit":      IOWrite,
+	"prn":       IOWrite,
+	"println":   IOWrite,
+	"*out*":     IOWrite,
+	"*err*":     IOWrite,
+	"getenv":    Process,
+}
+
+// AllCapabilities are the capabilities installed when none are chosen
+var AllCapabilities = []Capability{Pure, IORead, IOWrite, Process, Network}
+
+// BuiltinCapability returns the capability needed to install a builtin
+func BuiltinCapability(name types.Symbol) Capability {
+	if capability, ok := capabilities[name]; ok {
+		return capability
+	}
+	return Pure
+}
+
+// capabilitySet is the set of chosen capabilities, all of them if caps is nil
+func capabilitySet(caps []Capability) map[Capability]bool {
+	if caps == nil {
+		caps = AllCapabilities
+	}
+	set := map[Capability]bool{Pure: true}
+	for _, capability := range caps {
+		set[capability] = true
+	}
+	return set
+}
+
+func getenv(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	name, ok := a[0].(string)
+	if !ok {
+		return nil, argError("getenv", 1, "a string", a[0])
+	}
+	if val, found := os.LookupEnv(name); found {
+		return val, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,445 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// spawn runs fn on a new goroutine with a context forked from the caller, so
+// cancelling the evaluation that started it stops it too.
+func spawn(e types.Env, fn func(ctx context.Context)) {
+	ctx, cancel := runtime.Fork(types.ContextOf(e))
+	go func() {
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// bufferSpec makes the map that describes a buffer for chan
+func bufferSpec(name string, kind types.BufferKind, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	if _, ok := types.ToInt(a[0]); !ok {
+		return nil, argError(name, 1, "an integer", a[0])
+	}
+	return types.NewHashmap([]types.Base{types.Keyword("buffer"), types.Keyword(kind), types.Keyword("size"), a[0]})
+}
+
+func buffer(e types.Env, a []types.Base) (types.Base, error) {
+	return bufferSpec("buffer", types.FixedBuffer, a)
+}
+
+func droppingBuffer(e types.Env, a []types.Base) (types.Base, error) {
+	return bufferSpec("dropping-buffer", types.DroppingBuffer, a)
+}
+
+func slidingBuffer(e types.Env, a []types.Base) (types.Base, error) {
+	return bufferSpec("sliding-buffer", types.SlidingBuffer, a)
+}
+
+// newChan makes a channel from (chan), (chan n) or (chan (sliding-buffer n))
+func newChan(name string, a []types.Base) (*types.Chan, error) {
+	if len(a) == 0 || a[0] == nil {
+		return types.NewChan(0, types.FixedBuffer)
+	} else if n, ok := types.ToInt(a[0]); ok {
+		return types.NewChan(n, types.FixedBuffer)
+	} else if spec, ok := a[0].(types.Map); ok {
+		kind, _ := spec.Get(types.Keyword("buffer"))
+		size, _ := spec.Get(types.Keyword("size"))
+		kw, isKw := kind.(types.Keyword)
+		n, isInt := types.ToInt(size)
+		if isKw && isInt {
+			return types.NewChan(n, types.BufferKind(kw))
+		}
+	}
+	return nil, argError(name, 1, "a buffer size or buffer", a[0])
+}
+
+func channel(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) > 1 {
+		return nil, arityError("chan", a)
+	}
+	return newChan("chan", a)
+}
+
+func ischan(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, is := a[0].(*types.Chan)
+	return is, nil
+}
+
+func asChan(name string, a []types.Base, n int) (*types.Chan, error) {
+	ch, ok := a[n-1].(*types.Chan)
+	if !ok {
+		return nil, argError(name, n, "a channel", a[n-1])
+	}
+	return ch, nil
+}
+
+// putChan puts a value on a channel, waiting for room. It returns false if the
+// channel is closed.
+func putChan(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	ch, err := asChan(">!!", a, 1)
+	if err != nil {
+		return nil, err
+	}
+	return ch.Put(types.ContextOf(e), a[1])
+}
+
+// takeChan takes a value from a channel, waiting for one. It returns nil once
+// the channel is closed and empty.
+func takeChan(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	ch, err := asChan("<!!", a, 1)
+	if err != nil {
+		return nil, err
+	}
+	return ch.Take(types.ContextOf(e))
+}
+
+func closeChan(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	ch, err := asChan("close!", a, 1)
+	if err != nil {
+		return nil, err
+	}
+	ch.Close()
+	return nil, nil
+}
+
+// goCall calls the function on a new goroutine and returns a channel that
+// gets its result, then closes. If it throws, the value catch* would bind is
+// put on the channel instead.
+func goCall(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	result, _ := types.NewChan(1, types.FixedBuffer)
+	fn := a[0]
+	spawn(e, func(ctx context.Context) {
+		defer result.Close()
+		val, err := types.CallFunc(types.WithContext(e, ctx), fn, nil)
+		if err == nil {
+			err = types.Realize(val)
+		}
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			val = runtime.CaughtValue(err)
+		}
+		if val != nil {
+			result.Put(ctx, val)
+		}
+	})
+	return result, nil
+}
+
+// timeout returns a channel that closes after the milliseconds
+func timeout(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	ms, ok := types.ToInt(a[0])
+	if !ok {
+		return nil, argError("timeout", 1, "an integer", a[0])
+	}
+	ch, _ := types.NewChan(0, types.FixedBuffer)
+	time.AfterFunc(time.Duration(ms)*time.Millisecond, ch.Close)
+	return ch, nil
+}
+
+// altOp is a take from a channel or a put of val to it for alts!!
+type altOp struct {
+	ch  *types.Chan
+	val types.Base
+	put bool
+}
+
+// try does the operation if it can be done without waiting
+func (op altOp) try() (types.Base, bool) {
+	if op.put {
+		if op.ch.Closed() {
+			return false, true
+		}
+		return true, op.ch.Offer(op.val)
+	} else if val := op.ch.Poll(); val != nil {
+		return val, true
+	}
+	return nil, op.ch.Closed()
+}
+
+// alts does whichever one of the operations is ready first,
+// (alts!! [ch [ch val]] :default val :priority true). A channel is a take and
+// [ch val] is a put. It returns [val ch] for a take and [put? ch] for a put.
+// With :priority the operations are tried in order and with :default the
+// default value is returned as [val :default] if none are ready.
+func alts(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a)%2 != 1 {
+		return nil, arityError("alts!!", a)
+	}
+	ops, err := altOps(a[0])
+	if err != nil {
+		return nil, err
+	}
+	var priority, hasDefault bool
+	var defaultVal types.Base
+	for i := 1; i < len(a); i += 2 {
+		switch a[i] {
+		case types.Keyword("priority"):
+			priority = truthy(a[i+1])
+		case types.Keyword("default"):
+			hasDefault, defaultVal = true, a[i+1]
+		default:
+			return nil, types.Errorf(types.TypeError, "alts!!: unknown option %v", a[i])
+		}
+	}
+
+	if priority || hasDefault {
+		for _, op := range ops {
+			if val, ok := op.try(); ok {
+				return types.NewVect(val, op.ch), nil
+			}
+		}
+		if hasDefault {
+			return types.NewVect(defaultVal, types.Keyword("default")), nil
+		}
+	}
+
+	// every operation has a case for its channel and one for it closing
+	cases := make([]reflect.SelectCase, 0, len(ops)*2+1)
+	for _, op := range ops {
+		data, closed := op.ch.Channels()
+		if op.put && op.ch.Offer(op.val) {
+			return types.NewVect(true, op.ch), nil
+		} else if op.put {
+			send := reflect.New(reflect.TypeOf((*types.Base)(nil)).Elem()).Elem()
+			send.Set(reflect.ValueOf(op.val))
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(data), Send: send})
+		} else {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(data)})
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(closed)})
+	}
+	ctx := types.ContextOf(e)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+
+	chosen, recv, _ := reflect.Select(cases)
+	if chosen == len(cases)-1 {
+		return nil, ctx.Err()
+	}
+	op, closed := ops[chosen/2], chosen%2 == 1
+	switch {
+	case op.put:
+		return types.NewVect(!closed, op.ch), nil
+	case closed:
+		return types.NewVect(op.ch.Poll(), op.ch), nil
+	default:
+		return types.NewVect(recv.Interface(), op.ch), nil
+	}
+}
+
+func altOps(arg types.Base) ([]altOp, error) {
+	items, err := sequentialArg("alts!!", arg, "a collection of operations")
+	if err != nil {
+		return nil, err
+	} else if len(items) == 0 {
+		return nil, argError("alts!!", 1, "a collection of operations", arg)
+	}
+	ops := []altOp{}
+	for _, item := range items {
+		if ch, isChan := item.(*types.Chan); isChan {
+			ops = append(ops, altOp{ch: ch})
+			continue
+		}
+		pair, isPair := item.(types.Collection)
+		if !isPair || pair.Count() != 2 {
+			return nil, types.Errorf(types.TypeError, "alts!!: an operation must be a channel or [channel value], got %v", types.TypeName(item))
+		}
+		data := pair.Data()
+		ch, isChan := data[0].(*types.Chan)
+		if !isChan {
+			return nil, types.Errorf(types.TypeError, "alts!!: cannot put to %v", types.TypeName(data[0]))
+		} else if data[1] == nil {
+			return nil, types.Errorf(types.TypeError, "cannot put nil on a channel")
+		}
+		ops = append(ops, altOp{ch: ch, val: data[1], put: true})
+	}
+	return ops, nil
+}
+
+// pipe copies the values from one channel to another, (pipe from to) or
+// (pipe from to close?). The second channel is closed when the first one is
+// unless close? is false. It returns the second channel.
+func pipe(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 2 && len(a) != 3 {
+		return nil, arityError("pipe", a)
+	}
+	from, err := asChan("pipe", a, 1)
+	if err != nil {
+		return nil, err
+	}
+	to, err := asChan("pipe", a, 2)
+	if err != nil {
+		return nil, err
+	}
+	closeTo := len(a) == 2 || truthy(a[2])
+	spawn(e, func(ctx context.Context) {
+		for {
+			val, err := from.Take(ctx)
+			if err != nil {
+				return
+			} else if val == nil {
+				if closeTo {
+					to.Close()
+				}
+				return
+			} else if ok, err := to.Put(ctx, val); !ok || err != nil {
+				return
+			}
+		}
+	})
+	return to, nil
+}
+
+// mergeChans takes the values from all of the channels and puts them on a new
+// channel that is closed once they are all closed, (merge-chans chs) or
+// (merge-chans chs buf-or-n).
+func mergeChans(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 1 && len(a) != 2 {
+		return nil, arityError("merge-chans", a)
+	}
+	items, err := sequentialArg("merge-chans", a[0], "a collection of channels")
+	if err != nil {
+		return nil, err
+	}
+	chans := make([]*types.Chan, len(items))
+	for i, item := range items {
+		var ok bool
+		if chans[i], ok = item.(*types.Chan); !ok {
+			return nil, types.Errorf(types.TypeError, "merge-chans: cannot merge %v", types.TypeName(item))
+		}
+	}
+	out, err := newChan("merge-chans", a[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(chans))
+	for _, ch := range chans {
+		ch := ch
+		spawn(e, func(ctx context.Context) {
+			defer wg.Done()
+			for {
+				val, err := ch.Take(ctx)
+				if err != nil || val == nil {
+					return
+				} else if ok, err := out.Put(ctx, val); !ok || err != nil {
+					return
+				}
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		out.Close()
+	}()
+	return out, nil
+}
+
+// mult takes every value from the channel and puts it on each channel tapped
+// with tap. It waits for every tap to take a value before taking the next.
+func mult(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	src, err := asChan("mult", a, 1)
+	if err != nil {
+		return nil, err
+	}
+	m := types.NewMult(src)
+	spawn(e, func(ctx context.Context) {
+		for {
+			val, err := src.Take(ctx)
+			if err != nil {
+				return
+			}
+			for tap, closeTap := range m.Taps() {
+				if val == nil {
+					if closeTap {
+						tap.Close()
+					}
+				} else if ok, err := tap.Put(ctx, val); err != nil {
+					return
+				} else if !ok {
+					m.Untap(tap)
+				}
+			}
+			if val == nil {
+				return
+			}
+		}
+	})
+	return m, nil
+}
+
+// tap copies the values of a mult to the channel, (tap mult ch) or
+// (tap mult ch close?). The channel is closed with the source unless close?
+// is false.
+func tap(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 2 && len(a) != 3 {
+		return nil, arityError("tap", a)
+	}
+	m, ok := a[0].(*types.Mult)
+	if !ok {
+		return nil, argError("tap", 1, "a mult", a[0])
+	}
+	ch, err := asChan("tap", a, 2)
+	if err != nil {
+		return nil, err
+	}
+	m.Tap(ch, len(a) == 2 || truthy(a[2]))
+	return ch, nil
+}
+
+func untap(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	m, ok := a[0].(*types.Mult)
+	if !ok {
+		return nil, argError("untap", 1, "a mult", a[0])
+	}
+	ch, err := asChan("untap", a, 2)
+	if err != nil {
+		return nil, err
+	}
+	m.Untap(ch)
+	return ch, nil
+}
+
+// sequentialArg realizes the items of a collection or seq that is the first
+// argument of the builtin name
+func sequentialArg(name string, arg types.Base, expected string) ([]types.Base, error) {
+	switch arg.(type) {
+	case types.Collection, types.Seq, *types.LazySeq:
+		return types.SeqData(arg)
+	default:
+		return nil, argError(name, 1, expected, arg)
+	}
+}
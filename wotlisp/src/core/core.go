@@ -2,98 +2,204 @@ package core
 
 import (
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"reflect"
+	"math"
+	"math/big"
 	"strings"
 	"time"
 
 	"github.com/tanema/mal/wotlisp/src/printer"
 	"github.com/tanema/mal/wotlisp/src/reader"
-	"github.com/tanema/mal/wotlisp/src/readline"
+	"github.com/tanema/mal/wotlisp/src/runtime"
 	"github.com/tanema/mal/wotlisp/src/types"
 )
 
 var namespace = map[types.Symbol]*types.StdFunc{
-	"+":           types.Func(add),
-	"-":           types.Func(sub),
-	"*":           types.Func(mul),
-	"/":           types.Func(div),
-	"=":           types.Func(equal),
-	"<":           types.Func(lessThan),
-	"<=":          types.Func(lessThanEqual),
-	">":           types.Func(greaterThan),
-	">=":          types.Func(greaterThanEqual),
-	"prn":         types.Func(prn),
-	"println":     types.Func(prnln),
-	"pr-str":      types.Func(prnstr),
-	"str":         types.Func(str),
-	"list":        types.Func(list),
-	"list?":       types.Func(islist),
-	"empty?":      types.Func(isempty),
-	"count":       types.Func(count),
-	"read-string": types.Func(readString),
-	"slurp":       types.Func(slurp),
-	"atom":        types.Func(atom),
-	"atom?":       types.Func(isatom),
-	"deref":       types.Func(deref),
-	"reset!":      types.Func(reset),
-	"swap!":       types.Func(swap),
-	"cons":        types.Func(cons),
-	"concat":      types.Func(concat),
-	"nth":         types.Func(nth),
-	"first":       types.Func(first),
-	"rest":        types.Func(rest),
-	"throw":       types.Func(throw),
-	"apply":       types.Func(apply),
-	"map":         types.Func(mapvals),
-	"nil?":        types.Func(isnil),
-	"true?":       types.Func(istrue),
-	"false?":      types.Func(isfalse),
-	"symbol?":     types.Func(issymbol),
-	"symbol":      types.Func(makesymbol),
-	"keyword?":    types.Func(iskeyword),
-	"keyword":     types.Func(makekeyword),
-	"vector?":     types.Func(isvector),
-	"vector":      types.Func(makevector),
-	"map?":        types.Func(ismap),
-	"hash-map":    types.Func(makemap),
-	"assoc":       types.Func(assoc),
-	"dissoc":      types.Func(dissoc),
-	"get":         types.Func(get),
-	"contains?":   types.Func(contains),
-	"keys":        types.Func(keys),
-	"vals":        types.Func(vals),
-	"sequential?": types.Func(sequential),
-	"readline":    types.Func(rdline),
-	"meta":        types.Func(meta),
-	"with-meta":   types.Func(withmeta),
-	"string?":     types.Func(isstring),
-	"number?":     types.Func(isnumber),
-	"fn?":         types.Func(isfn),
-	"macro?":      types.Func(ismacro),
-	"conj":        types.Func(conj),
-	"seq":         types.Func(seq),
-	"time-ms":     types.Func(timems),
+	"+":             types.Func(add),
+	"-":             types.Func(sub),
+	"*":             types.Func(mul),
+	"/":             types.Func(div),
+	"mod":           types.Func(mod),
+	"rem":           types.Func(rem),
+	"quot":          types.Func(quot),
+	"inc":           types.Func(inc),
+	"dec":           types.Func(dec),
+	"min":           types.Func(min),
+	"max":           types.Func(max),
+	"abs":           types.Func(abs),
+	"=":             types.Func(equal),
+	"not=":          types.Func(notEqual),
+	"==":            types.Func(numEqual),
+	"<":             types.Func(lessThan),
+	"<=":            types.Func(lessThanEqual),
+	">":             types.Func(greaterThan),
+	">=":            types.Func(greaterThanEqual),
+	"pr-str":        types.Func(prnstr),
+	"str":           types.Func(str),
+	"list":          types.Func(list),
+	"list?":         types.Func(islist),
+	"empty?":        types.Func(isempty),
+	"count":         types.Func(count),
+	"read-string":   types.Func(readString),
+	"atom":          types.Func(atom),
+	"atom?":         types.Func(isatom),
+	"deref":         types.Func(deref),
+	"reset!":        types.Func(reset),
+	"swap!":         types.Func(swap),
+	"cons":          types.Func(cons),
+	"concat":        types.Func(concat),
+	"nth":           types.Func(nth),
+	"first":         types.Func(first),
+	"rest":          types.Func(rest),
+	"throw":         types.Func(throw),
+	"ex-info":       types.Func(exinfo),
+	"ex-data":       types.Func(exdata),
+	"ex-message":    types.Func(exmessage),
+	"ex-cause":      types.Func(excause),
+	"stack-trace":   types.Func(stackTrace),
+	"apply":         types.Func(apply),
+	"map":           types.Func(mapvals),
+	"filter":        types.Func(filter),
+	"remove":        types.Func(remove),
+	"take":          types.Func(take),
+	"drop":          types.Func(drop),
+	"take-while":    types.Func(takeWhile),
+	"iterate":       types.Func(iterate),
+	"range":         types.Func(numRange),
+	"repeat":        types.Func(repeat),
+	"cycle":         types.Func(cycle),
+	"interleave":    types.Func(interleave),
+	"next":          types.Func(next),
+	"seq?":          types.Func(isseq),
+	"realized?":     types.Func(isrealized),
+	"doall":         types.Func(doall),
+	"dorun":         types.Func(dorun),
+	"nil?":          types.Func(isnil),
+	"true?":         types.Func(istrue),
+	"false?":        types.Func(isfalse),
+	"symbol?":       types.Func(issymbol),
+	"symbol":        types.Func(makesymbol),
+	"keyword?":      types.Func(iskeyword),
+	"keyword":       types.Func(makekeyword),
+	"vector?":       types.Func(isvector),
+	"vector":        types.Func(makevector),
+	"map?":          types.Func(ismap),
+	"hash-map":      types.Func(makemap),
+	"assoc":         types.Func(assoc),
+	"dissoc":        types.Func(dissoc),
+	"get":           types.Func(get),
+	"contains?":     types.Func(contains),
+	"set":           types.Func(makeset),
+	"hash-set":      types.Func(hashset),
+	"set?":          types.Func(isset),
+	"disj":          types.Func(disj),
+	"union":         types.Func(union),
+	"intersection":  types.Func(intersection),
+	"difference":    types.Func(difference),
+	"subset?":       types.Func(subset),
+	"sorted-map":    types.Func(sortedmap),
+	"sorted-map-by": types.Func(sortedmapby),
+	"sorted-set":    types.Func(sortedset),
+	"sorted-set-by": types.Func(sortedsetby),
+	"sorted?":       types.Func(issorted),
+	"compare":       types.Func(compare),
+	"subseq":        types.Func(subseq),
+	"rsubseq":       types.Func(rsubseq),
+	"keys":          types.Func(keys),
+	"vals":          types.Func(vals),
+	"sequential?":   types.Func(sequential),
+	"meta":          types.Func(meta),
+	"with-meta":     types.Func(withmeta),
+	"string?":       types.Func(isstring),
+	"number?":       types.Func(isnumber),
+	"integer?":      types.Func(isinteger),
+	"ratio?":        types.Func(isratio),
+	"decimal?":      types.Func(isdecimal),
+	"float?":        types.Func(isfloat),
+	"numerator":     types.Func(numerator),
+	"denominator":   types.Func(denominator),
+	"double":        types.Func(double),
+	"bigint":        types.Func(bigint),
+	"fn?":           types.Func(isfn),
+	"macro?":        types.Func(ismacro),
+	"conj":          types.Func(conj),
+	"seq":           types.Func(seq),
+	"time-ms":       types.Func(timems),
+
+	"compare-and-set!": types.Func(compareAndSet),
+	"add-watch":        types.Func(addWatch),
+	"remove-watch":     types.Func(removeWatch),
+	"set-validator!":   types.Func(setValidator),
+	"get-validator":    types.Func(getValidator),
+
+	"future-call":       types.Func(futureCall),
+	"future?":           types.Func(isfuture),
+	"future-done?":      types.Func(futureDone),
+	"future-cancel":     types.Func(futureCancel),
+	"future-cancelled?": types.Func(futureCancelled),
+	"promise":           types.Func(promise),
+	"deliver":           types.Func(deliver),
+	"pmap":              types.Func(pmap),
+	"pcalls":            types.Func(pcalls),
+
+	"chan":            types.Func(channel),
+	"chan?":           types.Func(ischan),
+	"buffer":          types.Func(buffer),
+	"dropping-buffer": types.Func(droppingBuffer),
+	"sliding-buffer":  types.Func(slidingBuffer),
+	">!!":             types.Func(putChan),
+	"<!!":             types.Func(takeChan),
+	"close!":          types.Func(closeChan),
+	"go-call":         types.Func(goCall),
+	"alts!!":          types.Func(alts),
+	"timeout":         types.Func(timeout),
+	"pipe":            types.Func(pipe),
+	"merge-chans":     types.Func(mergeChans),
+	"mult":            types.Func(mult),
+	"tap":             types.Func(tap),
+	"untap":           types.Func(untap),
+
+	"ref":         types.Func(ref),
+	"ref?":        types.Func(isref),
+	"dosync-call": types.Func(dosyncCall),
+	"alter":       types.Func(alter),
+	"commute":     types.Func(commuteRef),
+	"ref-set":     types.Func(refSet),
+	"ensure":      types.Func(ensure),
+
+	"agent":         types.Func(agent),
+	"agent?":        types.Func(isagent),
+	"send":          types.Func(send),
+	"send-off":      types.Func(sendOff),
+	"await":         types.Func(await),
+	"await-for":     types.Func(awaitFor),
+	"agent-error":   types.Func(agentError),
+	"restart-agent": types.Func(restartAgent),
 }
 
 func timems(e types.Env, a []types.Base) (types.Base, error) {
-	return float64(time.Now().UnixNano()), nil
+	return time.Now().UnixNano(), nil
 }
 
 func conj(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) < 2 {
-		return nil, errors.New("wrong number of arguments")
+		return nil, types.Errorf(types.ArityError, "wrong number of arguments")
 	}
 	switch v := a[0].(type) {
 	case *types.List:
-		result := []types.Base{}
-		for _, v := range a[1:] {
-			result = append([]types.Base{v}, result...)
+		for _, val := range a[1:] {
+			v = v.Cons(val)
 		}
-		return types.NewList(append(result, v.Forms...)...), nil
+		return v, nil
 	case *types.Vector:
-		return types.NewVect(append(v.Forms, a[1:]...)...), nil
+		return v.Conj(a[1:]...), nil
+	case types.Seq, *types.LazySeq:
+		var result types.Base = v
+		for _, val := range a[1:] {
+			result = types.NewCons(val, result)
+		}
+		return result, nil
+	case set:
+		return conjSet(v, a[1:]...)
 	default:
 		return nil, nil
 	}
@@ -105,11 +211,17 @@ func seq(e types.Env, a []types.Base) (types.Base, error) {
 	}
 	switch v := a[0].(type) {
 	case types.Collection:
-		data := v.Data()
-		if len(data) == 0 {
+		return types.ToSeq(v)
+	case set:
+		if v.Count() == 0 {
+			return nil, nil
+		}
+		return types.NewList(v.Data()...), nil
+	case types.Map:
+		if v.Count() == 0 {
 			return nil, nil
 		}
-		return types.NewList(data...), nil
+		return types.NewList(mapEntries(v)...), nil
 	case string:
 		if v == "" {
 			return nil, nil
@@ -119,6 +231,8 @@ func seq(e types.Env, a []types.Base) (types.Base, error) {
 			result[i] = ch
 		}
 		return types.NewList(result...), nil
+	case types.Seq, *types.LazySeq:
+		return toSeq(v)
 	default:
 		return nil, nil
 	}
@@ -140,13 +254,98 @@ func isnumber(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
 	}
-	switch a[0].(type) {
+	return types.IsNumber(a[0]), nil
+}
+
+func isinteger(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	return types.IsInteger(a[0]), nil
+}
+
+func isratio(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, isRatio := a[0].(*big.Rat)
+	return isRatio, nil
+}
+
+func isdecimal(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, isDecimal := a[0].(*types.Decimal)
+	return isDecimal, nil
+}
+
+func isfloat(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, isFloat := a[0].(float64)
+	return isFloat, nil
+}
+
+func numerator(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	ratio, ok := a[0].(*big.Rat)
+	if !ok {
+		return nil, types.Errorf(types.TypeError, "cannot get numerator of non-ratio")
+	}
+	return new(big.Int).Set(ratio.Num()), nil
+}
+
+func denominator(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	ratio, ok := a[0].(*big.Rat)
+	if !ok {
+		return nil, types.Errorf(types.TypeError, "cannot get denominator of non-ratio")
+	}
+	return new(big.Int).Set(ratio.Denom()), nil
+}
+
+func double(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	num, ok := types.ToFloat(a[0])
+	if !ok {
+		return nil, types.Errorf(types.TypeError, "cannot convert non-number to double")
+	}
+	return num, nil
+}
+
+func bigint(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	switch num := a[0].(type) {
+	case int64:
+		return big.NewInt(num), nil
+	case *big.Int:
+		return num, nil
+	case *big.Rat:
+		return new(big.Int).Quo(num.Num(), num.Denom()), nil
+	case *types.Decimal:
+		rat := num.Rat()
+		return new(big.Int).Quo(rat.Num(), rat.Denom()), nil
 	case float64:
-		return true, nil
+		if math.IsInf(num, 0) || math.IsNaN(num) {
+			return nil, types.Errorf(types.TypeError, "cannot convert infinite or NaN to bigint")
+		}
+		i, _ := big.NewFloat(num).Int(nil)
+		return i, nil
 	default:
-		return false, nil
+		return nil, types.Errorf(types.TypeError, "cannot convert non-number to bigint")
 	}
 }
+
 func isfn(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
@@ -173,16 +372,6 @@ func ismacro(e types.Env, a []types.Base) (types.Base, error) {
 	}
 }
 
-func rdline(e types.Env, a []types.Base) (types.Base, error) {
-	prompt := ""
-	if len(a) > 0 {
-		if p, isstring := a[0].(string); isstring {
-			prompt = p
-		}
-	}
-	return readline.Readline(prompt)
-}
-
 func meta(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
@@ -194,6 +383,12 @@ func meta(e types.Env, a []types.Base) (types.Base, error) {
 		return val.Meta, nil
 	case *types.Hashmap:
 		return val.Meta, nil
+	case *types.Set:
+		return val.Meta, nil
+	case *types.SortedMap:
+		return val.Meta, nil
+	case *types.SortedSet:
+		return val.Meta, nil
 	case *types.StdFunc:
 		return val.Meta, nil
 	case *types.ExtFunc:
@@ -209,17 +404,17 @@ func withmeta(e types.Env, a []types.Base) (types.Base, error) {
 	}
 	switch val := a[0].(type) {
 	case *types.List:
-		list := types.NewList(val.Forms...)
-		list.Meta = a[1]
-		return list, nil
+		return val.WithMeta(a[1]), nil
 	case *types.Vector:
-		vect := types.NewVect(val.Forms...)
-		vect.Meta = a[1]
-		return vect, nil
+		return val.WithMeta(a[1]), nil
 	case *types.Hashmap:
-		hmap, _ := types.NewHashmap(val.ToList())
-		hmap.Meta = a[1]
-		return hmap, nil
+		return val.WithMeta(a[1]), nil
+	case *types.Set:
+		return val.WithMeta(a[1]), nil
+	case *types.SortedMap:
+		return val.WithMeta(a[1]), nil
+	case *types.SortedSet:
+		return val.WithMeta(a[1]), nil
 	case *types.StdFunc:
 		clonedFn := types.Func(val.Fn)
 		clonedFn.Meta = a[1]
@@ -229,62 +424,81 @@ func withmeta(e types.Env, a []types.Base) (types.Base, error) {
 		clonedFn.Meta = a[1]
 		return clonedFn, nil
 	default:
-		return nil, errors.New("invalid data type for metadata")
+		return nil, types.Errorf(types.TypeError, "invalid data type for metadata")
 	}
 }
 
 func assoc(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) < 3 {
-		return nil, errors.New("wrong number of arguments")
+		return nil, types.Errorf(types.ArityError, "wrong number of arguments")
 	}
-	hmap, isHmap := a[0].(*types.Hashmap)
-	if !isHmap {
-		return nil, errors.New("cannot assoc with non-hashmap")
+	switch hmap := a[0].(type) {
+	case *types.Hashmap:
+		return hmap.Assoc(a[1:]...)
+	case *types.SortedMap:
+		return hmap.Assoc(a[1:]...)
+	default:
+		return nil, types.Errorf(types.TypeError, "cannot assoc with non-hashmap")
 	}
-	return types.NewHashmap(append(hmap.ToList(), a[1:]...))
 }
 
 func dissoc(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) < 2 {
-		return nil, errors.New("wrong number of arguments")
+		return nil, types.Errorf(types.ArityError, "wrong number of arguments")
 	}
-	hmap, isHmap := a[0].(*types.Hashmap)
-	if !isHmap {
-		return nil, errors.New("cannot dissoc with non-hashmap")
+	switch hmap := a[0].(type) {
+	case *types.Hashmap:
+		return hmap.Dissoc(a[1:]...), nil
+	case *types.SortedMap:
+		return hmap.Dissoc(a[1:]...)
+	default:
+		return nil, types.Errorf(types.TypeError, "cannot dissoc with non-hashmap")
 	}
-	return types.NewHashmap(hmap.ToList(), a[1:]...)
 }
 
 func get(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 2); err != nil {
 		return nil, err
 	}
-	hmap, isHmap := a[0].(*types.Hashmap)
-	if !isHmap {
+	switch col := a[0].(type) {
+	case *types.SortedMap:
+		val, _, err := col.Lookup(a[1])
+		return val, err
+	case types.Map:
+		val, _ := col.Get(a[1])
+		return val, nil
+	case set:
+		val, _ := col.Get(a[1])
+		return val, nil
+	default:
 		return nil, nil
 	}
-	return hmap.Forms[a[1]], nil
 }
 
 func contains(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 2); err != nil {
 		return nil, err
 	}
-	hmap, isHmap := a[0].(*types.Hashmap)
-	if !isHmap {
-		return nil, errors.New("cannot contains? with non-hashmap")
+	switch col := a[0].(type) {
+	case *types.SortedMap:
+		_, found, err := col.Lookup(a[1])
+		return found, err
+	case types.Map:
+		return col.Contains(a[1]), nil
+	case set:
+		return col.Contains(a[1]), nil
+	default:
+		return nil, types.Errorf(types.TypeError, "cannot contains? with non-hashmap")
 	}
-	_, found := hmap.Forms[a[1]]
-	return found, nil
 }
 
 func keys(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
 	}
-	hmap, isHmap := a[0].(*types.Hashmap)
+	hmap, isHmap := a[0].(types.Map)
 	if !isHmap {
-		return nil, errors.New("cannot index keys with non-hashmap")
+		return nil, types.Errorf(types.TypeError, "cannot index keys with non-hashmap")
 	}
 	return types.NewList(hmap.Keys()...), nil
 }
@@ -293,9 +507,9 @@ func vals(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
 	}
-	hmap, isHmap := a[0].(*types.Hashmap)
+	hmap, isHmap := a[0].(types.Map)
 	if !isHmap {
-		return nil, errors.New("cannot index keys with non-hashmap")
+		return nil, types.Errorf(types.TypeError, "cannot index keys with non-hashmap")
 	}
 	return types.NewList(hmap.Vals()...), nil
 }
@@ -306,16 +520,38 @@ func sequential(e types.Env, a []types.Base) (types.Base, error) {
 	}
 
 	switch a[0].(type) {
-	case types.Collection:
+	case types.Collection, types.Seq, *types.LazySeq:
 		return true, nil
 	default:
 		return false, nil
 	}
 }
 
+// stackTrace returns the call stack of an error as a vector of maps with the
+// :name of each function, where it was called from and how many tail calls it
+// replaced. It takes the error or the value catch* bound for it.
+func stackTrace(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	switch val := a[0].(type) {
+	case *types.ExInfo:
+		if val.Stack != nil {
+			return val.Stack, nil
+		}
+		return runtime.StackTrace(val), nil
+	case types.Map:
+		stack, _ := val.Get(types.Keyword("stack"))
+		return stack, nil
+	case error:
+		return runtime.StackTrace(val), nil
+	}
+	return nil, nil
+}
+
 func throw(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) == 0 {
-		return nil, fmt.Errorf("standard error")
+		return nil, arityError("throw", a)
 	}
 	return nil, types.UserError{Val: a[0]}
 }
@@ -357,7 +593,7 @@ func makesymbol(e types.Env, a []types.Base) (types.Base, error) {
 	}
 	val, isString := a[0].(string)
 	if !isString {
-		return nil, errors.New("cannot create symbol with non-string")
+		return nil, types.Errorf(types.TypeError, "cannot create symbol with non-string")
 	}
 	return types.Symbol(val), nil
 }
@@ -376,7 +612,7 @@ func makekeyword(e types.Env, a []types.Base) (types.Base, error) {
 	}
 	val, isString := a[0].(string)
 	if !isString {
-		return nil, errors.New("cannot create keyword with non-string")
+		return nil, types.Errorf(types.TypeError, "cannot create keyword with non-string")
 	}
 	return types.Keyword(val), nil
 }
@@ -391,7 +627,7 @@ func isvector(e types.Env, a []types.Base) (types.Base, error) {
 
 func makevector(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) < 1 {
-		return nil, errors.New("not enough arguments")
+		return nil, types.Errorf(types.ArityError, "not enough arguments")
 	}
 	return types.NewVect(a[0:]...), nil
 }
@@ -400,7 +636,7 @@ func ismap(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
 	}
-	_, isMap := a[0].(*types.Hashmap)
+	_, isMap := a[0].(types.Map)
 	return isMap, nil
 }
 
@@ -410,12 +646,18 @@ func makemap(e types.Env, a []types.Base) (types.Base, error) {
 
 func apply(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) < 2 {
-		return nil, fmt.Errorf("not enough arugments")
+		return nil, types.Errorf(types.ArityError, "not enough arugments")
 	}
 	final := []types.Base{}
 	for _, val := range a[1:] {
 		if col, isCol := val.(types.Collection); isCol {
 			final = append(final, col.Data()...)
+		} else if types.IsSeq(val) {
+			data, err := types.SeqData(val)
+			if err != nil {
+				return nil, err
+			}
+			final = append(final, data...)
 		} else {
 			final = append(final, val)
 		}
@@ -423,149 +665,83 @@ func apply(e types.Env, a []types.Base) (types.Base, error) {
 	return types.CallFunc(e, a[0], final)
 }
 
-func mapvals(e types.Env, a []types.Base) (types.Base, error) {
+func nth(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 2); err != nil {
 		return nil, err
 	}
-	col, ok := a[1].(types.Collection)
+	n, ok := types.ToInt(a[1])
 	if !ok {
-		return nil, fmt.Errorf("invalid collection")
+		return nil, types.Errorf(types.TypeError, "invalid value to index on collection")
 	}
-
-	final := []types.Base{}
-	for _, val := range col.Data() {
-		val, err := types.CallFunc(e, a[0], []types.Base{val})
-		if err != nil {
-			return nil, err
+	if col, ok := a[0].(types.Collection); ok {
+		val, found := col.Nth(n)
+		if !found {
+			return nil, types.Errorf(types.IndexError, "index out of bounds").
+				With(types.Keyword("index"), int64(n), types.Keyword("count"), int64(col.Count()))
 		}
-		final = append(final, val)
-	}
-
-	return types.NewList(final...), nil
-}
-
-func nth(e types.Env, a []types.Base) (types.Base, error) {
-	if err := assertArgNum(a, 2); err != nil {
-		return nil, err
-	}
-	col, ok := a[0].(types.Collection)
-	if !ok {
-		return nil, fmt.Errorf("cannot get the nth part of non collection")
+		return val, nil
+	} else if !types.IsSeq(a[0]) {
+		return nil, types.Errorf(types.TypeError, "cannot get the nth part of non collection")
 	}
-	n, ok := a[1].(float64)
-	if !ok {
-		return nil, fmt.Errorf("invalid value to index on collection")
+	seq, err := types.ToSeq(a[0])
+	for i := 0; i < n && seq != nil && err == nil; i++ {
+		seq, err = types.ToSeq(seq.More())
 	}
-	data := col.Data()
-	if len(data) <= int(n) {
-		return nil, fmt.Errorf("index out of bounds")
+	if err != nil {
+		return nil, err
+	} else if seq == nil || n < 0 {
+		return nil, types.Errorf(types.IndexError, "index out of bounds").With(types.Keyword("index"), int64(n))
 	}
-	return data[int(n)], nil
+	return seq.First(), nil
 }
 
 func first(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
 	}
-	col, ok := a[0].(types.Collection)
-	if !ok {
-		return nil, nil
-	}
-	data := col.Data()
-	if len(data) == 0 {
-		return nil, nil
+	seq, err := types.ToSeq(a[0])
+	if err != nil || seq == nil {
+		return nil, err
 	}
-	return data[0], nil
+	return seq.First(), nil
 }
 
 func rest(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 1); err != nil {
 		return nil, err
 	}
-	col, ok := a[0].(types.Collection)
-	if !ok {
-		return types.NewList(), nil
-	}
-	data := col.Data()
-	if len(data) == 0 {
+	switch col := a[0].(type) {
+	case *types.List:
+		return col.Rest(), nil
+	case types.Collection, types.Seq, *types.LazySeq:
+		seq, err := types.ToSeq(col)
+		if err != nil {
+			return nil, err
+		} else if seq == nil || seq.More() == nil {
+			return types.NewList(), nil
+		}
+		return seq.More(), nil
+	default:
 		return types.NewList(), nil
 	}
-	return types.NewList(data[1:]...), nil
 }
 
 func cons(e types.Env, a []types.Base) (types.Base, error) {
 	if err := assertArgNum(a, 2); err != nil {
 		return nil, err
 	}
-	col, ok := a[1].(types.Collection)
-	if !ok {
-		return nil, fmt.Errorf("cannot cons a non list")
-	}
-	return types.NewList(append([]types.Base{a[0]}, col.Data()...)...), nil
-}
-
-func concat(e types.Env, a []types.Base) (types.Base, error) {
-	final := []types.Base{}
-	for _, elm := range a {
-		col, ok := elm.(types.Collection)
-		if !ok {
-			return nil, fmt.Errorf("cannot cons a non list")
-		}
-		final = append(final, col.Data()...)
-	}
-	return types.NewList(final...), nil
-}
-
-func atom(e types.Env, a []types.Base) (types.Base, error) {
-	if err := assertArgNum(a, 1); err != nil {
-		return nil, err
-	}
-	return &types.Atom{Val: a[0]}, nil
-}
-
-func isatom(e types.Env, a []types.Base) (types.Base, error) {
-	if err := assertArgNum(a, 1); err != nil {
-		return nil, err
-	}
-	_, is := a[0].(*types.Atom)
-	return is, nil
-}
-
-func deref(e types.Env, a []types.Base) (types.Base, error) {
-	if err := assertArgNum(a, 1); err != nil {
-		return nil, err
-	}
-	atom, ok := a[0].(*types.Atom)
-	if !ok {
-		return nil, errors.New("value is not atom")
-	}
-	return atom.Val, nil
-}
-
-func reset(e types.Env, a []types.Base) (types.Base, error) {
-	if err := assertArgNum(a, 2); err != nil {
-		return nil, err
-	}
-	atom, ok := a[0].(*types.Atom)
-	if !ok {
-		return nil, errors.New("value is not atom")
-	}
-	atom.Val = a[1]
-	return atom.Val, nil
-}
-
-func swap(e types.Env, a []types.Base) (types.Base, error) {
-	if len(a) < 2 {
-		return nil, errors.New("wrong number of arguments")
-	}
-	atom, ok := a[0].(*types.Atom)
-	if !ok {
-		return nil, errors.New("value is not atom")
+	switch col := a[1].(type) {
+	case *types.List:
+		return col.Cons(a[0]), nil
+	case types.Collection:
+		return types.NewList(col.Data()...).Cons(a[0]), nil
+	case types.Seq, *types.LazySeq:
+		return types.NewCons(a[0], col), nil
+	case nil:
+		return types.NewList(a[0]), nil
+	default:
+		return nil, types.Errorf(types.TypeError, "cannot cons a non list")
 	}
-	arguments := append([]types.Base{atom.Val}, a[2:]...)
-	value, err := types.CallFunc(e, a[1], arguments)
-	atom.Val = value
-	return value, err
 }
 
 func readString(e types.Env, a []types.Base) (types.Base, error) {
@@ -574,38 +750,22 @@ func readString(e types.Env, a []types.Base) (types.Base, error) {
 	}
 	source, ok := a[0].(string)
 	if !ok {
-		return nil, errors.New("cannot read source from non-string")
+		return nil, types.Errorf(types.TypeError, "cannot read source from non-string")
 	}
 	return reader.ReadString(source)
 }
 
-func slurp(e types.Env, a []types.Base) (types.Base, error) {
-	path, ok := a[0].(string)
-	if !ok {
-		return nil, errors.New("cannot read source from non-string path")
-	}
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("problem reading source file: %v", err)
-	}
-	return string(b), err
-}
-
-func prn(e types.Env, a []types.Base) (types.Base, error) {
-	fmt.Println(printer.List(a, true, "", "", " "))
-	return nil, nil
-}
-
-func prnln(e types.Env, a []types.Base) (types.Base, error) {
-	fmt.Println(printer.List(a, false, "", "", " "))
-	return nil, nil
-}
-
 func prnstr(e types.Env, a []types.Base) (types.Base, error) {
+	if err := types.Realize(a...); err != nil {
+		return nil, err
+	}
 	return printer.List(a, true, "", "", " "), nil
 }
 
 func str(e types.Env, a []types.Base) (types.Base, error) {
+	if err := types.Realize(a...); err != nil {
+		return nil, err
+	}
 	return printer.List(a, false, "", "", ""), nil
 }
 
@@ -615,7 +775,7 @@ func list(e types.Env, a []types.Base) (types.Base, error) {
 
 func islist(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) == 0 {
-		return false, errors.New("not enough arguments to list?")
+		return false, types.Errorf(types.ArityError, "not enough arguments to list?")
 	}
 	_, lst := a[0].(*types.List)
 	return lst, nil
@@ -623,201 +783,270 @@ func islist(e types.Env, a []types.Base) (types.Base, error) {
 
 func isempty(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) == 0 {
-		return false, errors.New("not enough arguments to empty?")
+		return false, types.Errorf(types.ArityError, "not enough arguments to empty?")
 	}
 	switch data := a[0].(type) {
 	case types.Collection:
-		return len(data.Data()) == 0, nil
-	case *types.Hashmap:
-		return len(data.Forms) == 0, nil
+		return data.Count() == 0, nil
+	case types.Seq, *types.LazySeq:
+		seq, err := types.ToSeq(data)
+		return seq == nil, err
+	case types.Map:
+		return data.Count() == 0, nil
+	case set:
+		return data.Count() == 0, nil
 	case nil:
 		return true, nil
 	default:
-		return false, errors.New("invalid data type passed to empty?")
+		return false, types.Errorf(types.TypeError, "invalid data type passed to empty?")
 	}
 }
 
 func count(e types.Env, a []types.Base) (types.Base, error) {
 	if len(a) == 0 {
-		return false, errors.New("nothing to count")
+		return false, types.Errorf(types.ArityError, "nothing to count")
 	}
 	switch data := a[0].(type) {
 	case types.Collection:
-		return float64(len(data.Data())), nil
-	case *types.Hashmap:
-		return float64(len(data.Forms)), nil
+		return int64(data.Count()), nil
+	case types.Seq, *types.LazySeq:
+		items, err := types.SeqData(data)
+		return int64(len(items)), err
+	case types.Map:
+		return int64(data.Count()), nil
+	case set:
+		return int64(data.Count()), nil
 	case string:
-		return float64(len(data)), nil
+		return int64(len(data)), nil
 	case nil:
-		return float64(0), nil
+		return int64(0), nil
 	default:
-		return false, errors.New("invalid data type passed to count")
+		return false, types.Errorf(types.TypeError, "invalid data type passed to count")
 	}
 }
 
 func equal(e types.Env, a []types.Base) (types.Base, error) {
-	if len(a) < 2 {
-		return false, errors.New("not enough arguments to equal")
+	if len(a) < 1 {
+		return nil, arityError("=", a)
 	}
-	return checkEquality(a[0], a[1])
-}
-
-func checkEquality(val1, val2 types.Base) (bool, error) {
-	switch data := val1.(type) {
-	case types.Collection:
-		other, ok := val2.(types.Collection)
-		if !ok {
+	for i := 0; i < len(a)-1; i++ {
+		if !types.Equal(a[i], a[i+1]) {
 			return false, nil
 		}
-		return equalLists(data.Data(), other.Data())
-	default:
 	}
+	return true, nil
+}
 
-	if reflect.TypeOf(val1) != reflect.TypeOf(val2) {
-		return false, nil
+func notEqual(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 1 {
+		return nil, arityError("not=", a)
 	}
+	same, err := equal(e, a)
+	if err != nil {
+		return nil, err
+	}
+	return !same.(bool), nil
+}
 
-	switch data := val1.(type) {
-	case *types.Hashmap:
-		other := val2.(*types.Hashmap)
-		return equalMaps(data.Forms, other.Forms)
-	case types.Symbol:
-		other := val2.(types.Symbol)
-		return data == other, nil
-	case types.Keyword:
-		other := val2.(types.Keyword)
-		return data == other, nil
-	case string:
-		other := val2.(string)
-		return data == other, nil
-	case float64:
-		other := val2.(float64)
-		return data == other, nil
-	case bool:
-		other := val2.(bool)
-		return data == other, nil
-	case nil:
-		return true, nil
-	default:
-		return false, errors.New("invalid data type passed to equal")
+func assertNumbers(name string, a []types.Base) error {
+	for i, arg := range a {
+		if !types.IsNumber(arg) {
+			return argError(name, i+1, "a number", arg)
+		}
 	}
+	return nil
 }
 
-func equalLists(lst1, lst2 []types.Base) (bool, error) {
-	if len(lst1) != len(lst2) {
-		return false, nil
+func arityError(name string, a []types.Base) error {
+	return types.Errorf(types.ArityError, "%v: wrong number of arguments (%v)", name, len(a)).
+		With(types.Keyword("name"), name, types.Keyword("count"), int64(len(a)))
+}
+
+// argError is the type error for argument n, counting from 1, not being what
+// the function expected. expected is described like "a number".
+func argError(name string, n int, expected string, arg types.Base) error {
+	return types.Errorf(types.TypeError, "%v: argument %v must be %v, got %v", name, n, expected, types.TypeName(arg)).
+		With(types.Keyword("name"), name, types.Keyword("arg"), int64(n), types.Keyword("got"), types.Keyword(types.TypeName(arg)))
+}
+
+// namedError prefixes the message of the error with the name of the function
+// that raised it, keeping its type.
+func namedError(name string, err error) error {
+	var wotErr *types.Error
+	if !errors.As(err, &wotErr) {
+		return types.Errorf(types.ArithmeticError, "%v: %v", name, err).Wrap(err)
 	}
+	return &types.Error{Type: wotErr.Type, Message: name + ": " + wotErr.Message, Data: wotErr.Data, Err: err}
+}
 
-	for i, elm := range lst1 {
-		if equal, err := checkEquality(elm, lst2[i]); err != nil {
-			return false, err
-		} else if !equal {
+func compareChain(name string, a []types.Base, test func(x, y types.Base) (bool, error)) (types.Base, error) {
+	if len(a) < 1 {
+		return nil, arityError(name, a)
+	}
+	if err := assertNumbers(name, a); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(a)-1; i++ {
+		if ok, err := test(a[i], a[i+1]); err != nil {
+			return nil, namedError(name, err)
+		} else if !ok {
 			return false, nil
 		}
 	}
-
 	return true, nil
 }
 
-func equalMaps(m1, m2 map[types.Base]types.Base) (bool, error) {
-	if len(m1) != len(m2) {
-		return false, nil
+func compareWith(test func(cmp int) bool) func(x, y types.Base) (bool, error) {
+	return func(x, y types.Base) (bool, error) {
+		cmp, err := types.NumCompare(x, y)
+		return test(cmp), err
 	}
+}
 
-	for key, val := range m1 {
-		other, found := m2[key]
-		if !found {
-			return false, nil
-		}
+func numEqual(e types.Env, a []types.Base) (types.Base, error) {
+	return compareChain("==", a, types.NumEquals)
+}
 
-		if equal, err := checkEquality(val, other); err != nil {
-			return false, err
-		} else if !equal {
-			return false, nil
-		}
-	}
+func lessThan(e types.Env, a []types.Base) (types.Base, error) {
+	return compareChain("<", a, compareWith(func(cmp int) bool { return cmp < 0 }))
+}
 
-	return true, nil
+func lessThanEqual(e types.Env, a []types.Base) (types.Base, error) {
+	return compareChain("<=", a, compareWith(func(cmp int) bool { return cmp <= 0 }))
 }
 
-func prepareCompare(args []types.Base) (float64, float64, error) {
-	if len(args) < 2 {
-		return 0, 0, errors.New("not enough arguments to equal")
-	}
-	val1, ok := args[0].(float64)
-	if !ok {
-		return 0, 0, errors.New("cannot compare non-number values")
+func greaterThan(e types.Env, a []types.Base) (types.Base, error) {
+	return compareChain(">", a, compareWith(func(cmp int) bool { return cmp > 0 }))
+}
+
+func greaterThanEqual(e types.Env, a []types.Base) (types.Base, error) {
+	return compareChain(">=", a, compareWith(func(cmp int) bool { return cmp >= 0 }))
+}
+
+func foldNumbers(name string, a []types.Base, op func(x, y types.Base) (types.Base, error)) (types.Base, error) {
+	var err error
+	result := a[0]
+	for _, arg := range a[1:] {
+		if result, err = op(result, arg); err != nil {
+			return nil, namedError(name, err)
+		}
 	}
-	val2, ok := args[1].(float64)
-	if !ok {
-		return 0, 0, errors.New("cannot compare non-number values")
+	return result, nil
+}
+
+func add(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) == 0 {
+		return int64(0), nil
+	} else if err := assertNumbers("+", a); err != nil {
+		return nil, err
 	}
-	return val1, val2, nil
+	return foldNumbers("+", a, types.Add)
 }
 
-func lessThan(e types.Env, a []types.Base) (types.Base, error) {
-	v1, v2, err := prepareCompare(a)
-	if err != nil {
+func sub(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) == 0 {
+		return nil, arityError("-", a)
+	} else if err := assertNumbers("-", a); err != nil {
 		return nil, err
+	} else if len(a) == 1 {
+		return types.Negate(a[0])
 	}
-	return v1 < v2, nil
+	return foldNumbers("-", a, types.Sub)
 }
 
-func lessThanEqual(e types.Env, a []types.Base) (types.Base, error) {
-	v1, v2, err := prepareCompare(a)
-	if err != nil {
+func mul(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) == 0 {
+		return int64(1), nil
+	} else if err := assertNumbers("*", a); err != nil {
 		return nil, err
 	}
-	return v1 <= v2, nil
+	return foldNumbers("*", a, types.Mul)
 }
 
-func greaterThan(e types.Env, a []types.Base) (types.Base, error) {
-	v1, v2, err := prepareCompare(a)
-	if err != nil {
+func div(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) == 0 {
+		return nil, arityError("/", a)
+	} else if err := assertNumbers("/", a); err != nil {
 		return nil, err
+	} else if len(a) == 1 {
+		a = []types.Base{int64(1), a[0]}
 	}
-	return v1 > v2, nil
+	return foldNumbers("/", a, types.Div)
 }
 
-func greaterThanEqual(e types.Env, a []types.Base) (types.Base, error) {
-	v1, v2, err := prepareCompare(a)
-	if err != nil {
+func binaryNumeric(name string, a []types.Base, op func(x, y types.Base) (types.Base, error)) (types.Base, error) {
+	if len(a) != 2 {
+		return nil, arityError(name, a)
+	} else if err := assertNumbers(name, a); err != nil {
 		return nil, err
 	}
-	return v1 >= v2, nil
+	return foldNumbers(name, a, op)
 }
 
-func add(e types.Env, a []types.Base) (types.Base, error) {
-	if e := assertArgNum(a, 2); e != nil {
-		return nil, e
+func mod(e types.Env, a []types.Base) (types.Base, error) {
+	return binaryNumeric("mod", a, types.Mod)
+}
+
+func rem(e types.Env, a []types.Base) (types.Base, error) {
+	return binaryNumeric("rem", a, types.Rem)
+}
+
+func quot(e types.Env, a []types.Base) (types.Base, error) {
+	return binaryNumeric("quot", a, types.Quot)
+}
+
+func inc(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 1 {
+		return nil, arityError("inc", a)
 	}
-	return a[0].(float64) + a[1].(float64), nil
+	return binaryNumeric("inc", []types.Base{a[0], int64(1)}, types.Add)
 }
 
-func sub(e types.Env, a []types.Base) (types.Base, error) {
-	if e := assertArgNum(a, 2); e != nil {
-		return nil, e
+func dec(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 1 {
+		return nil, arityError("dec", a)
 	}
-	return a[0].(float64) - a[1].(float64), nil
+	return binaryNumeric("dec", []types.Base{a[0], int64(1)}, types.Sub)
 }
 
-func mul(e types.Env, a []types.Base) (types.Base, error) {
-	if e := assertArgNum(a, 2); e != nil {
-		return nil, e
+func abs(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 1 {
+		return nil, arityError("abs", a)
+	} else if err := assertNumbers("abs", a); err != nil {
+		return nil, err
+	} else if types.Sign(a[0]) < 0 {
+		return types.Negate(a[0])
 	}
-	return a[0].(float64) * a[1].(float64), nil
+	return a[0], nil
 }
 
-func div(e types.Env, a []types.Base) (types.Base, error) {
-	if e := assertArgNum(a, 2); e != nil {
-		return nil, e
+func extreme(name string, a []types.Base, keep func(cmp int) bool) (types.Base, error) {
+	if len(a) == 0 {
+		return nil, arityError(name, a)
+	} else if err := assertNumbers(name, a); err != nil {
+		return nil, err
+	}
+	result := a[0]
+	for _, arg := range a[1:] {
+		if cmp, _ := types.NumCompare(arg, result); keep(cmp) {
+			result = arg
+		}
 	}
-	return a[0].(float64) / a[1].(float64), nil
+	return result, nil
+}
+
+func min(e types.Env, a []types.Base) (types.Base, error) {
+	return extreme("min", a, func(cmp int) bool { return cmp < 0 })
+}
+
+func max(e types.Env, a []types.Base) (types.Base, error) {
+	return extreme("max", a, func(cmp int) bool { return cmp > 0 })
 }
 
 func assertArgNum(a []types.Base, expectedLen int) error {
 	if len(a) != expectedLen {
-		return errors.New("wrong number of arguments")
+		return types.Errorf(types.ArityError, "wrong number of arguments").
+			With(types.Keyword("count"), int64(len(a)), types.Keyword("expected"), int64(expectedLen))
 	}
 	return nil
 }
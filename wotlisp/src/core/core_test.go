@@ -0,0 +1,115 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/printer"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// printCase is source to evaluate and how its result should print
+type printCase struct {
+	src      string
+	expected string
+}
+
+// evalPrinted runs the cases in order, each in a fresh namespace
+func evalPrinted(t *testing.T, cases []printCase) {
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			val, err := evalIn(NewNamespace(Options{Out: ioutil.Discard}), c.src)
+			if err != nil {
+				t.Fatal(err)
+			} else if printed := printer.Print(val, true); printed != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, printed)
+			}
+		})
+	}
+}
+
+func TestArithmeticBuiltins(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(+)`, `0`},
+		{`(+ 1)`, `1`},
+		{`(+ 1 2 3 4)`, `10`},
+		{`(*)`, `1`},
+		{`(* 2 3 4)`, `24`},
+		{`(- 5)`, `-5`},
+		{`(- 10 1 2 3)`, `4`},
+		{`(/ 2)`, `1/2`},
+		{`(/ 12 2 3)`, `2`},
+		{`(+ 1 1/2 0.5)`, `2.0`},
+		{`(+ 9223372036854775807 1)`, `9223372036854775808N`},
+		{`(inc 9223372036854775807)`, `9223372036854775808N`},
+		{`(dec -9223372036854775808)`, `-9223372036854775809N`},
+		{`(abs -3/4)`, `3/4`},
+		{`(min 3 1.5 2)`, `1.5`},
+		{`(max 1 5/2 2)`, `5/2`},
+		{`(quot 7 2)`, `3`},
+		{`(rem -7 2)`, `-1`},
+		{`(mod -7 2)`, `1`},
+	})
+}
+
+func TestComparisonBuiltins(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(< 1)`, `true`},
+		{`(< 1 2 3)`, `true`},
+		{`(< 1 3 2)`, `false`},
+		{`(<= 1 1 2)`, `true`},
+		{`(> 3 2 1)`, `true`},
+		{`(>= 3 3 4)`, `false`},
+		{`(== 1 1.0 1N)`, `true`},
+		{`(= 1 1.0)`, `false`},
+		{`(= [1 2] '(1 2))`, `true`},
+		{`(not= 1 2)`, `true`},
+		{`(< 1/3 0.34 1M)`, `true`},
+	})
+}
+
+func TestNumericBuiltinErrors(t *testing.T) {
+	cases := []struct {
+		src      string
+		errType  types.ErrorType
+		expected string
+	}{
+		{`(+ 1 "2")`, types.TypeError, `+: argument 2 must be a number, got string`},
+		{`(< 1 :a)`, types.TypeError, `<: argument 2 must be a number, got keyword`},
+		{`(max nil)`, types.TypeError, `max: argument 1 must be a number, got nil`},
+		{`(-)`, types.ArityError, `-: wrong number of arguments (0)`},
+		{`(<)`, types.ArityError, `<: wrong number of arguments (0)`},
+		{`(mod 1)`, types.ArityError, `mod: wrong number of arguments (1)`},
+		{`(inc 1 2)`, types.ArityError, `inc: wrong number of arguments (2)`},
+		{`(/ 1 0)`, types.ArithmeticError, `/: divide by zero`},
+		{`(quot 1 0)`, types.ArithmeticError, `quot: divide by zero`},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			_, err := evalIn(NewNamespace(Options{Out: ioutil.Discard}), c.src)
+			var wotErr *types.Error
+			if !errors.Is(err, c.errType) || !errors.As(err, &wotErr) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			} else if wotErr.Message != c.expected {
+				t.Fatalf("expected %q, got %q", c.expected, wotErr.Message)
+			}
+		})
+	}
+}
+
+// TestMeta checks the positions the reader keeps for forms are not part of
+// their metadata
+func TestMeta(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(meta '(1 2))`, `nil`},
+		{`(meta '[1 2])`, `nil`},
+		{`(meta '{:a 1})`, `nil`},
+		{`(meta '#{1})`, `nil`},
+		{`(meta (quote (quote x)))`, `nil`},
+		{`(meta (with-meta '(1 2) {:a 1}))`, `{:a 1}`},
+		{`(meta (with-meta [1 2] {:line 3}))`, `{:line 3}`},
+		{`(meta (with-meta (with-meta '[1] {:a 1}) nil))`, `nil`},
+		{`(= (with-meta '(1 2) {:a 1}) '(1 2))`, `true`},
+	})
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// exinfo creates an error with a message and a map of data, (ex-info msg map)
+// or (ex-info msg map cause)
+func exinfo(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) != 2 && len(a) != 3 {
+		return nil, arityError("ex-info", a)
+	}
+	msg, ok := a[0].(string)
+	if !ok {
+		return nil, argError("ex-info", 1, "a string", a[0])
+	} else if _, isMap := a[1].(types.Map); !isMap && a[1] != nil {
+		return nil, argError("ex-info", 2, "a map", a[1])
+	}
+	exInfo := &types.ExInfo{Message: msg, Data: a[1]}
+	if len(a) == 3 && a[2] != nil {
+		if cause, isErr := a[2].(error); isErr {
+			exInfo.Cause = cause
+		} else {
+			exInfo.Cause = types.UserError{Val: a[2]}
+		}
+	}
+	return exInfo, nil
+}
+
+func exdata(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	if exInfo, isExInfo := a[0].(*types.ExInfo); isExInfo {
+		return exInfo.Data, nil
+	}
+	return nil, nil
+}
+
+func exmessage(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	if err, isErr := a[0].(error); isErr {
+		return err.Error(), nil
+	}
+	return nil, nil
+}
+
+// excause returns the error that the error wraps, unwrapping thrown values
+func excause(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	err, isErr := a[0].(error)
+	if !isErr {
+		return nil, nil
+	}
+	cause := errors.Unwrap(err)
+	if userErr, isUserErr := cause.(types.UserError); isUserErr {
+		return userErr.Val, nil
+	} else if cause == nil {
+		return nil, nil
+	}
+	return cause, nil
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// slurp reads the whole file at a path inside of root
+func slurp(root string) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		if err := assertArgNum(a, 1); err != nil {
+			return nil, err
+		}
+		return readFile(root, a[0])
+	})
+}
+
+func readFile(root string, arg types.Base) (types.Base, error) {
+	path, ok := arg.(string)
+	if !ok {
+		return nil, types.Errorf(types.TypeError, "cannot read source from non-string path")
+	}
+	resolved, err := resolvePath(root, path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		return nil, types.Errorf(types.IOError, "problem reading source file: %v", err).With(types.Keyword("path"), path).Wrap(err)
+	}
+	return string(b), nil
+}
+
+// spit writes the string of a value to the file at a path inside of root,
+// replacing the file or appending to it with (spit path val :append true)
+func spit(root string) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		if len(a) != 2 && len(a) != 4 {
+			return nil, arityError("spit", a)
+		}
+		path, ok := a[0].(string)
+		if !ok {
+			return nil, argError("spit", 1, "a string", a[0])
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if len(a) == 4 {
+			if a[2] != types.Keyword("append") {
+				return nil, types.Errorf(types.TypeError, "spit: unknown option %v", a[2])
+			} else if truthy(a[3]) {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+		}
+		content, err := str(e, a[1:2])
+		if err != nil {
+			return nil, err
+		}
+		resolved, err := resolvePath(root, path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(resolved, flags, 0644)
+		if err == nil {
+			_, err = file.WriteString(content.(string))
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			return nil, types.Errorf(types.IOError, "problem writing file: %v", err).With(types.Keyword("path"), path).Wrap(err)
+		}
+		return nil, nil
+	})
+}
+
+// resolvePath finds the file for a path when the file builtins are limited to
+// root. Relative paths are relative to root and any path that leads outside of
+// it, with .. or through a symlink, is an error. Without a root the path is
+// used as it is.
+func resolvePath(root, path string) (string, error) {
+	if root == "" {
+		return path, nil
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", types.Errorf(types.IOError, "invalid root directory: %v", err).Wrap(err)
+	}
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return "", types.Errorf(types.IOError, "invalid root directory: %v", err).Wrap(err)
+	}
+
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(absRoot, resolved)
+	}
+	if !inside(absRoot, resolved) {
+		return "", outsideRoot(path)
+	}
+	// a file that does not exist yet, like one spit will create, is checked by
+	// the directory it will be created in. A broken symlink is not allowed since
+	// creating the file would follow it.
+	real, err := filepath.EvalSymlinks(resolved)
+	if os.IsNotExist(err) {
+		if info, lerr := os.Lstat(resolved); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", types.Errorf(types.IOError, "path %v is a broken symlink", path).With(types.Keyword("path"), path)
+		}
+		var dir string
+		if dir, err = filepath.EvalSymlinks(filepath.Dir(resolved)); err == nil {
+			real = filepath.Join(dir, filepath.Base(resolved))
+		}
+	}
+	if err != nil {
+		return "", types.Errorf(types.IOError, "problem resolving path: %v", err).With(types.Keyword("path"), path).Wrap(err)
+	} else if !inside(realRoot, real) {
+		return "", outsideRoot(path)
+	}
+	return real, nil
+}
+
+// inside reports if the cleaned path is root or somewhere below it
+func inside(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func outsideRoot(path string) error {
+	return types.Errorf(types.IOError, "path %v is outside of the root directory", path).With(types.Keyword("path"), path)
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// fileTree creates a root directory with a file, a directory, symlinks that
+// stay inside of it and lead out of it and a file outside of it. The returned
+// function removes them.
+func fileTree(t *testing.T) (root, outside string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "wotroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	root, outside = filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "file.txt"):        "inside",
+		filepath.Join(root, "sub", "file.txt"): "nested",
+		filepath.Join(outside, "secret.txt"):   "secret",
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(root, "inner-link"):  filepath.Join(root, "sub", "file.txt"),
+		filepath.Join(root, "secret-link"): filepath.Join(outside, "secret.txt"),
+		filepath.Join(root, "dir-link"):    outside,
+		filepath.Join(root, "broken-link"): filepath.Join(root, "missing.txt"),
+		filepath.Join(root, "out-broken"):  filepath.Join(outside, "missing.txt"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, outside, cleanup
+}
+
+func TestResolvePath(t *testing.T) {
+	root, outside, cleanup := fileTree(t)
+	defer cleanup()
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"relative file", "file.txt", filepath.Join(realRoot, "file.txt")},
+		{"nested file", "sub/file.txt", filepath.Join(realRoot, "sub", "file.txt")},
+		{"dot dot that stays inside", "sub/../file.txt", filepath.Join(realRoot, "file.txt")},
+		{"absolute path inside", filepath.Join(root, "file.txt"), filepath.Join(realRoot, "file.txt")},
+		{"new file", "new.txt", filepath.Join(realRoot, "new.txt")},
+		{"symlink inside", "inner-link", filepath.Join(realRoot, "sub", "file.txt")},
+		{"dot dot traversal", "../outside/secret.txt", ""},
+		{"deep dot dot traversal", "sub/../../outside/secret.txt", ""},
+		{"absolute path outside", filepath.Join(outside, "secret.txt"), ""},
+		{"absolute root of the filesystem", "/etc/passwd", ""},
+		{"symlink to a file outside", "secret-link", ""},
+		{"symlink to a directory outside", "dir-link/secret.txt", ""},
+		{"new file through a symlinked directory", "dir-link/new.txt", ""},
+		{"broken symlink inside", "broken-link", ""},
+		{"broken symlink outside", "out-broken", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resolved, err := resolvePath(root, c.path)
+			if c.expected == "" {
+				if !errors.Is(err, types.IOError) {
+					t.Fatalf("expected %v to be refused, got %v %v", c.path, resolved, err)
+				}
+			} else if err != nil || resolved != c.expected {
+				t.Fatalf("expected %v to resolve to %v, got %v %v", c.path, c.expected, resolved, err)
+			}
+		})
+	}
+}
+
+func TestResolvePathWithoutRoot(t *testing.T) {
+	if resolved, err := resolvePath("", "../anything"); err != nil || resolved != "../anything" {
+		t.Fatalf("expected the path as it is without a root, got %v %v", resolved, err)
+	}
+}
+
+func evalIn(ns types.Env, src string) (types.Base, error) {
+	form, err := reader.ReadString(src)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.Eval(context.Background(), ns, form)
+}
+
+func TestFileBuiltinsInRoot(t *testing.T) {
+	root, outside, cleanup := fileTree(t)
+	defer cleanup()
+	ns := NewNamespace(Options{Root: root, Out: ioutil.Discard, LoadPath: []string{root}})
+	cases := []struct {
+		src      string
+		expected types.Base
+	}{
+		{`(slurp "file.txt")`, "inside"},
+		{`(do (spit "written.txt" "data") (slurp "written.txt"))`, "data"},
+		{`(slurp "../outside/secret.txt")`, nil},
+		{`(slurp "secret-link")`, nil},
+		{`(spit "dir-link/new.txt" "data")`, nil},
+		{`(spit "broken-link" "data")`, nil},
+		{`(load-file "../outside/secret.txt")`, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			val, err := evalIn(ns, c.src)
+			if c.expected == nil {
+				if !errors.Is(err, types.IOError) {
+					t.Fatalf("expected an io error, got %v %v", val, err)
+				}
+			} else if err != nil || val != c.expected {
+				t.Fatalf("expected %v, got %v %v", c.expected, val, err)
+			}
+		})
+	}
+	for _, name := range []string{"new.txt", "missing.txt"} {
+		if _, err := os.Stat(filepath.Join(outside, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected nothing to be written outside of the root, got %v", err)
+		}
+	}
+}
+
+func TestFileBuiltinsNeedCapabilities(t *testing.T) {
+	root, _, cleanup := fileTree(t)
+	defer cleanup()
+	cases := []struct {
+		caps    []Capability
+		src     string
+		errType types.ErrorType
+	}{
+		{[]Capability{Pure}, `(slurp "file.txt")`, types.UnboundSymbolError},
+		{[]Capability{Pure}, `(load-file "file.txt")`, types.UnboundSymbolError},
+		{[]Capability{Pure}, `(spit "file.txt" "x")`, types.UnboundSymbolError},
+		{[]Capability{Pure, IOWrite}, `(slurp "file.txt")`, types.UnboundSymbolError},
+		{[]Capability{Pure, IORead}, `(spit "file.txt" "x")`, types.UnboundSymbolError},
+		{[]Capability{Pure}, `(require 'file)`, types.IOError},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			ns := NewNamespace(Options{Root: root, Capabilities: c.caps, Out: ioutil.Discard, LoadPath: []string{root}})
+			if _, err := evalIn(ns, c.src); !errors.Is(err, c.errType) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			}
+		})
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(root, "file.txt")); err != nil || string(content) != "inside" {
+		t.Fatalf("expected the file to be unchanged, got %q %v", content, err)
+	}
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	goruntime "runtime"
+	"time"
+
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// pmapAhead is how many calls pmap keeps running ahead of the values read
+var pmapAhead = goruntime.NumCPU() + 2
+
+// futureCall calls the function with no arguments on a new goroutine. The
+// future is evaluated with a context forked from the caller so it is
+// cancelled with the evaluation that started it.
+func futureCall(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	return startFuture(e, a[0], nil), nil
+}
+
+// startFuture calls fn with the args on a new goroutine. Lazy results are
+// realized on the goroutine so the work is not left to whoever derefs it.
+func startFuture(e types.Env, fn types.Base, args []types.Base) *types.Future {
+	ctx, cancel := runtime.Fork(types.ContextOf(e))
+	return types.NewFuture(ctx, cancel, func(ctx context.Context) (types.Base, error) {
+		val, err := types.CallFunc(types.WithContext(e, ctx), fn, args)
+		if err == nil {
+			err = types.Realize(val)
+		}
+		return val, err
+	})
+}
+
+func asFuture(name string, a []types.Base) (*types.Future, error) {
+	future, ok := a[0].(*types.Future)
+	if !ok {
+		return nil, argError(name, 1, "a future", a[0])
+	}
+	return future, nil
+}
+
+func isfuture(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, is := a[0].(*types.Future)
+	return is, nil
+}
+
+func futureDone(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	future, err := asFuture("future-done?", a)
+	if err != nil {
+		return nil, err
+	}
+	return future.Done(), nil
+}
+
+// futureCancel cancels the context of the future, returning false if it had
+// already finished or been cancelled.
+func futureCancel(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	future, err := asFuture("future-cancel", a)
+	if err != nil {
+		return nil, err
+	}
+	return future.Cancel(), nil
+}
+
+func futureCancelled(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	future, err := asFuture("future-cancelled?", a)
+	if err != nil {
+		return nil, err
+	}
+	return future.Cancelled(), nil
+}
+
+func promise(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 0); err != nil {
+		return nil, err
+	}
+	return types.NewPromise(), nil
+}
+
+// deliver sets the value of a promise, returning the promise the first time
+// and nil once it has already been delivered.
+func deliver(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	promise, ok := a[0].(*types.Promise)
+	if !ok {
+		return nil, argError("deliver", 1, "a promise", a[0])
+	} else if promise.Deliver(a[1]) {
+		return promise, nil
+	}
+	return nil, nil
+}
+
+// awaitRef waits for the value of a future or promise. Given a timeout in
+// milliseconds and a timeout value, the timeout value is returned if the
+// reference is not ready in time.
+func awaitRef(e types.Env, ref types.Awaitable, timeout []types.Base) (types.Base, error) {
+	ctx := types.ContextOf(e)
+	if len(timeout) == 0 {
+		return ref.Await(ctx)
+	}
+	ms, ok := types.ToInt(timeout[0])
+	if !ok {
+		return nil, argError("deref", 2, "an integer", timeout[0])
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+	defer cancel()
+	val, err := ref.Await(waitCtx)
+	if err != nil && ctx.Err() == nil && waitCtx.Err() == context.DeadlineExceeded && !ref.Done() {
+		return timeout[1], nil
+	}
+	return val, err
+}
+
+// pmap is like map but every call is made on its own goroutine. Calls are
+// started as the values are read, keeping a few ahead of the value being
+// read.
+func pmap(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 2 {
+		return nil, arityError("pmap", a)
+	}
+	fn := a[0]
+	start := types.Func(func(e types.Env, args []types.Base) (types.Base, error) {
+		return startFuture(e, fn, args), nil
+	})
+	futures := lazyMap(e, start, a[1:])
+	return lazyAwait(e, futures, lazyDrop(pmapAhead, futures)), nil
+}
+
+// lazyAwait is the values of a seq of futures. ahead is the same seq further
+// along and is realized one cell at a time to start the next future as each
+// value is read.
+func lazyAwait(e types.Env, futures, ahead types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		seq, err := types.ToSeq(futures)
+		if err != nil || seq == nil {
+			return nil, err
+		}
+		aheadSeq, err := types.ToSeq(ahead)
+		if err != nil {
+			return nil, err
+		}
+		var next types.Base
+		if aheadSeq != nil {
+			next = aheadSeq.More()
+		}
+		val, err := seq.First().(*types.Future).Await(types.ContextOf(e))
+		if err != nil {
+			return nil, err
+		}
+		return types.NewCons(val, lazyAwait(e, seq.More(), next)), nil
+	})
+}
+
+// pcalls calls each function with no arguments on its own goroutine, the same
+// way pmap does.
+func pcalls(e types.Env, a []types.Base) (types.Base, error) {
+	call := types.Func(func(e types.Env, fns []types.Base) (types.Base, error) {
+		return types.CallFunc(e, fns[0], nil)
+	})
+	return pmap(e, []types.Base{call, types.NewList(a...)})
+}
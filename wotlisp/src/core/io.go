@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tanema/mal/wotlisp/src/printer"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// LineReader returns a function that reads a line at a time from in, writing
+// the prompt to out first. When in is nil lines are read from stdin. It
+// returns io.EOF when the input runs out.
+func LineReader(in io.Reader, out io.Writer) func(prompt string) (string, error) {
+	if in == nil {
+		in = os.Stdin
+	}
+	lines := bufio.NewReader(in)
+	return func(prompt string) (string, error) {
+		fmt.Fprint(out, prompt)
+		line, err := lines.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), err
+	}
+}
+
+// ioVars are the dynamic vars the io builtins read so where they print and
+// read from can be changed with binding
+type ioVars struct {
+	out, err, in, printReadably *types.Var
+}
+
+func newIOVars(opts Options) ioVars {
+	return ioVars{
+		out:           types.NewVar("*out*", types.NewStream("*out*", opts.Out), true),
+		err:           types.NewVar("*err*", types.NewStream("*err*", opts.Err), true),
+		in:            types.NewVar("*in*", types.NewStream("*in*", opts.ReadLine), true),
+		printReadably: types.NewVar("*print-readably*", true, true),
+	}
+}
+
+func (vars ioVars) all() []*types.Var {
+	return []*types.Var{vars.out, vars.err, vars.in, vars.printReadably}
+}
+
+// streamOf is the go value a var is bound to in ctx, a stream or a go value
+// the host gave to bind it to
+func streamOf(ctx context.Context, v *types.Var) interface{} {
+	switch val := v.Value(ctx).(type) {
+	case *types.Stream:
+		return val.Val()
+	case *types.GoValue:
+		return val.Val
+	}
+	return nil
+}
+
+// writerOf is the writer a var is bound to in ctx
+func writerOf(ctx context.Context, v *types.Var) (io.Writer, error) {
+	if w, ok := streamOf(ctx, v).(io.Writer); ok {
+		return w, nil
+	}
+	return nil, types.Errorf(types.TypeError, "%v is not a writer", v.Name)
+}
+
+// lineReaderOf is the line reader *in* is bound to in ctx. It can be bound to
+// a line reader function or to a reader, which should be a *bufio.Reader so
+// input read ahead by one line is not lost to the next.
+func lineReaderOf(ctx context.Context, vars ioVars) (func(string) (string, error), error) {
+	switch in := streamOf(ctx, vars.in).(type) {
+	case func(string) (string, error):
+		return in, nil
+	case io.Reader:
+		out, err := writerOf(ctx, vars.out)
+		return LineReader(in, out), err
+	}
+	return nil, types.Errorf(types.TypeError, "%v is not a reader", vars.in.Name)
+}
+
+// prn prints the values readably to *out*, unless *print-readably* is false
+func prn(vars ioVars) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		ctx := types.ContextOf(e)
+		return nil, printValues(ctx, vars.out, a, truthy(vars.printReadably.Value(ctx)))
+	})
+}
+
+func prnln(vars ioVars) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		return nil, printValues(types.ContextOf(e), vars.out, a, false)
+	})
+}
+
+func printValues(ctx context.Context, v *types.Var, a []types.Base, readably bool) error {
+	if err := types.Realize(a...); err != nil {
+		return err
+	}
+	out, err := writerOf(ctx, v)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, printer.List(a, readably, "", "", " "))
+	return nil
+}
+
+// rdline reads a line from *in* with an optional prompt, returning nil at the
+// end of the input.
+func rdline(vars ioVars) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		prompt := ""
+		if len(a) > 0 {
+			if p, isstring := a[0].(string); isstring {
+				prompt = p
+			}
+		}
+		readLine, err := lineReaderOf(types.ContextOf(e), vars)
+		if err != nil {
+			return nil, err
+		}
+		line, err := readLine(prompt)
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, types.Errorf(types.IOError, "readline: %v", err).Wrap(err)
+		}
+		return line, nil
+	})
+}
@@ -0,0 +1,367 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tanema/mal/wotlisp/src/env"
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+const (
+	// CoreNamespace is the namespace of the builtins
+	CoreNamespace types.Symbol = "wot.core"
+	// UserNamespace is the namespace evaluation starts in
+	UserNamespace types.Symbol = "user"
+)
+
+// namespaces is the state shared by the builtins that switch, load and refer
+// namespaces. The current namespace is the dynamic var *ns* so loading a file
+// can bind it and any namespace the file switches to is only used for the
+// rest of the file.
+type namespaces struct {
+	registry *env.Registry
+	current  *types.Var
+	loadPath []string
+	root     string
+	canRead  bool
+	mu       sync.Mutex
+	loads    map[types.Symbol]*nsLoad
+}
+
+// nsLoad is a namespace being loaded from a file, or one that has been. done
+// is closed once the file has been evaluated.
+type nsLoad struct {
+	done chan struct{}
+	err  error
+}
+
+type loadingKey struct{}
+
+// defaultLoadPath is the directories in WOTPATH or the working directory
+func defaultLoadPath() []string {
+	if dirs := filepath.SplitList(os.Getenv("WOTPATH")); len(dirs) > 0 {
+		return dirs
+	}
+	return []string{"."}
+}
+
+// CurrentNamespace is the namespace forms are evaluated in, the value of *ns*
+// in ctx. It is nil if e has no namespaces.
+func CurrentNamespace(ctx context.Context, e types.Env) *env.Namespace {
+	val, _ := e.Get("*ns*")
+	if current, isVar := val.(*types.Var); isVar {
+		ns, _ := current.Value(ctx).(*env.Namespace)
+		return ns
+	}
+	return nil
+}
+
+// BindNamespace binds *ns* in ctx to the current namespace so switching
+// namespaces while evaluating with the returned context does not change the
+// namespace outside of it.
+func BindNamespace(ctx context.Context, e types.Env) context.Context {
+	val, _ := e.Get("*ns*")
+	if current, isVar := val.(*types.Var); isVar {
+		return types.WithBindings(ctx, map[*types.Var]types.Base{current: current.Value(ctx)})
+	}
+	return ctx
+}
+
+func (nss *namespaces) currentNs(ctx context.Context) *env.Namespace {
+	ns, _ := nss.current.Value(ctx).(*env.Namespace)
+	return ns
+}
+
+// setCurrent switches namespace for the rest of the binding of *ns*, or for
+// good if it is not bound
+func (nss *namespaces) setCurrent(ctx context.Context, ns *env.Namespace) {
+	if err := nss.current.Set(ctx, ns); err != nil {
+		nss.current.SetRoot(ns)
+	}
+}
+
+// evalFile evaluates the forms of a file in the current namespace, with *ns*
+// bound so the file can switch namespace with ns or in-ns.
+func (nss *namespaces) evalFile(ctx context.Context, path types.Base) (types.Base, error) {
+	source, err := readFile(nss.root, path)
+	if err != nil {
+		return nil, err
+	}
+	forms, err := reader.ReadFile(path.(string), source.(string))
+	if err != nil {
+		return nil, err
+	}
+	ctx = types.WithBindings(ctx, map[*types.Var]types.Base{nss.current: nss.currentNs(ctx)})
+	var result types.Base
+	for _, form := range forms {
+		if result, err = runtime.Eval(ctx, nss.currentNs(ctx), form); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// load loads the namespace from its file in the load path unless it has been
+// loaded already or reload is set. Goroutines that require a namespace while
+// it is loading wait for it.
+func (nss *namespaces) load(ctx context.Context, name types.Symbol, reload bool) (*env.Namespace, error) {
+	loading, _ := ctx.Value(loadingKey{}).([]types.Symbol)
+	for _, other := range loading {
+		if other == name {
+			return nil, types.Errorf(types.StateError, "cyclic require of %v", name).With(types.Keyword("ns"), name)
+		}
+	}
+
+	nss.mu.Lock()
+	load, loaded := nss.loads[name]
+	if !reload && (loaded || nss.registry.Find(name) != nil) {
+		nss.mu.Unlock()
+		if loaded {
+			select {
+			case <-load.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if load.err != nil {
+				return nil, load.err
+			}
+		}
+		return nss.registry.Find(name), nil
+	}
+	load = &nsLoad{done: make(chan struct{})}
+	nss.loads[name] = load
+	nss.mu.Unlock()
+
+	ctx = context.WithValue(ctx, loadingKey{}, append(loading[:len(loading):len(loading)], name))
+	load.err = nss.loadFile(ctx, name)
+	if load.err == nil && nss.registry.Find(name) == nil {
+		load.err = types.Errorf(types.StateError, "loading %v did not define the namespace", name).With(types.Keyword("ns"), name)
+	}
+	if load.err != nil {
+		nss.mu.Lock()
+		delete(nss.loads, name)
+		nss.mu.Unlock()
+	}
+	close(load.done)
+	return nss.registry.Find(name), load.err
+}
+
+// loadFile finds the file of a namespace in the load path and evaluates it.
+// The file of a.b-c is a/b_c.wot.
+func (nss *namespaces) loadFile(ctx context.Context, name types.Symbol) error {
+	if !nss.canRead {
+		return types.Errorf(types.IOError, "loading %v needs the %v capability", name, IORead).With(types.Keyword("ns"), name)
+	}
+	file := filepath.FromSlash(strings.Replace(strings.Replace(string(name), ".", "/", -1), "-", "_", -1)) + ".wot"
+	for _, dir := range nss.loadPath {
+		path := filepath.Join(dir, file)
+		resolved, err := resolvePath(nss.root, path)
+		if err != nil {
+			continue
+		} else if _, err := os.Stat(resolved); err == nil {
+			_, err = nss.evalFile(ctx, path)
+			return err
+		}
+	}
+	return types.Errorf(types.IOError, "could not find %v in the load path", file).With(types.Keyword("ns"), name)
+}
+
+// asNamespace finds the namespace a symbol names
+func (nss *namespaces) asNamespace(name string, a []types.Base, n int) (*env.Namespace, error) {
+	sym, ok := a[n-1].(types.Symbol)
+	if !ok {
+		return nil, argError(name, n, "a namespace name", a[n-1])
+	} else if ns := nss.registry.Find(sym); ns != nil {
+		return ns, nil
+	}
+	return nil, types.Errorf(types.StateError, "%v: no namespace %v", name, sym).With(types.Keyword("ns"), sym)
+}
+
+// inNs switches to the namespace, creating it if it does not exist
+func inNs(nss *namespaces) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		if err := assertArgNum(a, 1); err != nil {
+			return nil, err
+		}
+		name, ok := a[0].(types.Symbol)
+		if !ok {
+			return nil, argError("in-ns", 1, "a namespace name", a[0])
+		}
+		ns := nss.registry.FindOrCreate(name)
+		nss.setCurrent(types.ContextOf(e), ns)
+		return ns, nil
+	})
+}
+
+// nsCall switches to the namespace and requires the libs in its :require
+// clauses, the ns macro calls it with (ns-call 'name '((:require libs...)))
+func nsCall(nss *namespaces) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		if err := assertArgNum(a, 2); err != nil {
+			return nil, err
+		}
+		ns, err := inNs(nss).Fn(e, a[:1])
+		if err != nil {
+			return nil, err
+		}
+		clauses, _ := a[1].(types.Collection)
+		if clauses == nil {
+			return ns, nil
+		}
+		for _, clause := range clauses.Data() {
+			forms, ok := clause.(types.Collection)
+			if !ok || forms.Count() == 0 || forms.Data()[0] != types.Keyword("require") {
+				return nil, types.Errorf(types.SyntaxError, "ns: unsupported clause %v", types.TypeName(clause))
+			}
+			if _, err := requireLibs(nss).Fn(e, forms.Data()[1:]); err != nil {
+				return nil, err
+			}
+		}
+		return ns, nil
+	})
+}
+
+// requireLibs loads each lib if it has not been loaded yet. A lib is a
+// namespace name or [name :as alias :refer [names]], :refer :all refers every
+// name. (require 'lib :reload) loads the libs again.
+func requireLibs(nss *namespaces) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		ctx := types.ContextOf(e)
+		reload := false
+		libs := []types.Base{}
+		for _, arg := range a {
+			if arg == types.Keyword("reload") {
+				reload = true
+			} else {
+				libs = append(libs, arg)
+			}
+		}
+		for _, lib := range libs {
+			if err := nss.require(ctx, lib, reload); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+}
+
+func (nss *namespaces) require(ctx context.Context, lib types.Base, reload bool) error {
+	var opts []types.Base
+	if spec, ok := lib.(*types.Vector); ok && spec.Count() > 0 {
+		lib, opts = spec.Data()[0], spec.Data()[1:]
+	}
+	name, ok := lib.(types.Symbol)
+	if !ok || len(opts)%2 != 0 {
+		return types.Errorf(types.SyntaxError, "require: a lib must be a name or [name & options]")
+	}
+	ns, err := nss.load(ctx, name, reload)
+	if err != nil {
+		return err
+	}
+	current := nss.currentNs(ctx)
+	for i := 0; i < len(opts); i += 2 {
+		switch opts[i] {
+		case types.Keyword("as"):
+			alias, ok := opts[i+1].(types.Symbol)
+			if !ok {
+				return types.Errorf(types.SyntaxError, "require: :as must be followed by a symbol")
+			}
+			current.Alias(alias, ns)
+		case types.Keyword("refer"):
+			if err := referNames("require", current, ns, opts[i+1], nil); err != nil {
+				return err
+			}
+		default:
+			return types.Errorf(types.SyntaxError, "require: unknown option %v", opts[i])
+		}
+	}
+	return nil
+}
+
+// referNames refers the names from one namespace in another, names is a
+// collection of symbols or :all for every name except the excluded ones
+func referNames(name string, to, from *env.Namespace, names types.Base, exclude map[types.Symbol]bool) error {
+	if names == types.Keyword("all") {
+		for _, sym := range from.Names() {
+			if !exclude[sym] {
+				to.Refer(from, sym)
+			}
+		}
+		return nil
+	}
+	syms, ok := names.(types.Collection)
+	if !ok {
+		return types.Errorf(types.SyntaxError, "%v: names to refer must be a collection or :all", name)
+	}
+	for _, item := range syms.Data() {
+		sym, ok := item.(types.Symbol)
+		if !ok {
+			return types.Errorf(types.SyntaxError, "%v: cannot refer %v", name, types.TypeName(item))
+		} else if _, defined := from.Lookup(sym); !defined {
+			return types.Errorf(types.UnboundSymbolError, "%v: %v is not defined in %v", name, sym, from.Name).With(types.Keyword("symbol"), sym)
+		}
+		to.Refer(from, sym)
+	}
+	return nil
+}
+
+// refer refers the names of a loaded namespace in the current one,
+// (refer 'ns :only [names]) or (refer 'ns :exclude [names])
+func refer(nss *namespaces) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		if len(a) != 1 && len(a) != 3 {
+			return nil, arityError("refer", a)
+		}
+		from, err := nss.asNamespace("refer", a, 1)
+		if err != nil {
+			return nil, err
+		}
+		current := nss.currentNs(types.ContextOf(e))
+		if len(a) == 1 {
+			return nil, referNames("refer", current, from, types.Keyword("all"), nil)
+		}
+		switch a[1] {
+		case types.Keyword("only"):
+			return nil, referNames("refer", current, from, a[2], nil)
+		case types.Keyword("exclude"):
+			syms, ok := a[2].(types.Collection)
+			if !ok {
+				return nil, argError("refer", 3, "a collection of symbols", a[2])
+			}
+			exclude := map[types.Symbol]bool{}
+			for _, item := range syms.Data() {
+				if sym, ok := item.(types.Symbol); ok {
+					exclude[sym] = true
+				}
+			}
+			return nil, referNames("refer", current, from, types.Keyword("all"), exclude)
+		}
+		return nil, types.Errorf(types.SyntaxError, "refer: unknown option %v", a[1])
+	})
+}
+
+// alias lets a loaded namespace qualify symbols in the current one by the
+// alias, (alias 'str 'wot.string)
+func alias(nss *namespaces) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		if err := assertArgNum(a, 2); err != nil {
+			return nil, err
+		}
+		name, ok := a[0].(types.Symbol)
+		if !ok {
+			return nil, argError("alias", 1, "a symbol", a[0])
+		}
+		ns, err := nss.asNamespace("alias", a, 2)
+		if err != nil {
+			return nil, err
+		}
+		nss.currentNs(types.ContextOf(e)).Alias(name, ns)
+		return nil, nil
+	})
+}
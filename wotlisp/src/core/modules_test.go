@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/env"
+	"github.com/tanema/mal/wotlisp/src/printer"
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// evalSource evaluates the forms of src one at a time in the current
+// namespace, the way a file is, so ns and in-ns apply to the forms after them.
+func evalSource(root *env.Namespace, src string) (types.Base, error) {
+	forms, err := reader.ReadFile("test.wot", src)
+	if err != nil {
+		return nil, err
+	}
+	ctx := BindNamespace(context.Background(), root)
+	var result types.Base
+	for _, form := range forms {
+		if result, err = runtime.Eval(ctx, CurrentNamespace(ctx, root), form); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// libTree creates a load path with namespaces to require, the returned
+// function removes it.
+func libTree(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "wotpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"lib/math_util.wot": `(ns lib.math-util) (def! square (fn* [x] (* x x))) (def! cube (fn* [x] (* x (square x)))) (swap! user/loads inc)`,
+		"lib/uses.wot":      `(ns lib.uses (:require [lib.math-util :as m :refer [square]])) (def! both (fn* [x] [(square x) (m/cube x)]))`,
+		"lib/cycle_a.wot":   `(ns lib.cycle-a (:require lib.cycle-b))`,
+		"lib/cycle_b.wot":   `(ns lib.cycle-b (:require lib.cycle-a))`,
+		"lib/nameless.wot":  `(def! x 1)`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestNamespaceBuiltins(t *testing.T) {
+	dir, cleanup := libTree(t)
+	defer cleanup()
+	cases := []printCase{
+		{`(ns foo) (def! x 1) (in-ns 'user) foo/x`, `1`},
+		{`(in-ns 'foo) (def! x 1) (in-ns 'user) (alias 'f 'foo) f/x`, `1`},
+		{`(ns foo) (def! x 1) (def! y 2) (in-ns 'user) (refer 'foo :only '[x]) [x (try* y (catch* e :unbound))]`, `[1 :unbound]`},
+		{`(ns foo) (def! x 1) (def! y 2) (in-ns 'user) (refer 'foo :exclude '[y]) [x (try* y (catch* e :unbound))]`, `[1 :unbound]`},
+		{`(ns foo) (def! x 1) (in-ns 'user) (refer 'foo) (in-ns 'foo) (def! x 2) (in-ns 'user) x`, `2`},
+		{`(ns foo) (def! inc dec) (in-ns 'user) [(foo/inc 1) (inc 1)]`, `[0 2]`},
+		{`(ns foo) *ns*`, `#namespace[foo]`},
+		{`(require 'lib.math-util) (lib.math-util/cube 2)`, `8`},
+		{`(require '[lib.math-util :as m]) (m/square 3)`, `9`},
+		{`(require '[lib.math-util :refer [cube]]) (cube 3)`, `27`},
+		{`(require '[lib.math-util :refer :all]) (+ (square 2) (cube 2))`, `12`},
+		{`(require 'lib.math-util 'lib.math-util) @loads`, `1`},
+		{`(require 'lib.math-util) (require 'lib.math-util :reload) @loads`, `2`},
+		{`(ns bar (:require [lib.uses :refer [both]])) (both 2)`, `[4 8]`},
+		{`(require 'lib.uses) (try* m/cube (catch* e :unbound))`, `:unbound`},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			root := NewNamespace(Options{Out: ioutil.Discard, LoadPath: []string{dir}})
+			if _, err := evalIn(root, `(def! loads (atom 0))`); err != nil {
+				t.Fatal(err)
+			}
+			val, err := evalSource(root, c.src)
+			if err != nil {
+				t.Fatal(err)
+			} else if printed := printer.Print(val, true); printed != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, printed)
+			}
+		})
+	}
+}
+
+// TestNamespaceBinding checks switching namespace while *ns* is bound only
+// lasts for the binding
+func TestNamespaceBinding(t *testing.T) {
+	root := NewNamespace(Options{Out: ioutil.Discard})
+	if _, err := evalSource(root, `(ns foo) (def! x 1)`); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if ns := CurrentNamespace(ctx, root); ns == nil || ns.Name != UserNamespace {
+		t.Fatalf("expected to still be in %v, got %v", UserNamespace, ns)
+	} else if _, err := evalSource(root, `x`); !errors.Is(err, types.UnboundSymbolError) {
+		t.Fatalf("expected x to be defined in foo only, got %v", err)
+	}
+}
+
+func TestNamespaceBuiltinErrors(t *testing.T) {
+	dir, cleanup := libTree(t)
+	defer cleanup()
+	cases := []struct {
+		src     string
+		errType types.ErrorType
+		opts    Options
+	}{
+		{`(in-ns "foo")`, types.TypeError, Options{}},
+		{`(refer 'missing)`, types.StateError, Options{}},
+		{`(refer 'user :only '[missing])`, types.UnboundSymbolError, Options{}},
+		{`(refer 'user :rename {})`, types.SyntaxError, Options{}},
+		{`(refer 'user :only)`, types.ArityError, Options{}},
+		{`(alias 'f 'missing)`, types.StateError, Options{}},
+		{`(alias "f" 'user)`, types.TypeError, Options{}},
+		{`(ns foo (:import bar))`, types.SyntaxError, Options{}},
+		{`(require 1)`, types.SyntaxError, Options{}},
+		{`(require '[lib.math-util :as])`, types.SyntaxError, Options{}},
+		{`(require '[lib.math-util :rename {}])`, types.SyntaxError, Options{}},
+		{`(require 'lib.missing)`, types.IOError, Options{}},
+		{`(require 'lib.cycle-a)`, types.StateError, Options{}},
+		{`(require 'lib.nameless)`, types.StateError, Options{}},
+		{`(require 'lib.math-util)`, types.IOError, Options{Capabilities: []Capability{IOWrite}}},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			c.opts.Out, c.opts.LoadPath = ioutil.Discard, []string{dir}
+			root := NewNamespace(c.opts)
+			if _, err := evalIn(root, `(def! loads (atom 0))`); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := evalSource(root, c.src); !errors.Is(err, c.errType) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			}
+		})
+	}
+}
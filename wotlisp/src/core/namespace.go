@@ -1,47 +1,170 @@
 package core
 
 import (
+	"context"
+	"io"
+	"os"
+	"sort"
+
 	"github.com/tanema/mal/wotlisp/src/env"
+	"github.com/tanema/mal/wotlisp/src/reader"
 	"github.com/tanema/mal/wotlisp/src/runtime"
 	"github.com/tanema/mal/wotlisp/src/types"
 )
 
-func DefaultNamespace() *env.Env {
-	defaultEnv, _ := env.New(nil, nil, nil)
-	for method, fn := range namespace {
-		defaultEnv.Set(method, fn)
-	}
-	defaultEnv.Set("eval", eval(defaultEnv))
-	defaultEnv.Set("*host-language*", "wot")
-	ev(defaultEnv, "(def! not (fn* (a) (if a false true)))")
-	ev(defaultEnv, `(def! load-file (fn* (f) (eval (read-string (str "(do " (slurp f) ")")))))`)
-	ev(defaultEnv, `(defmacro! cond (fn* (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw "odd number of forms to cond")) (cons 'cond (rest (rest xs)))))))`)
-	ev(defaultEnv, "(def! *gensym-counter* (atom 0))")
-	ev(defaultEnv, "(def! gensym (fn* [] (symbol (str \"G__\" (swap! *gensym-counter* (fn* [x] (+ 1 x)))))))")
-	ev(defaultEnv, "(defmacro! or (fn* (& xs) (if (empty? xs) nil (if (= 1 (count xs)) (first xs) (let* (condvar (gensym)) `(let* (~condvar ~(first xs)) (if ~condvar ~condvar (or ~@(rest xs)))))))))")
-	ev(defaultEnv, `(println (str "Mal [" *host-language* "]"))`)
-	return defaultEnv
-}
-
-func ev(e *env.Env, source string) {
-	ast, parseErr := readString(e, []types.Base{source})
-	if parseErr != nil {
-		panic(parseErr)
-	}
-	evalFn, err := e.Get("eval")
+// Options configures a new namespace. Out, Err and ReadLine replace stdout,
+// stderr and stdin as the roots of *out*, *err* and *in*. Include chooses
+// which builtins are installed by name and Capabilities which are installed by
+// what they can do, everything is installed when they are nil. Root limits the file
+// builtins to a directory and LoadPath is where require looks for namespaces,
+// the directories in WOTPATH by default.
+type Options struct {
+	Out          io.Writer
+	Err          io.Writer
+	ReadLine     func(prompt string) (string, error)
+	Include      func(name types.Symbol) bool
+	Capabilities []Capability
+	Root         string
+	LoadPath     []string
+}
+
+// prelude is the builtins that are defined in wot itself
+var prelude = []struct {
+	name   types.Symbol
+	source string
+}{
+	{"not", "(def! not (fn* (a) (if a false true)))"},
+	{"cond", `(defmacro! cond (fn* (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw "odd number of forms to cond")) (cons 'cond (rest (rest xs)))))))`},
+	{"gensym", "(def! gensym (fn* [] (symbol (str \"G__\" (swap! *gensym-counter* (fn* [x] (+ 1 x)))))))"},
+	{"or", "(defmacro! or (fn* (& xs) (if (empty? xs) nil (if (= 1 (count xs)) (first xs) (let* (condvar (gensym)) `(let* (~condvar ~(first xs)) (if ~condvar ~condvar (or ~@(rest xs)))))))))"},
+	{"future", "(defmacro! future (fn* (& body) `(future-call (fn* [] ~@body))))"},
+	{"go", "(defmacro! go (fn* (& body) `(go-call (fn* [] ~@body))))"},
+	{"dosync", "(defmacro! dosync (fn* (& body) `(dosync-call (fn* [] ~@body))))"},
+	{"ns", "(defmacro! ns (fn* (name & clauses) `(ns-call '~name '~clauses)))"},
+}
+
+func DefaultNamespace() *env.Namespace {
+	return NewNamespace(Options{})
+}
+
+// NewNamespace creates the user namespace with the builtins chosen by the
+// options in the core namespace it falls back to
+func NewNamespace(opts Options) *env.Namespace {
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	if opts.Err == nil {
+		opts.Err = os.Stderr
+	}
+	if opts.ReadLine == nil {
+		opts.ReadLine = LineReader(nil, opts.Out)
+	}
+	if opts.LoadPath == nil {
+		opts.LoadPath = defaultLoadPath()
+	}
+	include := opts.Include
+	allowed := capabilitySet(opts.Capabilities)
+	opts.Include = func(name types.Symbol) bool {
+		return allowed[BuiltinCapability(name)] && (include == nil || include(name))
+	}
+	registry := env.NewRegistry(CoreNamespace)
+	coreNs, userNs := registry.Core(), registry.FindOrCreate(UserNamespace)
+	nss := &namespaces{
+		registry: registry,
+		current:  types.NewVar("*ns*", userNs, true),
+		loadPath: opts.LoadPath,
+		root:     opts.Root,
+		canRead:  allowed[IORead],
+		loads:    map[types.Symbol]*nsLoad{},
+	}
+	coreNs.Set(nss.current.Name, nss.current)
+	vars := newIOVars(opts)
+	for _, v := range vars.all() {
+		if allowed[BuiltinCapability(v.Name)] {
+			coreNs.Set(v.Name, v)
+		}
+	}
+	for name, fn := range builtins(nss, opts, vars) {
+		if opts.Include(name) {
+			coreNs.Set(name, fn)
+		}
+	}
+	coreNs.Set("*host-language*", "wot")
+	coreNs.Set("*e", nil)
+	coreNs.Set("*gensym-counter*", types.NewAtom(int64(0)))
+	for _, def := range prelude {
+		if opts.Include(def.name) {
+			ev(coreNs, def.source)
+		}
+	}
+	return userNs
+}
+
+// Builtins returns the names of all the builtins a namespace can install
+func Builtins() []types.Symbol {
+	names := []types.Symbol{}
+	for name := range builtins(&namespaces{}, Options{}, ioVars{}) {
+		names = append(names, name)
+	}
+	for _, def := range prelude {
+		names = append(names, def.name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// builtins are the functions in the namespace map along with the ones that
+// need the namespaces, the options or the io vars.
+func builtins(nss *namespaces, opts Options, vars ioVars) map[types.Symbol]*types.StdFunc {
+	fns := map[types.Symbol]*types.StdFunc{
+		"eval":      eval(nss),
+		"load-file": loadFile(nss),
+		"in-ns":     inNs(nss),
+		"ns-call":   nsCall(nss),
+		"require":   requireLibs(nss),
+		"refer":     refer(nss),
+		"alias":     alias(nss),
+		"prn":       prn(vars),
+		"println":   prnln(vars),
+		"readline":  rdline(vars),
+		"slurp":     slurp(opts.Root),
+		"spit":      spit(opts.Root),
+		"getenv":    types.Func(getenv),
+	}
+	for name, fn := range namespace {
+		fns[name] = fn
+	}
+	return fns
+}
+
+func ev(e types.Env, source string) {
+	ast, err := reader.ReadString(source)
 	if err != nil {
 		panic(err)
 	}
-	if _, err := evalFn.(*types.StdFunc).Fn(e, []types.Base{ast}); err != nil {
+	if _, err := runtime.Eval(context.Background(), e, ast); err != nil {
 		panic(err)
 	}
 }
 
-func eval(defaultEnv types.Env) *types.StdFunc {
+// eval evaluates the form in the current namespace
+func eval(nss *namespaces) *types.StdFunc {
 	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
 		if len(a) < 1 {
 			return nil, nil
 		}
-		return runtime.Eval(defaultEnv, a[0])
+		ctx := types.ContextOf(e)
+		return runtime.Eval(ctx, nss.currentNs(ctx), a[0])
+	})
+}
+
+// loadFile evaluates every form in a file, returning the value of the last one.
+// The forms keep the file name in their positions so errors point into it.
+func loadFile(nss *namespaces) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		if err := assertArgNum(a, 1); err != nil {
+			return nil, err
+		}
+		return nss.evalFile(types.ContextOf(e), a[0])
 	})
 }
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func ref(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	return types.NewRef(a[0]), nil
+}
+
+func isref(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, is := a[0].(*types.Ref)
+	return is, nil
+}
+
+// dosyncCall calls the function with no arguments in a transaction, calling
+// it again if the transaction conflicts with another one. Lazy results are
+// realized before the transaction commits.
+func dosyncCall(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	return types.RunTransaction(types.ContextOf(e), func(ctx context.Context) (types.Base, error) {
+		val, err := types.CallFunc(types.WithContext(e, ctx), a[0], nil)
+		if err == nil {
+			err = types.Realize(val)
+		}
+		return val, err
+	})
+}
+
+// inTransaction returns the ref the builtin name was called with and the
+// transaction it was called in.
+func inTransaction(name string, e types.Env, a []types.Base) (*types.Ref, *types.Txn, error) {
+	ref, ok := a[0].(*types.Ref)
+	if !ok {
+		return nil, nil, argError(name, 1, "a ref", a[0])
+	}
+	txn := types.TransactionOf(types.ContextOf(e))
+	if txn == nil {
+		return nil, nil, types.Errorf(types.StateError, "%v: no transaction is running", name)
+	}
+	return ref, txn, nil
+}
+
+func alter(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 2 {
+		return nil, arityError("alter", a)
+	}
+	ref, txn, err := inTransaction("alter", e, a)
+	if err != nil {
+		return nil, err
+	}
+	return txn.Alter(e, ref, a[1], a[2:])
+}
+
+func commuteRef(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 2 {
+		return nil, arityError("commute", a)
+	}
+	ref, txn, err := inTransaction("commute", e, a)
+	if err != nil {
+		return nil, err
+	}
+	return txn.Commute(e, ref, a[1], a[2:])
+}
+
+func refSet(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	ref, txn, err := inTransaction("ref-set", e, a)
+	if err != nil {
+		return nil, err
+	}
+	return a[1], txn.Set(ref, a[1])
+}
+
+func ensure(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	ref, txn, err := inTransaction("ensure", e, a)
+	if err != nil {
+		return nil, err
+	}
+	return txn.Ensure(ref)
+}
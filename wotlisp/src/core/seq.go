@@ -0,0 +1,370 @@
+package core
+
+import (
+	"context"
+
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func mapvals(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 2 {
+		return nil, arityError("map", a)
+	}
+	return lazyMap(e, a[0], a[1:]), nil
+}
+
+// lazyMap calls fn with the first value of every collection, stopping when the
+// shortest collection runs out.
+func lazyMap(e types.Env, fn types.Base, cols []types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		args := make([]types.Base, len(cols))
+		rests := make([]types.Base, len(cols))
+		for i, col := range cols {
+			seq, err := types.ToSeq(col)
+			if err != nil || seq == nil {
+				return nil, err
+			}
+			args[i], rests[i] = seq.First(), seq.More()
+		}
+		val, err := types.CallFunc(e, fn, args)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewCons(val, lazyMap(e, fn, rests)), nil
+	})
+}
+
+func filter(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	return lazyFilter(e, a[0], a[1], true), nil
+}
+
+func remove(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	return lazyFilter(e, a[0], a[1], false), nil
+}
+
+// lazyFilter keeps the values where the truthiness of (pred val) matches keep.
+// Values that are skipped are walked in a loop so long runs of them do not
+// grow the stack.
+func lazyFilter(e types.Env, pred, col types.Base, keep bool) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		for {
+			seq, err := types.ToSeq(col)
+			if err != nil || seq == nil {
+				return nil, err
+			}
+			result, err := types.CallFunc(e, pred, []types.Base{seq.First()})
+			if err != nil {
+				return nil, err
+			} else if truthy(result) == keep {
+				return types.NewCons(seq.First(), lazyFilter(e, pred, seq.More(), keep)), nil
+			}
+			col = seq.More()
+		}
+	})
+}
+
+func take(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	n, ok := types.ToInt(a[0])
+	if !ok {
+		return nil, argError("take", 1, "an integer", a[0])
+	}
+	return lazyTake(n, a[1]), nil
+}
+
+func lazyTake(n int, col types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		if n <= 0 {
+			return nil, nil
+		}
+		seq, err := types.ToSeq(col)
+		if err != nil || seq == nil {
+			return nil, err
+		}
+		return types.NewCons(seq.First(), lazyTake(n-1, seq.More())), nil
+	})
+}
+
+func drop(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	n, ok := types.ToInt(a[0])
+	if !ok {
+		return nil, argError("drop", 1, "an integer", a[0])
+	}
+	return lazyDrop(n, a[1]), nil
+}
+
+func lazyDrop(n int, col types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		for i := 0; i < n; i++ {
+			seq, err := types.ToSeq(col)
+			if err != nil || seq == nil {
+				return nil, err
+			}
+			col = seq.More()
+		}
+		return col, nil
+	})
+}
+
+func takeWhile(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	return lazyTakeWhile(e, a[0], a[1]), nil
+}
+
+func lazyTakeWhile(e types.Env, pred, col types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		seq, err := types.ToSeq(col)
+		if err != nil || seq == nil {
+			return nil, err
+		}
+		result, err := types.CallFunc(e, pred, []types.Base{seq.First()})
+		if err != nil || !truthy(result) {
+			return nil, err
+		}
+		return types.NewCons(seq.First(), lazyTakeWhile(e, pred, seq.More())), nil
+	})
+}
+
+func iterate(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	return lazyIterate(e, 0, a[0], a[1]), nil
+}
+
+// lazyIterate is the nth value of (iterate fn x) followed by the rest
+func lazyIterate(e types.Env, n int, fn, val types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		if err := runtime.Allocate(types.ContextOf(e), n+1); err != nil {
+			return nil, err
+		}
+		return types.NewCons(val, types.NewLazySeq(func() (types.Base, error) {
+			next, err := types.CallFunc(e, fn, []types.Base{val})
+			if err != nil {
+				return nil, err
+			}
+			return lazyIterate(e, n+1, fn, next), nil
+		})), nil
+	})
+}
+
+// numRange returns (range), (range end), (range start end) or
+// (range start end step). Without an end the range is infinite.
+func numRange(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) > 3 {
+		return nil, arityError("range", a)
+	} else if err := assertNumbers("range", a); err != nil {
+		return nil, err
+	}
+	var start, end, step types.Base = int64(0), nil, int64(1)
+	switch len(a) {
+	case 1:
+		end = a[0]
+	case 2:
+		start, end = a[0], a[1]
+	case 3:
+		start, end, step = a[0], a[1], a[2]
+	}
+	return lazyRange(types.ContextOf(e), 0, start, end, step), nil
+}
+
+// lazyRange is the nth number of a range starting at start followed by the
+// rest. Every cell is checked against the limits of ctx since ranges can be
+// infinite.
+func lazyRange(ctx context.Context, n int, start, end, step types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		if err := runtime.Allocate(ctx, n+1); err != nil {
+			return nil, err
+		}
+		if end != nil {
+			cmp, err := types.NumCompare(start, end)
+			if err != nil {
+				return nil, err
+			} else if sign := types.Sign(step); (sign > 0 && cmp >= 0) || (sign < 0 && cmp <= 0) || (sign == 0 && cmp == 0) {
+				return nil, nil
+			}
+		}
+		next, err := types.Add(start, step)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewCons(start, lazyRange(ctx, n+1, next, end, step)), nil
+	})
+}
+
+func repeat(e types.Env, a []types.Base) (types.Base, error) {
+	switch len(a) {
+	case 1:
+		return lazyRepeat(types.ContextOf(e), 0, a[0]), nil
+	case 2:
+		n, ok := types.ToInt(a[0])
+		if !ok {
+			return nil, argError("repeat", 1, "an integer", a[0])
+		}
+		return lazyTake(n, lazyRepeat(types.ContextOf(e), 0, a[1])), nil
+	default:
+		return nil, arityError("repeat", a)
+	}
+}
+
+// lazyRepeat makes a new cell for every repetition, rather than one cell whose
+// rest is itself, so walking it can be stopped by the limits of ctx.
+func lazyRepeat(ctx context.Context, n int, val types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		if err := runtime.Allocate(ctx, n+1); err != nil {
+			return nil, err
+		}
+		return types.NewCons(val, lazyRepeat(ctx, n+1, val)), nil
+	})
+}
+
+func cycle(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	return lazyCycle(types.ContextOf(e), a[0]), nil
+}
+
+// lazyCycle walks the collection and when it reaches the end it walks it again
+// from the start. Like lazyRepeat every cell is new so the limits of ctx are
+// checked for each one.
+func lazyCycle(ctx context.Context, col types.Base) *types.LazySeq {
+	var walk func(rest types.Base, n int) *types.LazySeq
+	walk = func(rest types.Base, n int) *types.LazySeq {
+		return types.NewLazySeq(func() (types.Base, error) {
+			seq, err := types.ToSeq(rest)
+			if err != nil {
+				return nil, err
+			} else if seq == nil && n > 0 {
+				if seq, err = types.ToSeq(col); err != nil {
+					return nil, err
+				}
+			}
+			if seq == nil {
+				return nil, nil
+			} else if err := runtime.Allocate(ctx, n+1); err != nil {
+				return nil, err
+			}
+			return types.NewCons(seq.First(), walk(seq.More(), n+1)), nil
+		})
+	}
+	return walk(col, 0)
+}
+
+func concat(e types.Env, a []types.Base) (types.Base, error) {
+	return lazyConcat(a), nil
+}
+
+func lazyConcat(cols []types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		for i, col := range cols {
+			seq, err := types.ToSeq(col)
+			if err != nil {
+				return nil, err
+			} else if seq != nil {
+				rest := append([]types.Base{seq.More()}, cols[i+1:]...)
+				return types.NewCons(seq.First(), lazyConcat(rest)), nil
+			}
+		}
+		return nil, nil
+	})
+}
+
+func interleave(e types.Env, a []types.Base) (types.Base, error) {
+	return lazyInterleave(a), nil
+}
+
+func lazyInterleave(cols []types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		if len(cols) == 0 {
+			return nil, nil
+		}
+		firsts := make([]types.Base, len(cols))
+		rests := make([]types.Base, len(cols))
+		for i, col := range cols {
+			seq, err := types.ToSeq(col)
+			if err != nil || seq == nil {
+				return nil, err
+			}
+			firsts[i], rests[i] = seq.First(), seq.More()
+		}
+		var result types.Base = lazyInterleave(rests)
+		for i := len(firsts) - 1; i >= 0; i-- {
+			result = types.NewCons(firsts[i], result)
+		}
+		return result, nil
+	})
+}
+
+func next(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	seq, err := types.ToSeq(a[0])
+	if err != nil || seq == nil {
+		return nil, err
+	}
+	return toSeq(seq.More())
+}
+
+func isseq(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, isList := a[0].(*types.List)
+	return isList || types.IsSeq(a[0]), nil
+}
+
+func isrealized(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	switch ref := a[0].(type) {
+	case *types.LazySeq:
+		return ref.Realized(), nil
+	case types.Awaitable:
+		return ref.Done(), nil
+	}
+	return nil, argError("realized?", 1, "a lazy seq, future or promise", a[0])
+}
+
+func doall(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, err := types.SeqData(a[0])
+	return a[0], err
+}
+
+func dorun(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	seq, err := types.ToSeq(a[0])
+	for ; seq != nil && err == nil; seq, err = types.ToSeq(seq.More()) {
+	}
+	return nil, err
+}
+
+// toSeq is ToSeq for returning to wot code where an empty seq is nil
+func toSeq(val types.Base) (types.Base, error) {
+	seq, err := types.ToSeq(val)
+	if err != nil || seq == nil {
+		return nil, err
+	}
+	return seq, nil
+}
@@ -0,0 +1,58 @@
+package core
+
+import "testing"
+
+func TestRestAndSeq(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(rest [1 2 3])`, `(2 3)`},
+		{`(rest (rest [1 2 3]))`, `(3)`},
+		{`(rest [1])`, `()`},
+		{`(rest [])`, `()`},
+		{`(rest nil)`, `()`},
+		{`(rest '(1 2))`, `(2)`},
+		{`(= (rest [1 2 3]) '(2 3))`, `true`},
+		{`(nth (rest [1 2 3]) 1)`, `3`},
+		{`(conj (rest [1 2 3]) 0)`, `(0 2 3)`},
+		{`(seq [])`, `nil`},
+		{`(seq [1 2])`, `(1 2)`},
+		{`(first (rest (seq [1 2])))`, `2`},
+		{`(loop* [v (apply vector (range 1000)) n 0] (if (empty? v) n (recur (rest v) (+ n (first v)))))`, `499500`},
+	})
+}
+
+func TestInfiniteSeqs(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(take 3 (iterate inc 0))`, `(0 1 2)`},
+		{`(take 5 (cycle [1 2]))`, `(1 2 1 2 1)`},
+		{`(take 3 (range))`, `(0 1 2)`},
+		{`(take 2 (repeat :x))`, `(:x :x)`},
+		{`(take 3 (drop 5 (range)))`, `(5 6 7)`},
+		{`(take 3 (filter (fn* [x] (= 0 (mod x 3))) (map inc (range))))`, `(3 6 9)`},
+		{`(take 4 (interleave (range) (repeat :x)))`, `(0 :x 1 :x)`},
+		{`(take-while (fn* [x] (< x 3)) (iterate inc 0))`, `(0 1 2)`},
+		{`(first (concat (range) [:never]))`, `0`},
+		{`(nth (iterate inc 0) 100000)`, `100000`},
+		{`(do (def! nat (fn* [n] (lazy-seq (cons n (nat (+ n 1)))))) (take 3 (nat 5)))`, `(5 6 7)`},
+	})
+}
+
+func TestLazySeqsAreCached(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(let* [n (atom 0) s (map (fn* [x] (swap! n inc)) [1 2 3])] (do (doall s) (doall s) @n))`, `3`},
+		{`(let* [n (atom 0) s (map (fn* [x] (swap! n inc)) [1 2 3])] (do (first s) @n))`, `1`},
+		{`(let* [s (map inc [1 2])] (realized? s))`, `false`},
+		{`(let* [s (map inc [1 2])] (do (first s) (realized? s)))`, `true`},
+		{`(let* [s (map inc [1 2])] (do (dorun s) (count s)))`, `2`},
+	})
+}
+
+// TestDeepLazySeqs checks long and deeply layered lazy seqs are realized
+// without running out of stack.
+func TestDeepLazySeqs(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{`(count (take 100000 (iterate inc 0)))`, `100000`},
+		{`(do (def! nat (fn* [n] (lazy-seq (cons n (nat (+ n 1)))))) (count (take 10000 (nat 0))))`, `10000`},
+		{`(first (loop* [s (range 3) i 0] (if (< i 10000) (recur (map inc s) (+ i 1)) s)))`, `10000`},
+		{`(count (loop* [s (range 3) i 0] (if (< i 10000) (recur (concat s []) (+ i 1)) s)))`, `3`},
+	})
+}
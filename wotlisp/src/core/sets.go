@@ -0,0 +1,179 @@
+package core
+
+import "github.com/tanema/mal/wotlisp/src/types"
+
+func makeset(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	switch col := a[0].(type) {
+	case nil:
+		return types.NewSet(), nil
+	case *types.Set:
+		return col, nil
+	case set:
+		return types.NewSet(col.Data()...), nil
+	case types.Map:
+		return types.NewSet(mapEntries(col)...), nil
+	case types.Collection:
+		return types.NewSet(col.Data()...), nil
+	case types.Seq, *types.LazySeq:
+		items, err := types.SeqData(col)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewSet(items...), nil
+	case string:
+		items := []types.Base{}
+		for _, ch := range col {
+			items = append(items, string(ch))
+		}
+		return types.NewSet(items...), nil
+	default:
+		return nil, types.Errorf(types.TypeError, "cannot create set from %v", types.TypeName(a[0]))
+	}
+}
+
+func hashset(e types.Env, a []types.Base) (types.Base, error) {
+	return types.NewSet(a...), nil
+}
+
+// set is the read only view shared by hash sets and sorted sets
+type set interface {
+	Count() int
+	Get(types.Base) (types.Base, bool)
+	Contains(types.Base) bool
+	Data() []types.Base
+}
+
+func conjSet(col set, vals ...types.Base) (set, error) {
+	switch tcol := col.(type) {
+	case *types.SortedSet:
+		return tcol.Conj(vals...)
+	default:
+		return tcol.(*types.Set).Conj(vals...), nil
+	}
+}
+
+func disjSet(col set, vals ...types.Base) (set, error) {
+	switch tcol := col.(type) {
+	case *types.SortedSet:
+		return tcol.Disj(vals...)
+	default:
+		return tcol.(*types.Set).Disj(vals...), nil
+	}
+}
+
+func isset(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	_, isSet := a[0].(set)
+	return isSet, nil
+}
+
+func disj(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 1 {
+		return nil, types.Errorf(types.ArityError, "wrong number of arguments")
+	}
+	switch col := a[0].(type) {
+	case nil:
+		return nil, nil
+	case set:
+		return disjSet(col, a[1:]...)
+	default:
+		return nil, types.Errorf(types.TypeError, "cannot disj with non-set")
+	}
+}
+
+func setArgs(name string, a []types.Base) ([]set, error) {
+	sets := make([]set, len(a))
+	for i, arg := range a {
+		col, ok := arg.(set)
+		if !ok {
+			return nil, argError(name, i+1, "a set", arg)
+		}
+		sets[i] = col
+	}
+	return sets, nil
+}
+
+func union(e types.Env, a []types.Base) (types.Base, error) {
+	sets, err := setArgs("union", a)
+	if err != nil {
+		return nil, err
+	} else if len(sets) == 0 {
+		return types.NewSet(), nil
+	}
+	result := sets[0]
+	for _, col := range sets[1:] {
+		if result, err = conjSet(result, col.Data()...); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func intersection(e types.Env, a []types.Base) (types.Base, error) {
+	sets, err := setArgs("intersection", a)
+	if err != nil {
+		return nil, err
+	} else if len(sets) == 0 {
+		return nil, types.Errorf(types.ArityError, "wrong number of arguments")
+	}
+	result := sets[0]
+	for _, col := range sets[1:] {
+		for _, item := range result.Data() {
+			if col.Contains(item) {
+				continue
+			}
+			if result, err = disjSet(result, item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func difference(e types.Env, a []types.Base) (types.Base, error) {
+	sets, err := setArgs("difference", a)
+	if err != nil {
+		return nil, err
+	} else if len(sets) == 0 {
+		return nil, types.Errorf(types.ArityError, "wrong number of arguments")
+	}
+	result := sets[0]
+	for _, col := range sets[1:] {
+		if result, err = disjSet(result, col.Data()...); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func subset(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	sets, err := setArgs("subset?", a)
+	if err != nil {
+		return nil, err
+	} else if sets[0].Count() > sets[1].Count() {
+		return false, nil
+	}
+	for _, item := range sets[0].Data() {
+		if !sets[1].Contains(item) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func mapEntries(hmap types.Map) []types.Base {
+	entries := make([]types.Base, 0, hmap.Count())
+	hmap.Range(func(key, val types.Base) bool {
+		entries = append(entries, types.NewVect(key, val))
+		return true
+	})
+	return entries
+}
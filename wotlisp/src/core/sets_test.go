@@ -0,0 +1,89 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// evalEquals runs the cases in order, each in a fresh namespace, comparing the
+// results by value so sets do not depend on the order they print in.
+func evalEquals(t *testing.T, cases []printCase) {
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			expected, err := reader.ReadString(c.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			val, err := evalIn(NewNamespace(Options{Out: ioutil.Discard}), c.src)
+			if err != nil {
+				t.Fatal(err)
+			} else if !types.Equal(val, expected) {
+				t.Fatalf("expected %v, got %v", c.expected, val)
+			}
+		})
+	}
+}
+
+func TestMakeSet(t *testing.T) {
+	evalEquals(t, []printCase{
+		{`(set nil)`, `#{}`},
+		{`(set [1 2 2])`, `#{1 2}`},
+		{`(set '(1 2))`, `#{1 2}`},
+		{`(set "ab")`, `#{"a" "b"}`},
+		{`(set {:a 1})`, `#{[:a 1]}`},
+		{`(set (sorted-set 3 1))`, `#{1 3}`},
+		{`(set (range 3))`, `#{0 1 2}`},
+		{`(set (map inc [1 2]))`, `#{2 3}`},
+		{`(set (rest [1 2 3]))`, `#{2 3}`},
+	})
+}
+
+func TestSetBuiltins(t *testing.T) {
+	evalEquals(t, []printCase{
+		{`#{(+ 1 1) 3}`, `#{2 3}`},
+		{`#{[1 2] '(1 2)}`, `#{[1 2]}`},
+		{`(hash-set 1 2 1)`, `#{1 2}`},
+		{`(set? #{})`, `true`},
+		{`(set? (sorted-set))`, `true`},
+		{`(set? [])`, `false`},
+		{`(conj #{1} 2 1)`, `#{1 2}`},
+		{`(disj #{1 2 3} 1 3)`, `#{2}`},
+		{`(disj nil 1)`, `nil`},
+		{`(contains? #{[1 2]} '(1 2))`, `true`},
+		{`(get #{:a} :a)`, `:a`},
+		{`(count #{1 2 2})`, `2`},
+		{`(union)`, `#{}`},
+		{`(union #{1} #{2} #{1 3})`, `#{1 2 3}`},
+		{`(intersection #{1 2 3} #{2 3 4} #{3 2})`, `#{2 3}`},
+		{`(difference #{1 2 3} #{2} #{3})`, `#{1}`},
+		{`(subset? #{1} #{1 2})`, `true`},
+		{`(subset? #{1 3} #{1 2})`, `false`},
+		{`(= #{1 2} (sorted-set 2 1))`, `true`},
+		{`(get {#{1 2} :found} #{2 1})`, `:found`},
+	})
+}
+
+func TestSetBuiltinErrors(t *testing.T) {
+	cases := []struct {
+		src     string
+		errType types.ErrorType
+	}{
+		{`(set 1)`, types.TypeError},
+		{`(set)`, types.ArityError},
+		{`(disj [1] 1)`, types.TypeError},
+		{`(union #{1} [2])`, types.TypeError},
+		{`(intersection)`, types.ArityError},
+		{`(subset? #{1})`, types.ArityError},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			if _, err := evalIn(NewNamespace(Options{Out: ioutil.Discard}), c.src); !errors.Is(err, c.errType) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package core
+
+import "github.com/tanema/mal/wotlisp/src/types"
+
+func sortedmap(e types.Env, a []types.Base) (types.Base, error) {
+	return types.NewSortedMap(nil, a...)
+}
+
+func sortedmapby(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 1 {
+		return nil, arityError("sorted-map-by", a)
+	}
+	return types.NewSortedMap(fnComparator(e, a[0]), a[1:]...)
+}
+
+func sortedset(e types.Env, a []types.Base) (types.Base, error) {
+	return types.NewSortedSet(nil, a...)
+}
+
+func sortedsetby(e types.Env, a []types.Base) (types.Base, error) {
+	if len(a) < 1 {
+		return nil, arityError("sorted-set-by", a)
+	}
+	return types.NewSortedSet(fnComparator(e, a[0]), a[1:]...)
+}
+
+func issorted(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 1); err != nil {
+		return nil, err
+	}
+	switch a[0].(type) {
+	case *types.SortedMap, *types.SortedSet:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func compare(e types.Env, a []types.Base) (types.Base, error) {
+	if err := assertArgNum(a, 2); err != nil {
+		return nil, err
+	}
+	cmp, err := types.Compare(a[0], a[1])
+	return int64(cmp), err
+}
+
+// fnComparator turns a user function into a comparator. The function may
+// either return a number like compare or be a predicate like < in which case
+// it is called in both directions to find equal values.
+func fnComparator(e types.Env, fn types.Base) types.Comparator {
+	return func(a, b types.Base) (int, error) {
+		result, err := types.CallFunc(e, fn, []types.Base{a, b})
+		if err != nil {
+			return 0, err
+		} else if types.IsNumber(result) {
+			return types.Sign(result), nil
+		} else if truthy(result) {
+			return -1, nil
+		}
+		result, err = types.CallFunc(e, fn, []types.Base{b, a})
+		if err != nil {
+			return 0, err
+		} else if truthy(result) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+}
+
+func truthy(val types.Base) bool {
+	return val != nil && val != false
+}
+
+// sorted is the view shared by sorted maps and sorted sets used by range queries
+type sorted interface {
+	Comparator() types.Comparator
+}
+
+// subseq returns the entries of a sorted collection that pass the tests, in
+// order. It is called as (subseq col test key) or
+// (subseq col start-test start-key end-test end-key)
+func subseq(e types.Env, a []types.Base) (types.Base, error) {
+	return rangeQuery(e, "subseq", true, a)
+}
+
+// rsubseq is the same as subseq but returns entries in reverse order
+func rsubseq(e types.Env, a []types.Base) (types.Base, error) {
+	return rangeQuery(e, "rsubseq", false, a)
+}
+
+func rangeQuery(e types.Env, name string, ascending bool, a []types.Base) (types.Base, error) {
+	if len(a) != 3 && len(a) != 5 {
+		return nil, arityError(name, a)
+	}
+	col, ok := a[0].(sorted)
+	if !ok {
+		return nil, argError(name, 1, "a sorted collection", a[0])
+	}
+	bounds := []rangeBound{{test: a[1], key: a[2]}}
+	if len(a) == 5 {
+		bounds = append(bounds, rangeBound{test: a[3], key: a[4]})
+	}
+
+	// the bound that points away from the direction of the walk is where the
+	// walk starts and the other bound is where it stops.
+	var start, end *rangeBound
+	for i := range bounds {
+		lower, err := bounds[i].isLower(e)
+		if err != nil {
+			return nil, err
+		} else if lower == ascending {
+			start = &bounds[i]
+		} else {
+			end = &bounds[i]
+		}
+	}
+	if len(bounds) == 2 && (start == nil || end == nil) {
+		return nil, types.Errorf(types.SyntaxError, "%v: expected one lower and one upper bound", name)
+	}
+
+	from := []types.Base{}
+	if start != nil {
+		from = append(from, start.key)
+	}
+	results := []types.Base{}
+	var walkErr error
+	visit := func(key, entry types.Base) bool {
+		if start != nil {
+			pass, err := start.check(e, col.Comparator(), key)
+			if err != nil {
+				walkErr = err
+				return false
+			} else if !pass {
+				return true
+			}
+		}
+		if end != nil {
+			pass, err := end.check(e, col.Comparator(), key)
+			if err != nil || !pass {
+				walkErr = err
+				return false
+			}
+		}
+		results = append(results, entry)
+		return true
+	}
+
+	var err error
+	switch tcol := col.(type) {
+	case *types.SortedMap:
+		err = tcol.Seek(ascending, from, func(key, val types.Base) bool {
+			return visit(key, types.NewVect(key, val))
+		})
+	case *types.SortedSet:
+		err = tcol.Seek(ascending, from, func(val types.Base) bool {
+			return visit(val, val)
+		})
+	default:
+		return nil, types.Errorf(types.TypeError, "unknown sorted collection")
+	}
+	if err != nil {
+		return nil, err
+	} else if walkErr != nil {
+		return nil, walkErr
+	} else if len(results) == 0 {
+		return nil, nil
+	}
+	return types.NewList(results...), nil
+}
+
+type rangeBound struct {
+	test, key types.Base
+}
+
+// check calls the test with the comparison of the entry key to the bound key
+// and zero, the same as (test (compare key bound) 0)
+func (bound rangeBound) check(e types.Env, cmp types.Comparator, key types.Base) (bool, error) {
+	c, err := cmp(key, bound.key)
+	if err != nil {
+		return false, err
+	}
+	result, err := types.CallFunc(e, bound.test, []types.Base{int64(c), int64(0)})
+	return truthy(result), err
+}
+
+// isLower reports if the bound is a lower bound like > or >= by probing the
+// test with a key that sorts after the bound.
+func (bound rangeBound) isLower(e types.Env) (bool, error) {
+	result, err := types.CallFunc(e, bound.test, []types.Base{int64(1), int64(0)})
+	return truthy(result), err
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func TestSubseq(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{`(subseq (sorted-set 1 2 3 4 5) > 2)`, `(3 4 5)`},
+		{`(subseq (sorted-set 1 2 3 4 5) >= 2)`, `(2 3 4 5)`},
+		{`(subseq (sorted-set 1 2 3 4 5) < 3)`, `(1 2)`},
+		{`(subseq (sorted-set 1 2 3 4 5) >= 2 < 4)`, `(2 3)`},
+		{`(subseq (sorted-set 1 2 3 4 5) < 4 >= 2)`, `(2 3)`},
+		{`(subseq (sorted-set 1 2 3 4 5) > 5)`, `nil`},
+		{`(rsubseq (sorted-set 1 2 3 4 5) < 4)`, `(3 2 1)`},
+		{`(rsubseq (sorted-set 1 2 3 4 5) > 1 <= 4)`, `(4 3 2)`},
+		{`(subseq (sorted-map :a 1 :b 2 :c 3) >= :b)`, `([:b 2] [:c 3])`},
+		{`(subseq (sorted-set-by > 1 2 3 4 5) > 3)`, `(2 1)`},
+		{`(subseq (sorted-set-by > 1 2 3 4 5) >= 4 < 2)`, `(4 3)`},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			ns := NewNamespace(Options{Out: ioutil.Discard})
+			expected, err := reader.ReadString(c.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			val, err := evalIn(ns, c.src)
+			if err != nil {
+				t.Fatal(err)
+			} else if !types.Equal(val, expected) {
+				t.Fatalf("expected %v, got %v", c.expected, val)
+			}
+		})
+	}
+}
+
+func TestSubseqErrors(t *testing.T) {
+	cases := []struct {
+		src     string
+		errType types.ErrorType
+	}{
+		{`(subseq (sorted-set 1 2) >)`, types.ArityError},
+		{`(subseq [1 2] > 1)`, types.TypeError},
+		{`(subseq (sorted-set 1 2) > 1 > 2)`, types.SyntaxError},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			ns := NewNamespace(Options{Out: ioutil.Discard})
+			if _, err := evalIn(ns, c.src); !errors.Is(err, c.errType) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			}
+		})
+	}
+}
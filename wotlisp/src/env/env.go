@@ -1,43 +1,33 @@
 package env
 
 import (
-	"fmt"
+	"sync"
 
 	"github.com/tanema/mal/wotlisp/src/types"
 )
 
-// Env captures all definitions and their values
+// Env captures all definitions and their values. It can be used by more than
+// one goroutine, definitions are guarded by a lock.
 type Env struct {
+	mu    sync.RWMutex
 	data  map[string]types.Base
 	outer types.Env
 }
 
-// New creates a new env, binds and exprs allow for parameter binding
-func New(outer types.Env, binds, exprs []types.Base) (*Env, error) {
-	env := &Env{data: map[string]types.Base{}, outer: outer}
-	for i, bind := range binds {
-		key, ok := bind.(types.Symbol)
-		if !ok {
-			return nil, fmt.Errorf("non-symbol bind value")
-		}
-		if key == "&" {
-			env.Set(binds[i+1].(types.Symbol), types.NewList(exprs[i:]...))
-			break
-		}
-		env.Set(key, exprs[i])
-	}
-	return env, nil
+// New creates a new empty env that falls back to outer, which can be nil
+func New(outer types.Env) *Env {
+	return &Env{data: map[string]types.Base{}, outer: outer}
 }
 
 // Child creates a new Env that inherits this one. By adding this method we can
 // pass around env without importing env
-func (e *Env) Child(binds, exprs []types.Base) (types.Env, error) {
-	return New(e, binds, exprs)
+func (e *Env) Child() types.Env {
+	return New(e)
 }
 
 // Find will find the env with the definition available. It will return nil otherwise
 func (e *Env) Find(key types.Symbol) types.Env {
-	if _, ok := e.data[string(key)]; ok {
+	if _, ok := e.lookup(key); ok {
 		return e
 	} else if e.outer != nil {
 		return e.outer.Find(key)
@@ -47,14 +37,25 @@ func (e *Env) Find(key types.Symbol) types.Env {
 
 // Set will set the definition of a symbol on the current env
 func (e *Env) Set(key types.Symbol, value types.Base) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.data[string(key)] = value
 }
 
 // Get will retreive the value of a symbol recursively up the parentage of this env
 func (e *Env) Get(key types.Symbol) (types.Base, error) {
-	env := e.Find(key)
-	if env == nil {
-		return nil, fmt.Errorf("'%v' not found", key)
+	if val, ok := e.lookup(key); ok {
+		return val, nil
+	} else if e.outer != nil {
+		return e.outer.Get(key)
 	}
-	return env.(*Env).data[string(key)], nil
+	return nil, types.Errorf(types.UnboundSymbolError, "'%v' not found", key).With(types.Keyword("symbol"), key)
+}
+
+// lookup returns the definition of a symbol in this env only
+func (e *Env) lookup(key types.Symbol) (types.Base, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	val, ok := e.data[string(key)]
+	return val, ok
 }
@@ -0,0 +1,34 @@
+package env
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func TestEnvConcurrentDefinitions(t *testing.T) {
+	root := New(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := root.Child()
+			child.Set("x", int64(i))
+			for j := 0; j < 500; j++ {
+				name := types.Symbol(fmt.Sprintf("def-%v-%v", i, j))
+				root.Set(name, int64(j))
+				if val, err := child.Get(name); err != nil || val != int64(j) {
+					t.Errorf("expected %v to be %v through the child, got %v %v", name, j, val, err)
+					return
+				} else if val, err := child.Get("x"); err != nil || val != int64(i) {
+					t.Errorf("expected x to be %v, got %v %v", i, val, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,196 @@
+package env
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// Namespace is a named root env. A symbol is looked up in the definitions of
+// the namespace, then in the names it refers from other namespaces and then
+// in the core namespace. A qualified symbol like str/join is looked up in the
+// definitions of the namespace with that alias or name.
+type Namespace struct {
+	Name     types.Symbol
+	defs     *Env
+	core     *Namespace
+	registry *Registry
+	mu       sync.RWMutex
+	aliases  map[types.Symbol]*Namespace
+	refers   map[types.Symbol]referral
+}
+
+// referral is a name referred from another namespace
+type referral struct {
+	ns   *Namespace
+	name types.Symbol
+}
+
+// Registry holds the namespaces of an interpreter by name
+type Registry struct {
+	mu         sync.RWMutex
+	namespaces map[types.Symbol]*Namespace
+	core       *Namespace
+}
+
+// NewRegistry creates a registry with the core namespace, whose definitions
+// are the builtins every other namespace can use.
+func NewRegistry(coreName types.Symbol) *Registry {
+	registry := &Registry{namespaces: map[types.Symbol]*Namespace{}}
+	registry.core = registry.newNamespace(coreName, nil)
+	registry.namespaces[coreName] = registry.core
+	return registry
+}
+
+func (registry *Registry) newNamespace(name types.Symbol, core *Namespace) *Namespace {
+	return &Namespace{
+		Name:     name,
+		defs:     New(nil),
+		core:     core,
+		registry: registry,
+		aliases:  map[types.Symbol]*Namespace{},
+		refers:   map[types.Symbol]referral{},
+	}
+}
+
+// Core is the namespace of the builtins
+func (registry *Registry) Core() *Namespace {
+	return registry.core
+}
+
+// Find returns the namespace with the name or nil if there is none
+func (registry *Registry) Find(name types.Symbol) *Namespace {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.namespaces[name]
+}
+
+// FindOrCreate returns the namespace with the name, creating it if there is
+// none
+func (registry *Registry) FindOrCreate(name types.Symbol) *Namespace {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	ns, ok := registry.namespaces[name]
+	if !ok {
+		ns = registry.newNamespace(name, registry.core)
+		registry.namespaces[name] = ns
+	}
+	return ns
+}
+
+func (ns *Namespace) String() string {
+	return "#namespace[" + string(ns.Name) + "]"
+}
+
+// Child creates an env whose outer env is the namespace
+func (ns *Namespace) Child() types.Env {
+	return New(ns)
+}
+
+// Find returns the namespace the symbol is defined in, nil if it is not
+// defined
+func (ns *Namespace) Find(key types.Symbol) types.Env {
+	if owner, name := ns.owner(key); owner != nil {
+		if _, ok := owner.Lookup(name); ok {
+			return owner
+		}
+	}
+	if ns.core != nil {
+		return ns.core.Find(key)
+	}
+	return nil
+}
+
+// Set defines the symbol in the namespace
+func (ns *Namespace) Set(key types.Symbol, value types.Base) {
+	ns.defs.Set(key, value)
+}
+
+// Get looks up the symbol in the namespace, its referrals, the namespace it is
+// qualified with and then the core namespace.
+func (ns *Namespace) Get(key types.Symbol) (types.Base, error) {
+	if val, ok := ns.resolve(key); ok {
+		return val, nil
+	} else if ns.core != nil {
+		return ns.core.Get(key)
+	}
+	return nil, types.Errorf(types.UnboundSymbolError, "'%v' not found", key).With(types.Keyword("symbol"), key)
+}
+
+// Lookup returns the definition of the symbol in this namespace only
+func (ns *Namespace) Lookup(key types.Symbol) (types.Base, bool) {
+	return ns.defs.lookup(key)
+}
+
+// Names returns the symbols defined in this namespace
+func (ns *Namespace) Names() []types.Symbol {
+	ns.defs.mu.RLock()
+	defer ns.defs.mu.RUnlock()
+	names := make([]types.Symbol, 0, len(ns.defs.data))
+	for name := range ns.defs.data {
+		names = append(names, types.Symbol(name))
+	}
+	return names
+}
+
+// Alias lets the other namespace be used to qualify symbols by the alias
+func (ns *Namespace) Alias(alias types.Symbol, other *Namespace) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.aliases[alias] = other
+}
+
+// Refer makes the name defined in the other namespace available in this one.
+// The name is looked up in the other namespace every time so redefining it
+// there is seen here.
+func (ns *Namespace) Refer(other *Namespace, name types.Symbol) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.refers[name] = referral{ns: other, name: name}
+}
+
+// resolve looks up the symbol without falling back to the core namespace
+func (ns *Namespace) resolve(key types.Symbol) (types.Base, bool) {
+	if owner, name := ns.owner(key); owner != nil {
+		return owner.Lookup(name)
+	}
+	return nil, false
+}
+
+// owner is the namespace that should define the symbol and its name there.
+// That is this namespace unless the symbol is referred or qualified.
+func (ns *Namespace) owner(key types.Symbol) (*Namespace, types.Symbol) {
+	if _, ok := ns.defs.lookup(key); ok {
+		return ns, key
+	}
+	ns.mu.RLock()
+	ref, referred := ns.refers[key]
+	ns.mu.RUnlock()
+	if referred {
+		return ref.ns, ref.name
+	} else if qualifier, name, ok := splitQualified(key); ok {
+		return ns.qualified(qualifier), name
+	}
+	return ns, key
+}
+
+// qualified returns the namespace a qualifier names, by alias or by name
+func (ns *Namespace) qualified(qualifier types.Symbol) *Namespace {
+	ns.mu.RLock()
+	other, ok := ns.aliases[qualifier]
+	ns.mu.RUnlock()
+	if ok {
+		return other
+	}
+	return ns.registry.Find(qualifier)
+}
+
+// splitQualified splits ns/name into its parts, / on its own is a name
+func splitQualified(key types.Symbol) (types.Symbol, types.Symbol, bool) {
+	i := strings.Index(string(key), "/")
+	if i <= 0 || i == len(key)-1 {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
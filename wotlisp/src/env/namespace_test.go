@@ -0,0 +1,132 @@
+package env
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry("core")
+	if registry.Find("core") != registry.Core() {
+		t.Fatal("expected the core namespace to be registered by name")
+	} else if registry.Find("lib") != nil {
+		t.Fatal("expected no namespace before it is created")
+	}
+	lib := registry.FindOrCreate("lib")
+	if lib.Name != "lib" || registry.FindOrCreate("lib") != lib || registry.Find("lib") != lib {
+		t.Fatal("expected the namespace to be created once")
+	}
+}
+
+func TestRegistryConcurrentCreate(t *testing.T) {
+	registry := NewRegistry("core")
+	found := make([]*Namespace, 8)
+	var wg sync.WaitGroup
+	for i := range found {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			found[i] = registry.FindOrCreate("lib")
+		}(i)
+	}
+	wg.Wait()
+	for _, ns := range found {
+		if ns != found[0] {
+			t.Fatal("expected every goroutine to get the same namespace")
+		}
+	}
+}
+
+func TestNamespaceLookup(t *testing.T) {
+	registry := NewRegistry("core")
+	registry.Core().Set("inc", int64(1))
+	registry.Core().Set("dec", int64(2))
+	user, lib := registry.FindOrCreate("user"), registry.FindOrCreate("lib")
+	user.Set("dec", int64(3))
+	lib.Set("x", int64(4))
+
+	cases := []struct {
+		key      types.Symbol
+		expected types.Base
+		owner    types.Env
+	}{
+		{"inc", int64(1), registry.Core()},
+		{"dec", int64(3), user},
+		{"lib/x", int64(4), lib},
+		{"core/inc", int64(1), registry.Core()},
+	}
+	for _, c := range cases {
+		if val, err := user.Get(c.key); err != nil || val != c.expected {
+			t.Errorf("expected %v to be %v, got %v %v", c.key, c.expected, val, err)
+		} else if owner := user.Find(c.key); owner != c.owner {
+			t.Errorf("expected %v to be found in %v, got %v", c.key, c.owner, owner)
+		}
+	}
+	for _, key := range []types.Symbol{"x", "lib/y", "missing/x", "lib/dec"} {
+		if _, err := user.Get(key); !errors.Is(err, types.UnboundSymbolError) {
+			t.Errorf("expected %v to be unbound, got %v", key, err)
+		} else if owner := user.Find(key); owner != nil {
+			t.Errorf("expected %v not to be found, got %v", key, owner)
+		}
+	}
+	if _, ok := user.Lookup("inc"); ok {
+		t.Fatal("expected lookup to only see the definitions of the namespace")
+	}
+}
+
+func TestNamespaceAliasAndRefer(t *testing.T) {
+	registry := NewRegistry("core")
+	user, lib := registry.FindOrCreate("user"), registry.FindOrCreate("lib.long-name")
+	lib.Set("x", int64(1))
+	user.Alias("l", lib)
+	user.Refer(lib, "x")
+	for _, key := range []types.Symbol{"l/x", "lib.long-name/x", "x"} {
+		if val, err := user.Get(key); err != nil || val != int64(1) {
+			t.Errorf("expected %v to be 1, got %v %v", key, val, err)
+		}
+	}
+	lib.Set("x", int64(2))
+	if val, err := user.Get("x"); err != nil || val != int64(2) {
+		t.Fatalf("expected a referred name to see it redefined, got %v %v", val, err)
+	}
+	user.Set("x", int64(3))
+	if val, err := user.Get("x"); err != nil || val != int64(3) {
+		t.Fatalf("expected a definition to shadow the referred name, got %v %v", val, err)
+	}
+}
+
+func TestSplitQualified(t *testing.T) {
+	cases := []struct {
+		key       types.Symbol
+		ns, name  types.Symbol
+		qualified bool
+	}{
+		{"a/b", "a", "b", true},
+		{"a.b/c-d", "a.b", "c-d", true},
+		{"a/b/c", "a", "b/c", true},
+		{"/", "", "", false},
+		{"a/", "", "", false},
+		{"/a", "", "", false},
+		{"a", "", "", false},
+	}
+	for _, c := range cases {
+		if ns, name, ok := splitQualified(c.key); ns != c.ns || name != c.name || ok != c.qualified {
+			t.Errorf("expected %v to split into %q %q %v, got %q %q %v", c.key, c.ns, c.name, c.qualified, ns, name, ok)
+		}
+	}
+}
+
+func TestNamespaceNames(t *testing.T) {
+	ns := NewRegistry("core").FindOrCreate("lib")
+	ns.Set("b", nil)
+	ns.Set("a", nil)
+	names := ns.Names()
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("expected [a b], got %v", names)
+	}
+}
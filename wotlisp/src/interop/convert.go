@@ -0,0 +1,344 @@
+package interop
+
+import (
+	"math/big"
+	"reflect"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// Convert converts a wot value to a go value of the type. Vectors, lists and
+// seqs convert to slices and arrays, maps convert to go maps and to structs by
+// field name and wot functions convert to go functions. Parameters of type
+// interface{} get the value from FromValue.
+func Convert(e types.Env, val types.Base, typ reflect.Type) (reflect.Value, error) {
+	if gv, ok := val.(*types.GoValue); ok {
+		v := reflect.ValueOf(gv.Val)
+		if v.IsValid() && v.Type().AssignableTo(typ) {
+			return v, nil
+		} else if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Type().AssignableTo(typ) {
+			return v.Elem(), nil
+		}
+		return reflect.Value{}, convertError(val, typ)
+	}
+
+	if typ == baseType {
+		return reflect.ValueOf(&val).Elem(), nil
+	} else if typ.Kind() == reflect.Interface && typ.NumMethod() == 0 {
+		natural, err := FromValue(val)
+		if err != nil || natural == nil {
+			return reflect.Zero(typ), err
+		}
+		return reflect.ValueOf(natural), nil
+	} else if val == nil {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, convertError(val, typ)
+	} else if v := reflect.ValueOf(val); v.Type().AssignableTo(typ) {
+		return v, nil
+	}
+
+	result := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.Bool:
+		b, ok := val.(bool)
+		if !ok {
+			return reflect.Value{}, convertError(val, typ)
+		}
+		result.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toInt64(val)
+		if !ok || result.OverflowInt(n) {
+			return reflect.Value{}, convertError(val, typ)
+		}
+		result.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := toUint64(val)
+		if !ok || result.OverflowUint(n) {
+			return reflect.Value{}, convertError(val, typ)
+		}
+		result.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := types.ToFloat(val)
+		if !ok {
+			return reflect.Value{}, convertError(val, typ)
+		}
+		result.SetFloat(f)
+	case reflect.String:
+		switch tval := val.(type) {
+		case string:
+			result.SetString(tval)
+		case types.Keyword:
+			result.SetString(string(tval))
+		case types.Symbol:
+			result.SetString(string(tval))
+		default:
+			return reflect.Value{}, convertError(val, typ)
+		}
+	case reflect.Slice, reflect.Array:
+		return toSlice(e, val, typ)
+	case reflect.Map:
+		return toMap(e, val, typ)
+	case reflect.Struct:
+		hmap, ok := val.(types.Map)
+		if !ok {
+			return reflect.Value{}, convertError(val, typ)
+		}
+		return toStruct(e, hmap, typ)
+	case reflect.Ptr:
+		elem, err := Convert(e, val, typ.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case reflect.Func:
+		return toFunc(e, val, typ)
+	default:
+		return reflect.Value{}, convertError(val, typ)
+	}
+	return result, nil
+}
+
+func convertError(val types.Base, typ reflect.Type) error {
+	return types.Errorf(types.TypeError, "cannot convert %v to %v", types.TypeName(val), typ)
+}
+
+func toInt64(val types.Base) (int64, bool) {
+	switch num := val.(type) {
+	case int64:
+		return num, true
+	case *big.Int:
+		return num.Int64(), num.IsInt64()
+	}
+	return 0, false
+}
+
+func toUint64(val types.Base) (uint64, bool) {
+	switch num := val.(type) {
+	case int64:
+		return uint64(num), num >= 0
+	case *big.Int:
+		return num.Uint64(), num.IsUint64()
+	}
+	return 0, false
+}
+
+func toSlice(e types.Env, val types.Base, typ reflect.Type) (reflect.Value, error) {
+	if str, isStr := val.(string); isStr && typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+		return reflect.ValueOf([]byte(str)).Convert(typ), nil
+	}
+	switch val.(type) {
+	case types.Collection, types.Seq, *types.LazySeq, *types.Set, *types.SortedSet:
+	default:
+		return reflect.Value{}, convertError(val, typ)
+	}
+	items, err := types.SeqData(val)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	var result reflect.Value
+	if typ.Kind() == reflect.Array {
+		if len(items) != typ.Len() {
+			return reflect.Value{}, types.Errorf(types.TypeError, "cannot convert %v items to %v", len(items), typ)
+		}
+		result = reflect.New(typ).Elem()
+	} else {
+		result = reflect.MakeSlice(typ, len(items), len(items))
+	}
+	for i, item := range items {
+		elem, err := Convert(e, item, typ.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.Index(i).Set(elem)
+	}
+	return result, nil
+}
+
+func toMap(e types.Env, val types.Base, typ reflect.Type) (reflect.Value, error) {
+	hmap, ok := val.(types.Map)
+	if !ok {
+		return reflect.Value{}, convertError(val, typ)
+	}
+	result := reflect.MakeMapWithSize(typ, hmap.Count())
+	var err error
+	hmap.Range(func(key, val types.Base) bool {
+		var gkey, gval reflect.Value
+		if gkey, err = Convert(e, key, typ.Key()); err != nil {
+			return false
+		} else if gval, err = Convert(e, val, typ.Elem()); err != nil {
+			return false
+		}
+		result.SetMapIndex(gkey, gval)
+		return true
+	})
+	return result, err
+}
+
+func toStruct(e types.Env, hmap types.Map, typ reflect.Type) (reflect.Value, error) {
+	result := reflect.New(typ).Elem()
+	var err error
+	hmap.Range(func(key, val types.Base) bool {
+		var name string
+		switch tkey := key.(type) {
+		case types.Keyword:
+			name = string(tkey)
+		case types.Symbol:
+			name = string(tkey)
+		case string:
+			name = tkey
+		default:
+			err = types.Errorf(types.TypeError, "cannot use %v as a field name of %v", types.TypeName(key), typ)
+			return false
+		}
+		field, found := fieldByName(typ, name)
+		if !found {
+			err = types.Errorf(types.TypeError, "%v has no field %v", typ, name)
+			return false
+		}
+		var fieldVal reflect.Value
+		if fieldVal, err = Convert(e, val, field.Type); err != nil {
+			return false
+		}
+		result.FieldByIndex(field.Index).Set(fieldVal)
+		return true
+	})
+	return result, err
+}
+
+// callbackPanic carries the error of a wot function called through a go
+// function that cannot return it, Call recovers it and returns the error.
+type callbackPanic struct {
+	err error
+}
+
+// toFunc makes a go function that calls a wot function. If the go function
+// returns an error, errors from the call are returned through it, otherwise
+// they panic with a callbackPanic that Call turns back into the error.
+func toFunc(e types.Env, fn types.Base, typ reflect.Type) (reflect.Value, error) {
+	switch fn.(type) {
+	case *types.StdFunc, *types.ExtFunc, *types.Set, *types.SortedSet:
+	default:
+		return reflect.Value{}, convertError(fn, typ)
+	}
+	return reflect.MakeFunc(typ, func(in []reflect.Value) []reflect.Value {
+		args := make([]types.Base, len(in))
+		var err error
+		for i, arg := range in {
+			if args[i], err = toValue(arg); err != nil {
+				break
+			}
+		}
+		var result types.Base
+		if err == nil {
+			result, err = types.CallFunc(e, fn, args)
+		}
+
+		out := make([]reflect.Value, typ.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(typ.Out(i))
+		}
+		returnsErr := len(out) > 0 && typ.Out(len(out)-1) == errorType
+		if err == nil && len(out) > 0 && !(returnsErr && len(out) == 1) {
+			out[0], err = Convert(e, result, typ.Out(0))
+		}
+		if err != nil && returnsErr {
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			if len(out) > 1 {
+				out[0] = reflect.Zero(typ.Out(0))
+			}
+		} else if err != nil {
+			panic(callbackPanic{err})
+		}
+		return out
+	}), nil
+}
+
+// FromValue converts a wot value to its natural go value. Lists, vectors, sets
+// and seqs become []interface{}, maps become map[string]interface{} when all
+// of their keys are strings, keywords or symbols and map[interface{}]interface{}
+// otherwise. Keywords and symbols become their names and wrapped go values are
+// unwrapped. Numbers and anything else are returned as they are.
+func FromValue(val types.Base) (interface{}, error) {
+	switch tval := val.(type) {
+	case types.Keyword:
+		return string(tval), nil
+	case types.Symbol:
+		return string(tval), nil
+	case *types.GoValue:
+		return tval.Val, nil
+	case types.Map:
+		return mapFromValue(tval)
+	case types.Collection, types.Seq, *types.LazySeq:
+		data, err := types.SeqData(tval)
+		if err != nil {
+			return nil, err
+		}
+		return sliceFromValues(data)
+	case *types.Set:
+		return sliceFromValues(tval.Data())
+	case *types.SortedSet:
+		return sliceFromValues(tval.Data())
+	default:
+		return val, nil
+	}
+}
+
+func sliceFromValues(data []types.Base) ([]interface{}, error) {
+	vals := make([]interface{}, len(data))
+	for i, item := range data {
+		var err error
+		if vals[i], err = FromValue(item); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func mapFromValue(hmap types.Map) (interface{}, error) {
+	named := true
+	hmap.Range(func(key, val types.Base) bool {
+		switch key.(type) {
+		case string, types.Keyword, types.Symbol:
+			return true
+		default:
+			named = false
+			return false
+		}
+	})
+
+	// keys of other maps are kept as wot values since converted collections
+	// cannot be used as go map keys
+	var err error
+	strMap := map[string]interface{}{}
+	anyMap := map[interface{}]interface{}{}
+	hmap.Range(func(key, val types.Base) bool {
+		var gval interface{}
+		if gval, err = FromValue(val); err != nil {
+			return false
+		}
+		switch tkey := key.(type) {
+		case types.Keyword:
+			key = string(tkey)
+		case types.Symbol:
+			key = string(tkey)
+		}
+		if named {
+			strMap[key.(string)] = gval
+		} else {
+			anyMap[key] = gval
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	} else if named {
+		return strMap, nil
+	}
+	return anyMap, nil
+}
@@ -0,0 +1,257 @@
+// Package interop converts between go and wot values with reflection so that
+// go functions, structs and methods can be used from wot code.
+package interop
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+var (
+	baseType  = reflect.TypeOf((*types.Base)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToValue converts a go value to a wot value. Booleans, strings and numbers
+// become their wot equivalents, slices and arrays become vectors, maps become
+// hash maps and functions become builtins that convert their arguments and
+// results. Structs, pointers and anything else are wrapped in a GoValue so
+// their fields and methods can be used. Wot values are returned as they are.
+func ToValue(value interface{}) (types.Base, error) {
+	switch tval := value.(type) {
+	case func(...types.Base) (types.Base, error):
+		return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+			return tval(a...)
+		}), nil
+	case func(types.Env, []types.Base) (types.Base, error):
+		return types.Func(tval), nil
+	}
+	return toValue(reflect.ValueOf(value))
+}
+
+func isWotValue(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, string, int64, float64, *big.Int, *big.Rat, *types.Decimal,
+		types.Symbol, types.Keyword, *types.List, *types.Vector, *types.Hashmap,
+		*types.Set, *types.SortedMap, *types.SortedSet, *types.Atom, *types.Ref, *types.Agent, *types.Var,
+		*types.Future, *types.Promise, *types.Chan, *types.Mult,
+		*types.StdFunc, *types.ExtFunc, *types.LazySeq, types.Seq, *types.GoValue, *types.Stream, error:
+		return true
+	default:
+		return false
+	}
+}
+
+func toValue(v reflect.Value) (types.Base, error) {
+	if !v.IsValid() {
+		return nil, nil
+	} else if v.CanInterface() && isWotValue(v.Interface()) {
+		return v.Interface(), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := v.Uint(); n > 1<<63-1 {
+			return new(big.Int).SetUint64(n), nil
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		items := make([]types.Base, v.Len())
+		for i := range items {
+			var err error
+			if items[i], err = toValue(v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return types.NewVect(items...), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		values := []types.Base{}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toValue(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			val, err := toValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, key, val)
+		}
+		return types.NewHashmap(values)
+	case reflect.Func:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return funcValue(funcName(v), v), nil
+	case reflect.Interface:
+		return toValue(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+	}
+	if !v.CanInterface() {
+		return nil, types.Errorf(types.TypeError, "cannot convert unexported %v to a wot value", v.Type())
+	}
+	return &types.GoValue{Val: v.Interface()}, nil
+}
+
+// Func wraps any go function as a builtin. The arguments are converted to the
+// types of the parameters, variadic functions take any number of trailing
+// arguments and a non-nil error as the last result is raised as an error.
+func Func(fn interface{}) (*types.StdFunc, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, types.Errorf(types.TypeError, "cannot make a function from %T", fn)
+	}
+	return funcValue(funcName(v), v), nil
+}
+
+func funcValue(name string, fn reflect.Value) *types.StdFunc {
+	return types.Func(func(e types.Env, a []types.Base) (types.Base, error) {
+		return Call(e, name, fn, a)
+	})
+}
+
+func funcName(fn reflect.Value) string {
+	if f := goruntime.FuncForPC(fn.Pointer()); f != nil {
+		return f.Name()
+	}
+	return fn.Type().String()
+}
+
+// Call calls a go function with wot arguments and converts its results. No
+// results is nil, one is its value and more than one is a vector of them.
+// Errors from wot functions passed to it as go functions are returned even if
+// the go function could not return them.
+func Call(e types.Env, name string, fn reflect.Value, args []types.Base) (result types.Base, err error) {
+	typ := fn.Type()
+	fixed := typ.NumIn()
+	if typ.IsVariadic() {
+		fixed--
+	}
+	if len(args) < fixed || (!typ.IsVariadic() && len(args) > fixed) {
+		expected := fmt.Sprint(fixed)
+		if typ.IsVariadic() {
+			expected = "at least " + expected
+		}
+		return nil, types.Errorf(types.ArityError, "wrong number of arguments (%v) passed to %v, expected %v", len(args), name, expected).
+			With(types.Keyword("name"), name, types.Keyword("count"), int64(len(args)))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if i < fixed {
+			paramType = typ.In(i)
+		} else {
+			paramType = typ.In(fixed).Elem()
+		}
+		if in[i], err = Convert(e, arg, paramType); err != nil {
+			return nil, types.Errorf(types.TypeError, "%v: argument %v: %v", name, i+1, err).Wrap(err)
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			callback, ok := r.(callbackPanic)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, callback.err
+		}
+	}()
+	return results(fn.Call(in))
+}
+
+func results(out []reflect.Value) (types.Base, error) {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if !out[n-1].IsNil() {
+			return nil, out[n-1].Interface().(error)
+		}
+		out = out[:n-1]
+	}
+	switch len(out) {
+	case 0:
+		return nil, nil
+	case 1:
+		return toValue(out[0])
+	}
+	vals := make([]types.Base, len(out))
+	for i, val := range out {
+		var err error
+		if vals[i], err = toValue(val); err != nil {
+			return nil, err
+		}
+	}
+	return types.NewVect(vals...), nil
+}
+
+// CallMethod calls the named method of a wrapped go value
+func CallMethod(e types.Env, obj types.Base, name string, args []types.Base) (types.Base, error) {
+	gv, ok := obj.(*types.GoValue)
+	if !ok {
+		return nil, types.Errorf(types.TypeError, "cannot call method %v on %v", name, types.TypeName(obj))
+	}
+	method := reflect.ValueOf(gv.Val).MethodByName(name)
+	if !method.IsValid() {
+		return nil, types.Errorf(types.TypeError, "%T has no method %v", gv.Val, name)
+	}
+	return Call(e, fmt.Sprintf("%T.%v", gv.Val, name), method, args)
+}
+
+// Field reads the named field of a wrapped go struct or pointer to a struct
+func Field(obj types.Base, name string) (types.Base, error) {
+	gv, ok := obj.(*types.GoValue)
+	if !ok {
+		return nil, types.Errorf(types.TypeError, "cannot read field %v of %v", name, types.TypeName(obj))
+	}
+	v := reflect.Indirect(reflect.ValueOf(gv.Val))
+	if v.Kind() != reflect.Struct {
+		return nil, types.Errorf(types.TypeError, "cannot read field %v of %T", name, gv.Val)
+	}
+	field, found := fieldByName(v.Type(), name)
+	if !found {
+		return nil, types.Errorf(types.TypeError, "%T has no field %v", gv.Val, name)
+	}
+	return toValue(v.FieldByIndex(field.Index))
+}
+
+// fieldByName finds the exported field for a name from wot code. The name can
+// be the go field name, the name in its wot struct tag or the name in kebab
+// case, so :user-id finds UserID.
+func fieldByName(typ reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		} else if tag, ok := field.Tag.Lookup("wot"); ok && tag == name {
+			return field, true
+		} else if fieldKey(field.Name) == fieldKey(name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func fieldKey(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+}
@@ -2,6 +2,9 @@ package printer
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/tanema/mal/wotlisp/src/types"
@@ -18,11 +21,21 @@ func List(forms []types.Base, pretty bool, pre, post, join string) string {
 func Print(object types.Base, pretty bool) string {
 	switch tobj := object.(type) {
 	case *types.Vector:
-		return List(tobj.Forms, pretty, "[", "]", " ")
+		return List(tobj.Data(), pretty, "[", "]", " ")
 	case *types.List:
-		return List(tobj.Forms, pretty, "(", ")", " ")
-	case *types.Hashmap:
+		return List(tobj.Data(), pretty, "(", ")", " ")
+	case types.Seq, *types.LazySeq:
+		items, err := types.SeqData(tobj)
+		if err != nil {
+			return Print(err, pretty)
+		}
+		return List(items, pretty, "(", ")", " ")
+	case types.Map:
 		return List(tobj.ToList(), pretty, "{", "}", " ")
+	case *types.Set:
+		return List(tobj.Data(), pretty, "#{", "}", " ")
+	case *types.SortedSet:
+		return List(tobj.Data(), pretty, "#{", "}", " ")
 	case types.Symbol:
 		return string(tobj)
 	case types.Keyword:
@@ -34,11 +47,59 @@ func Print(object types.Base, pretty bool) string {
 		if tobj.IsMacro {
 			pre = "#<macro "
 		}
-		return pre + List(tobj.Params, pretty, "[", "]", ", ") + Print(tobj.AST, pretty) + ">"
+		arities := make([]string, len(tobj.Arities))
+		for i, arity := range tobj.Arities {
+			arities[i] = List(arity.Params, pretty, "[", "]", ", ") + Print(arity.AST, pretty)
+		}
+		return pre + strings.Join(arities, " ") + ">"
 	case *types.Atom:
-		return "(atom " + Print(tobj.Val, pretty) + ")"
+		return "(atom " + Print(tobj.Deref(), pretty) + ")"
+	case *types.Ref:
+		return "(ref " + Print(tobj.Deref(), pretty) + ")"
+	case *types.Agent:
+		return "(agent " + Print(tobj.Deref(), pretty) + ")"
+	case *types.Var:
+		return "#'" + string(tobj.Name)
+	case *types.Future:
+		status, val := tobj.Status()
+		return "#future " + Print(statusMap(status, val), pretty)
+	case *types.Promise:
+		status, val := tobj.Status()
+		return "#promise " + Print(statusMap(status, val), pretty)
+	case *types.Chan:
+		kind, size, count := tobj.Buffer()
+		hmap, _ := types.NewHashmap([]types.Base{
+			types.Keyword("buffer"), types.Keyword(kind), types.Keyword("size"), int64(size),
+			types.Keyword("count"), int64(count), types.Keyword("closed"), tobj.Closed(),
+		})
+		return "#chan " + Print(hmap, pretty)
+	case *types.Mult:
+		return "#mult " + Print(tobj.Src, pretty)
+	case *types.GoValue:
+		return fmt.Sprintf("#object[%T %v]", tobj.Val, tobj.Val)
+	case *types.Stream:
+		return "#stream[" + string(tobj.Name) + "]"
+	case *types.ExInfo:
+		fields := []types.Base{types.Keyword("message"), tobj.Message, types.Keyword("data"), tobj.Data}
+		if userErr, isUserErr := tobj.Cause.(types.UserError); isUserErr {
+			fields = append(fields, types.Keyword("cause"), userErr.Val)
+		} else if tobj.Cause != nil {
+			fields = append(fields, types.Keyword("cause"), tobj.Cause)
+		}
+		return "#error " + List(fields, pretty, "{", "}", " ")
 	case types.UserError:
 		return "Exception: " + Print(tobj.Val, pretty)
+	case types.SourceError:
+		return Print(tobj.Err, pretty) + "\n  at " + tobj.Pos.String()
+	case *types.StackError:
+		trace := Print(tobj.Err, pretty)
+		for _, frame := range tobj.Frames {
+			trace += "\n  in " + frame.String()
+			if frame.Elided > 0 {
+				trace += "\n  ... " + strconv.Itoa(frame.Elided) + " tail calls elided"
+			}
+		}
+		return trace
 	case error:
 		return "Exception: " + tobj.Error()
 	case string:
@@ -56,9 +117,47 @@ func Print(object types.Base, pretty bool) string {
 		return "false"
 	case nil:
 		return "nil"
+	case int64:
+		return strconv.FormatInt(tobj, 10)
+	case *big.Int:
+		if pretty {
+			return tobj.String() + "N"
+		}
+		return tobj.String()
+	case *big.Rat:
+		return tobj.String()
+	case *types.Decimal:
+		if pretty {
+			return tobj.String() + "M"
+		}
+		return tobj.String()
 	case float64:
-		return fmt.Sprintf("%v", tobj)
+		return formatFloat(tobj)
+	case fmt.Stringer:
+		return tobj.String()
 	default:
 		return "error formatting datatype"
 	}
 }
+
+// statusMap is how futures and promises show their state, {:status :val}
+func statusMap(status types.Keyword, val types.Base) *types.Hashmap {
+	hmap, _ := types.NewHashmap([]types.Base{types.Keyword("status"), status, types.Keyword("val"), val})
+	return hmap
+}
+
+func formatFloat(num float64) string {
+	switch {
+	case math.IsInf(num, 1):
+		return "##Inf"
+	case math.IsInf(num, -1):
+		return "##-Inf"
+	case math.IsNaN(num):
+		return "##NaN"
+	}
+	str := strconv.FormatFloat(num, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".e") {
+		str += ".0"
+	}
+	return str
+}
@@ -1,20 +1,23 @@
 package reader
 
 import (
-	"errors"
-	"fmt"
+	"math"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/tanema/mal/wotlisp/src/types"
 )
 
 var (
-	ErrUnderflow = errors.New("EOF underflow error: more input expected")
+	ErrUnderflow = types.Errorf(types.ReaderError, "EOF underflow error: more input expected")
 
-	tokensPattern = regexp.MustCompile(`[\s,]*(~@|[\[\]{}()'` + "`" + `~^@]|"(?:\\.|[^\\"])*"?|;.*|[^\s\[\]{}('"` + "`" + `,;)]*)`)
-	numberPattern = regexp.MustCompile(`^-?[0-9]+\.?[0-9]*$`)
+	tokensPattern = regexp.MustCompile(`[\s,]*(~@|#\{|[\[\]{}()'` + "`" + `~^@]|"(?:\\.|[^\\"])*"?|;.*|[^\s\[\]{}('"` + "`" + `,;)]*)`)
+	intPattern    = regexp.MustCompile(`^[-+]?(0[xX][0-9a-fA-F]+|[0-9]+)N?$`)
+	ratioPattern  = regexp.MustCompile(`^[-+]?[0-9]+/[0-9]+$`)
+	floatPattern  = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]*)?([eE][-+]?[0-9]+)?M?$`)
 
 	stringEsc = map[string]string{
 		`\\`: `\`,
@@ -24,7 +27,16 @@ var (
 )
 
 type Reader struct {
-	tokens []string
+	tokens []token
+	last   token
+	file   string
+}
+
+// token is a single token of source along with where it starts
+type token struct {
+	text   string
+	line   int
+	column int
 }
 
 func ReadString(in string) (types.Base, error) {
@@ -32,29 +44,59 @@ func ReadString(in string) (types.Base, error) {
 	return reader.form()
 }
 
+// ReadFile reads every form in the source of a file. The file name is recorded
+// in the position metadata of each form.
+func ReadFile(file, in string) ([]types.Base, error) {
+	reader := &Reader{tokens: tokenize(in), file: file}
+	forms := []types.Base{}
+	for len(reader.tokens) > 0 {
+		form, err := reader.form()
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, form)
+	}
+	return forms, nil
+}
+
 func (reader *Reader) next() (string, bool) {
-	var token string
 	if len(reader.tokens) == 0 {
-		return token, false
+		return "", false
 	}
-	token, reader.tokens = reader.tokens[0], reader.tokens[1:]
-	return token, true
+	reader.last, reader.tokens = reader.tokens[0], reader.tokens[1:]
+	return reader.last.text, true
 }
 
 func (reader *Reader) peek() (string, bool) {
 	if len(reader.tokens) > 0 {
-		return reader.tokens[0], true
+		return reader.tokens[0].text, true
 	}
 	return "", false
 }
 
-func tokenize(in string) []string {
-	results := []string{}
-	for _, group := range tokensPattern.FindAllStringSubmatch(in, -1) {
-		if (group[1] == "") || (group[1][0] == ';') {
+// unexpected is the error for a token that is not valid where it was found
+func (reader *Reader) unexpected(tok token) error {
+	pos := types.Position{File: reader.file, Line: tok.line, Column: tok.column}
+	return types.Errorf(types.ReaderError, "unexpected '%v' at %v", tok.text, pos).
+		With(types.Keyword("line"), int64(pos.Line), types.Keyword("column"), int64(pos.Column))
+}
+
+func tokenize(in string) []token {
+	results := []token{}
+	line, lineStart, offset := 1, 0, 0
+	for _, group := range tokensPattern.FindAllStringSubmatchIndex(in, -1) {
+		start, end := group[2], group[3]
+		for ; offset < start; offset++ {
+			if in[offset] == '\n' {
+				line, lineStart = line+1, offset+1
+			}
+		}
+		text := in[start:end]
+		if (text == "") || (text[0] == ';') {
 			continue
 		}
-		results = append(results, group[1])
+		column := utf8.RuneCountInString(in[lineStart:start]) + 1
+		results = append(results, token{text: text, line: line, column: column})
 	}
 	return results
 }
@@ -78,18 +120,16 @@ func (reader *Reader) form() (types.Base, error) {
 		return reader.meta()
 	case `@`:
 		return reader.modifier("deref")
-	case ")":
-		return nil, errors.New("unexpected ')'")
+	case ")", "]", "}":
+		return nil, reader.unexpected(reader.tokens[0])
 	case "(":
 		return reader.list("(", ")")
-	case "]":
-		return nil, errors.New("unexpected ']'")
 	case "[":
 		return reader.vector()
-	case "}":
-		return nil, errors.New("unexpected '}'")
 	case "{":
 		return reader.hashMap()
+	case "#{":
+		return reader.set()
 	default:
 		return reader.atom()
 	}
@@ -97,56 +137,107 @@ func (reader *Reader) form() (types.Base, error) {
 
 func (reader *Reader) modifier(symbol string) (*types.List, error) {
 	reader.next()
+	start := reader.last
 	form, err := reader.form()
-	return types.NewList(types.Symbol(symbol), form), err
+	return types.NewList(types.Symbol(symbol), form).WithPosition(reader.span(start)), err
 }
 
 func (reader *Reader) meta() (*types.List, error) {
 	reader.next()
+	start := reader.last
 	meta, err := reader.form()
 	if err != nil {
 		return nil, err
 	}
 	form, err := reader.form()
-	return types.NewList(types.Symbol("with-meta"), form, meta), err
+	return types.NewList(types.Symbol("with-meta"), form, meta).WithPosition(reader.span(start)), err
+}
+
+// span is the position from the start token to the last token read
+func (reader *Reader) span(start token) types.Position {
+	return types.Position{
+		File:      reader.file,
+		Line:      start.line,
+		Column:    start.column,
+		EndLine:   reader.last.line,
+		EndColumn: reader.last.column + utf8.RuneCountInString(reader.last.text),
+	}
 }
 
 func (reader *Reader) list(start, end string) (*types.List, error) {
-	list := &types.List{Forms: []types.Base{}}
+	forms, span, positions, err := reader.forms(start, end)
+	return types.NewList(forms...).WithPosition(span).WithPositions(positions), err
+}
+
+// forms reads the forms between the start and end tokens. It returns their
+// span and the positions of the symbols among them, which cannot keep a
+// position of their own.
+func (reader *Reader) forms(start, end string) ([]types.Base, types.Position, []types.Position, error) {
+	list := []types.Base{}
+	var positions []types.Position
 	token, hasNext := reader.next()
 	if !hasNext {
-		return list, ErrUnderflow
+		return list, types.Position{}, nil, ErrUnderflow
 	}
 	if token != start {
-		return list, fmt.Errorf("unexpected '%v'", token)
+		return list, types.Position{}, nil, reader.unexpected(reader.last)
 	}
+	startToken := reader.last
 	token, hasNext = reader.peek()
 	for ; token != end && hasNext; token, hasNext = reader.peek() {
 		form, err := reader.form()
 		if err != nil {
-			return list, err
+			return list, types.Position{}, nil, err
+		}
+		if _, isSym := form.(types.Symbol); isSym {
+			if positions == nil {
+				positions = make([]types.Position, len(list), len(list)+1)
+			}
+			positions = append(positions, reader.position(reader.last))
+		} else if positions != nil {
+			positions = append(positions, types.Position{})
 		}
-		list.Forms = append(list.Forms, form)
+		list = append(list, form)
 	}
 	if token, hasNext := reader.next(); !hasNext {
-		return list, ErrUnderflow
+		return list, types.Position{}, nil, ErrUnderflow
 	} else if token != end {
-		return list, fmt.Errorf("unexpected '%v'", token)
+		return list, types.Position{}, nil, reader.unexpected(reader.last)
+	}
+	return list, reader.span(startToken), positions, nil
+}
+
+// position is the position of a single token
+func (reader *Reader) position(tok token) types.Position {
+	return types.Position{
+		File:      reader.file,
+		Line:      tok.line,
+		Column:    tok.column,
+		EndLine:   tok.line,
+		EndColumn: tok.column + utf8.RuneCountInString(tok.text),
 	}
-	return list, nil
 }
 
 func (reader *Reader) vector() (*types.Vector, error) {
-	list, err := reader.list("[", "]")
-	return &types.Vector{Forms: list.Forms}, err
+	forms, span, positions, err := reader.forms("[", "]")
+	return types.NewVect(forms...).WithPosition(span).WithPositions(positions), err
 }
 
 func (reader *Reader) hashMap() (*types.Hashmap, error) {
-	list, err := reader.list("{", "}")
+	forms, span, _, err := reader.forms("{", "}")
 	if err != nil {
 		return nil, err
 	}
-	return types.NewHashmap(list.Forms)
+	hmap, err := types.NewHashmap(forms)
+	if err != nil {
+		return nil, err
+	}
+	return hmap.WithPosition(span), nil
+}
+
+func (reader *Reader) set() (*types.Set, error) {
+	forms, span, _, err := reader.forms("#{", "}")
+	return types.NewSet(forms...).WithPosition(span), err
 }
 
 func (reader *Reader) atom() (types.Base, error) {
@@ -161,17 +252,23 @@ func (reader *Reader) atom() (types.Base, error) {
 		return true, nil
 	} else if token == "false" {
 		return false, nil
+	} else if token == "##Inf" {
+		return math.Inf(1), nil
+	} else if token == "##-Inf" {
+		return math.Inf(-1), nil
+	} else if token == "##NaN" {
+		return math.NaN(), nil
 	} else if token[0] == ':' {
 		return types.Keyword(token[1:]), nil
-	} else if match := numberPattern.MatchString(token); match {
-		num, err := strconv.ParseFloat(token, 64)
-		if err != nil {
-			err = errors.New("improperly formatted number")
-		}
-		return num, nil
+	} else if intPattern.MatchString(token) {
+		return readInt(token)
+	} else if ratioPattern.MatchString(token) {
+		return readRatio(token)
+	} else if floatPattern.MatchString(token) {
+		return readFloat(token)
 	} else if token[0] == '"' {
 		if token[len(token)-1] != '"' {
-			return nil, errors.New("expected '\"', got EOF")
+			return nil, types.Errorf(types.ReaderError, "expected '\"', got EOF")
 		}
 		str := token[1 : len(token)-1]
 		// for find, replace := range stringEsc {
@@ -189,3 +286,49 @@ func (reader *Reader) atom() (types.Base, error) {
 
 	return types.Symbol(token), nil
 }
+
+func readInt(token string) (types.Base, error) {
+	isBig := strings.HasSuffix(token, "N")
+	digits := strings.TrimSuffix(token, "N")
+	sign := ""
+	if digits[0] == '-' || digits[0] == '+' {
+		sign, digits = digits[:1], digits[1:]
+	}
+	base := 10
+	if len(digits) > 2 && (digits[:2] == "0x" || digits[:2] == "0X") {
+		base, digits = 16, digits[2:]
+	}
+	num, ok := new(big.Int).SetString(sign+digits, base)
+	if !ok {
+		return nil, types.Errorf(types.ReaderError, "improperly formatted number")
+	}
+	if !isBig && num.IsInt64() {
+		return num.Int64(), nil
+	}
+	return num, nil
+}
+
+func readRatio(token string) (types.Base, error) {
+	if strings.Trim(token[strings.IndexByte(token, '/')+1:], "0") == "" {
+		return nil, types.ErrDivideByZero
+	}
+	ratio, ok := new(big.Rat).SetString(strings.TrimPrefix(token, "+"))
+	if !ok {
+		return nil, types.Errorf(types.ReaderError, "improperly formatted ratio")
+	}
+	if ratio.IsInt() {
+		return readInt(ratio.Num().String())
+	}
+	return ratio, nil
+}
+
+func readFloat(token string) (types.Base, error) {
+	if strings.HasSuffix(token, "M") {
+		return types.ParseDecimal(strings.TrimSuffix(token, "M"))
+	}
+	num, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, types.Errorf(types.ReaderError, "improperly formatted number")
+	}
+	return num, nil
+}
@@ -16,8 +16,8 @@ package readline
 import "C"
 
 import (
-	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -51,14 +51,15 @@ func loadHistory(filename string) error {
 	return nil
 }
 
-// Readline will read in a single line of text with the provided prompt
+// Readline will read in a single line of text with the provided prompt. It
+// returns io.EOF when there is no more input.
 func Readline(prompt string) (string, error) {
 	cPrompt := C.CString(prompt)
 	defer C.free(unsafe.Pointer(cPrompt))
 	cLine := C.readline(cPrompt)
 	defer C.free(unsafe.Pointer(cLine))
 	if cLine == nil {
-		return "", errors.New("C.readline call failed")
+		return "", io.EOF
 	}
 	C.add_history(cLine)
 	line := C.GoString(cLine)
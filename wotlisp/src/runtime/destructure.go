@@ -0,0 +1,198 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/tanema/mal/wotlisp/src/printer"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// bindParams creates a child of e with the parameters of a function or the
+// bindings of a loop* bound to the values. Each parameter can be a binding
+// form and & binds the rest of the values as a list.
+func bindParams(ctx context.Context, e types.Env, params, values []types.Base) (types.Env, error) {
+	newEnv := e.Child()
+	for i, param := range params {
+		if param == types.Symbol("&") {
+			if i+1 >= len(params) {
+				return nil, types.Errorf(types.SyntaxError, "& must be followed by a binding form")
+			}
+			rest := []types.Base{}
+			if i < len(values) {
+				rest = values[i:]
+			}
+			return newEnv, bind(ctx, newEnv, params[i+1], types.NewList(rest...))
+		} else if i >= len(values) {
+			return nil, types.Errorf(types.ArityError, "wrong number of arguments").With(types.Keyword("count"), int64(len(values)))
+		} else if err := bind(ctx, newEnv, param, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return newEnv, nil
+}
+
+// bind binds the value to a binding form in e. The form can be a symbol, a
+// sequential form like [a [b c] & rest :as all] or an associative form like
+// {a :a :keys [b] :strs [c] :or {b 1} :as m}.
+func bind(ctx context.Context, e types.Env, pattern, value types.Base) error {
+	switch tpattern := pattern.(type) {
+	case types.Symbol:
+		if tpattern == "&" {
+			return types.Errorf(types.SyntaxError, "& can only be used in a sequential binding form")
+		}
+		e.Set(tpattern, value)
+		return nil
+	case types.Collection:
+		return bindSequential(ctx, e, tpattern.Data(), value)
+	case *types.Hashmap:
+		return bindAssociative(ctx, e, tpattern, value)
+	default:
+		return types.Errorf(types.SyntaxError, "unsupported binding form %v", printer.Print(pattern, true))
+	}
+}
+
+func bindSequential(ctx context.Context, e types.Env, patterns []types.Base, value types.Base) error {
+	if !isSequential(value) {
+		return types.Errorf(types.TypeError, "cannot destructure %v as a sequence in %v", types.TypeName(value), printer.List(patterns, true, "[", "]", " "))
+	}
+	seq, err := types.ToSeq(value)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(patterns); i++ {
+		switch patterns[i] {
+		case types.Symbol("&"):
+			if i+1 >= len(patterns) {
+				return types.Errorf(types.SyntaxError, "& must be followed by a binding form")
+			}
+			var rest types.Base
+			if seq != nil {
+				rest = seq
+			}
+			if err := bind(ctx, e, patterns[i+1], rest); err != nil {
+				return err
+			}
+			seq = nil
+			i++
+		case types.Keyword("as"):
+			if i+1 >= len(patterns) {
+				return types.Errorf(types.SyntaxError, ":as must be followed by a symbol")
+			} else if _, ok := patterns[i+1].(types.Symbol); !ok {
+				return types.Errorf(types.SyntaxError, ":as must be followed by a symbol, got %v", types.TypeName(patterns[i+1]))
+			}
+			e.Set(patterns[i+1].(types.Symbol), value)
+			i++
+		default:
+			var item types.Base
+			if seq != nil {
+				item = seq.First()
+				if seq, err = types.ToSeq(seq.More()); err != nil {
+					return err
+				}
+			}
+			if err := bind(ctx, e, patterns[i], item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func bindAssociative(ctx context.Context, e types.Env, pattern *types.Hashmap, value types.Base) error {
+	hmap, err := asMap(value)
+	if err != nil {
+		return types.Errorf(types.TypeError, "cannot destructure %v as a map in %v", types.TypeName(value), printer.Print(pattern, true))
+	}
+	defaults, _ := asMap(nil)
+	if or, found := pattern.Get(types.Keyword("or")); found {
+		var isMap bool
+		if defaults, isMap = or.(types.Map); !isMap {
+			return types.Errorf(types.SyntaxError, ":or must be followed by a map, got %v", types.TypeName(or))
+		}
+	}
+
+	var bindErr error
+	pattern.Range(func(key, val types.Base) bool {
+		switch key {
+		case types.Keyword("or"):
+		case types.Keyword("as"):
+			sym, ok := val.(types.Symbol)
+			if !ok {
+				bindErr = types.Errorf(types.SyntaxError, ":as must be followed by a symbol, got %v", types.TypeName(val))
+			} else {
+				e.Set(sym, value)
+			}
+		case types.Keyword("keys"), types.Keyword("strs"), types.Keyword("syms"):
+			names, ok := val.(types.Collection)
+			if !ok {
+				bindErr = types.Errorf(types.SyntaxError, "%v must be followed by a vector of symbols", printer.Print(key, true))
+				break
+			}
+			for _, name := range names.Data() {
+				sym, ok := name.(types.Symbol)
+				if !ok {
+					bindErr = types.Errorf(types.SyntaxError, "%v must be followed by a vector of symbols, got %v", printer.Print(key, true), types.TypeName(name))
+					break
+				}
+				var lookup types.Base = sym
+				switch key {
+				case types.Keyword("keys"):
+					lookup = types.Keyword(sym)
+				case types.Keyword("strs"):
+					lookup = string(sym)
+				}
+				if bindErr = bindKey(ctx, e, sym, lookup, hmap, defaults); bindErr != nil {
+					break
+				}
+			}
+		default:
+			bindErr = bindKey(ctx, e, key, val, hmap, defaults)
+		}
+		return bindErr == nil
+	})
+	return bindErr
+}
+
+// bindKey binds the pattern to the value for key in the map. If the key is
+// missing and the pattern is a symbol with a default in the :or map, the
+// default is evaluated with ctx and bound instead.
+func bindKey(ctx context.Context, e types.Env, pattern, key types.Base, hmap types.Map, defaults types.Map) error {
+	val, found := hmap.Get(key)
+	if sym, isSym := pattern.(types.Symbol); !found && isSym {
+		if form, hasDefault := defaults.Get(sym); hasDefault {
+			var err error
+			if val, err = Eval(ctx, e, form); err != nil {
+				return err
+			}
+		}
+	}
+	return bind(ctx, e, pattern, val)
+}
+
+// asMap returns the value as a map, nil is an empty map and a sequence of key
+// value pairs, like the rest args of a function, is made into a map.
+func asMap(value types.Base) (types.Map, error) {
+	switch tvalue := value.(type) {
+	case nil:
+		return types.NewHashmap(nil)
+	case types.Map:
+		return tvalue, nil
+	}
+	if !isSequential(value) {
+		return nil, types.Errorf(types.TypeError, "not a map")
+	}
+	data, err := types.SeqData(value)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewHashmap(data)
+}
+
+func isSequential(value types.Base) bool {
+	switch value.(type) {
+	case nil, types.Collection, string:
+		return true
+	default:
+		return types.IsSeq(value)
+	}
+}
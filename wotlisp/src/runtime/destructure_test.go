@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/env"
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func read(t *testing.T, src string) types.Base {
+	form, err := reader.ReadString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form
+}
+
+func TestBind(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		value    string
+		expected map[types.Symbol]string
+	}{
+		{`a`, `1`, map[types.Symbol]string{"a": `1`}},
+		{`[a b]`, `[1 2]`, map[types.Symbol]string{"a": `1`, "b": `2`}},
+		{`[a b]`, `(1)`, map[types.Symbol]string{"a": `1`, "b": `nil`}},
+		{`[a b]`, `nil`, map[types.Symbol]string{"a": `nil`, "b": `nil`}},
+		{`[a b]`, `"xy"`, map[types.Symbol]string{"a": `"x"`, "b": `"y"`}},
+		{`[a [b [c]]]`, `[1 [2 [3]]]`, map[types.Symbol]string{"a": `1`, "b": `2`, "c": `3`}},
+		{`[a & rest]`, `[1 2 3]`, map[types.Symbol]string{"a": `1`, "rest": `(2 3)`}},
+		{`[a & rest]`, `[1]`, map[types.Symbol]string{"a": `1`, "rest": `nil`}},
+		{`[a & [b c]]`, `[1 2 3]`, map[types.Symbol]string{"a": `1`, "b": `2`, "c": `3`}},
+		{`[a :as all]`, `[1 2]`, map[types.Symbol]string{"a": `1`, "all": `[1 2]`}},
+		{`{a :a b "b"}`, `{:a 1 "b" 2}`, map[types.Symbol]string{"a": `1`, "b": `2`}},
+		{`{:keys [a b] :strs [c]}`, `{:a 1 :b 2 "c" 3}`, map[types.Symbol]string{"a": `1`, "b": `2`, "c": `3`}},
+		{`{:syms [a]}`, `{a 1}`, map[types.Symbol]string{"a": `1`}},
+		{`{:keys [a b] :or {b 2}}`, `{:a 1}`, map[types.Symbol]string{"a": `1`, "b": `2`}},
+		{`{:keys [a] :or {a 2}}`, `{:a nil}`, map[types.Symbol]string{"a": `nil`}},
+		{`{:keys [a] :as m}`, `{:a 1}`, map[types.Symbol]string{"a": `1`, "m": `{:a 1}`}},
+		{`{[a b] :pair}`, `{:pair [1 2]}`, map[types.Symbol]string{"a": `1`, "b": `2`}},
+		{`[a & {:keys [b]}]`, `[1 :b 2]`, map[types.Symbol]string{"a": `1`, "b": `2`}},
+		{`{:keys [a]}`, `nil`, map[types.Symbol]string{"a": `nil`}},
+	}
+	for _, c := range cases {
+		t.Run(c.pattern+" "+c.value, func(t *testing.T) {
+			e := env.New(nil)
+			if err := bind(context.Background(), e, read(t, c.pattern), read(t, c.value)); err != nil {
+				t.Fatal(err)
+			}
+			for sym, src := range c.expected {
+				expected := read(t, src)
+				if val, err := e.Get(sym); err != nil || !types.Equal(val, expected) {
+					t.Errorf("expected %v to be %v, got %v %v", sym, src, val, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	cases := []struct {
+		pattern string
+		value   string
+		errType types.ErrorType
+		message string
+	}{
+		{`[a b]`, `1`, types.TypeError, "cannot destructure integer as a sequence in [a b]"},
+		{`[a [b]]`, `[1 2]`, types.TypeError, "cannot destructure integer as a sequence in [b]"},
+		{`{:keys [a]}`, `1`, types.TypeError, "cannot destructure integer as a map in {:keys [a]}"},
+		{`[a &]`, `[1]`, types.SyntaxError, "& must be followed by a binding form"},
+		{`&`, `1`, types.SyntaxError, "& can only be used in a sequential binding form"},
+		{`[a :as]`, `[1]`, types.SyntaxError, ":as must be followed by a symbol"},
+		{`[a :as [b]]`, `[1]`, types.SyntaxError, ":as must be followed by a symbol, got vector"},
+		{`{:keys a}`, `{}`, types.SyntaxError, ":keys must be followed by a vector of symbols"},
+		{`{:keys [:a]}`, `{}`, types.SyntaxError, ":keys must be followed by a vector of symbols, got keyword"},
+		{`{:keys [a] :or [a 1]}`, `{}`, types.SyntaxError, ":or must be followed by a map, got vector"},
+		{`1`, `1`, types.SyntaxError, "unsupported binding form 1"},
+	}
+	for _, c := range cases {
+		t.Run(c.pattern+" "+c.value, func(t *testing.T) {
+			err := bind(context.Background(), env.New(nil), read(t, c.pattern), read(t, c.value))
+			if !errors.Is(err, c.errType) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			} else if err.Error() != c.message {
+				t.Fatalf("expected %q, got %q", c.message, err.Error())
+			}
+		})
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	cases := []struct {
+		params   string
+		values   string
+		expected map[types.Symbol]string
+	}{
+		{`[a b]`, `[1 2]`, map[types.Symbol]string{"a": `1`, "b": `2`}},
+		{`[a & more]`, `[1 2 3]`, map[types.Symbol]string{"a": `1`, "more": `(2 3)`}},
+		{`[a & more]`, `[1]`, map[types.Symbol]string{"a": `1`, "more": `()`}},
+		{`[[a b] {:keys [c]}]`, `[[1 2] {:c 3}]`, map[types.Symbol]string{"a": `1`, "b": `2`, "c": `3`}},
+	}
+	for _, c := range cases {
+		t.Run(c.params+" "+c.values, func(t *testing.T) {
+			root := env.New(nil)
+			e, err := bindParams(context.Background(), root, read(t, c.params).(*types.Vector).Data(), read(t, c.values).(*types.Vector).Data())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for sym, src := range c.expected {
+				if val, err := e.Get(sym); err != nil || !types.Equal(val, read(t, src)) {
+					t.Errorf("expected %v to be %v, got %v %v", sym, src, val, err)
+				} else if root.Find(sym) != nil {
+					t.Errorf("expected %v to be bound in a child env only", sym)
+				}
+			}
+		})
+	}
+	if _, err := bindParams(context.Background(), env.New(nil), read(t, `[a b]`).(*types.Vector).Data(), []types.Base{int64(1)}); !errors.Is(err, types.ArityError) {
+		t.Fatalf("expected an arity error for a missing value, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// Limits bound the work an evaluation can do so untrusted code cannot run
+// forever or use up the memory of the host. A zero limit is no limit.
+type Limits struct {
+	// MaxSteps is how many forms can be evaluated, every function call and
+	// loop iteration is a step
+	MaxSteps int64
+	// MaxDepth is how deeply evaluations can nest, which bounds recursion that
+	// is not in tail position
+	MaxDepth int64
+	// MaxAlloc is the most items a builtin can return in a collection or
+	// characters in a string and the longest lazy seq that can be realized
+	MaxAlloc int64
+}
+
+// The errors returned when an evaluation goes over its limits. They can be
+// matched with errors.Is, or with types.LimitError for any of them.
+var (
+	ErrStepLimit  = types.Errorf(types.LimitError, "evaluation step limit exceeded").With(types.Keyword("limit"), types.Keyword("steps"))
+	ErrDepthLimit = types.Errorf(types.LimitError, "evaluation depth limit exceeded").With(types.Keyword("limit"), types.Keyword("depth"))
+	ErrAllocLimit = types.Errorf(types.LimitError, "allocation size limit exceeded").With(types.Keyword("limit"), types.Keyword("alloc"))
+)
+
+type budgetKey struct{}
+
+// budget counts the steps and depth of evaluations that share a context.
+// Evaluations forked onto other goroutines share the steps but count their
+// own depth.
+type budget struct {
+	depth  int64
+	steps  *int64
+	limits Limits
+}
+
+// WithLimits returns a context that limits evaluations that use it. All of the
+// evaluations with the context share the same steps so each one that should
+// get the full limits needs its own context.
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &budget{steps: new(int64), limits: limits})
+}
+
+// Fork returns a context for evaluating on another goroutine. It is cancelled
+// with ctx and shares its steps but the depth of the new goroutine starts
+// again from zero.
+func Fork(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b := budgetOf(ctx); b != nil {
+		ctx = context.WithValue(ctx, budgetKey{}, &budget{steps: b.steps, limits: b.limits})
+	}
+	return context.WithCancel(ctx)
+}
+
+func budgetOf(ctx context.Context) *budget {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	return b
+}
+
+// enter counts a nested evaluation, leave must be called when it is done
+func (b *budget) enter() error {
+	if depth := atomic.AddInt64(&b.depth, 1); b.limits.MaxDepth > 0 && depth > b.limits.MaxDepth {
+		atomic.AddInt64(&b.depth, -1)
+		return ErrDepthLimit
+	}
+	return nil
+}
+
+func (b *budget) leave() {
+	atomic.AddInt64(&b.depth, -1)
+}
+
+// step checks the context and counts a step of evaluation against the budget,
+// b can be nil if there are no limits.
+func step(ctx context.Context, b *budget) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	} else if b != nil && b.limits.MaxSteps > 0 && atomic.AddInt64(b.steps, 1) > b.limits.MaxSteps {
+		return ErrStepLimit
+	}
+	return nil
+}
+
+func checkContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// Allocate reports an error if a value of size items cannot be made within the
+// limits of ctx or if ctx is done. Builtins that make values outside of the
+// evaluator, like lazy seqs, use it so they are stopped too.
+func Allocate(ctx context.Context, size int) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	} else if b := budgetOf(ctx); b != nil && b.limits.MaxAlloc > 0 && int64(size) > b.limits.MaxAlloc {
+		return ErrAllocLimit
+	}
+	return nil
+}
+
+// sizeOf is the size of a value counted by Allocate
+func sizeOf(val types.Base) int {
+	switch tval := val.(type) {
+	case string:
+		return len(tval)
+	case types.Collection:
+		return tval.Count()
+	case types.Map:
+		return tval.Count()
+	case *types.Set:
+		return tval.Count()
+	case *types.SortedSet:
+		return tval.Count()
+	}
+	return 0
+}
+
+// interrupted reports if the error stopped the evaluation because its context
+// is done, it went over its limits or its transaction has to be retried.
+// try* does not catch these.
+func interrupted(err error) bool {
+	return errors.Is(err, types.LimitError) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, types.ErrRetry)
+}
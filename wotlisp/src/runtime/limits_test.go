@@ -0,0 +1,89 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/tanema/mal/wotlisp/src/core"
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func eval(ctx context.Context, src string) (types.Base, error) {
+	form, err := reader.ReadString(src)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.Eval(ctx, core.NewNamespace(core.Options{Out: ioutil.Discard}), form)
+}
+
+func TestLimits(t *testing.T) {
+	cases := []struct {
+		name     string
+		limits   runtime.Limits
+		src      string
+		expected error
+	}{
+		{"infinite loop", runtime.Limits{MaxSteps: 1000}, `(loop* [i 0] (recur (+ i 1)))`, runtime.ErrStepLimit},
+		{"infinite tail recursion", runtime.Limits{MaxSteps: 1000}, `(do (def! f (fn* [] (f))) (f))`, runtime.ErrStepLimit},
+		{"deep recursion", runtime.Limits{MaxDepth: 100}, `(do (def! f (fn* [n] (+ 1 (f n)))) (f 1))`, runtime.ErrDepthLimit},
+		{"large collection", runtime.Limits{MaxAlloc: 100}, `(apply vector (range 1000))`, runtime.ErrAllocLimit},
+		{"large string", runtime.Limits{MaxAlloc: 100}, `(apply str (repeat 200 "a"))`, runtime.ErrAllocLimit},
+		{"limits are not caught", runtime.Limits{MaxSteps: 1000}, `(try* (loop* [i 0] (recur (+ i 1))) (catch* e :caught))`, runtime.ErrStepLimit},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			val, err := eval(runtime.WithLimits(context.Background(), c.limits), c.src)
+			if !errors.Is(err, c.expected) {
+				t.Fatalf("expected %v, got %v %v", c.expected, val, err)
+			} else if !errors.Is(err, types.LimitError) {
+				t.Fatalf("expected a limit error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLimitsAreDistinct(t *testing.T) {
+	limitErrs := []error{runtime.ErrStepLimit, runtime.ErrDepthLimit, runtime.ErrAllocLimit}
+	for i, err := range limitErrs {
+		for j, other := range limitErrs {
+			if errors.Is(err, other) != (i == j) {
+				t.Errorf("expected errors.Is(%v, %v) to be %v", err, other, i == j)
+			}
+		}
+	}
+}
+
+func TestWithinLimits(t *testing.T) {
+	limits := runtime.Limits{MaxSteps: 10000, MaxDepth: 100, MaxAlloc: 100}
+	val, err := eval(runtime.WithLimits(context.Background(), limits), `(do (def! f (fn* [n] (if (= n 0) 0 (+ 1 (f (- n 1)))))) (f 50))`)
+	if err != nil || val != int64(50) {
+		t.Fatalf("expected 50, got %v %v", val, err)
+	}
+}
+
+func TestContextDone(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timeout, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	cases := []struct {
+		name     string
+		ctx      context.Context
+		expected error
+	}{
+		{"cancelled", cancelled, context.Canceled},
+		{"timeout", timeout, context.DeadlineExceeded},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := eval(c.ctx, `(try* (loop* [i 0] (recur (+ i 1))) (catch* e :caught))`); !errors.Is(err, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/printer"
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+func TestLoopRecur(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{`(loop* [i 0 acc []] (if (< i 3) (recur (+ i 1) (conj acc i)) acc))`, `[0 1 2]`},
+		{`(loop* [[a b] [1 2]] (if (< a 3) (recur [(+ a 1) b]) [a b]))`, `[3 2]`},
+		{`(loop* [i 0] (do (def! last-i i) (if (< i 2) (recur (+ i 1)) last-i)))`, `2`},
+		{`((fn* [n acc] (if (= n 0) acc (recur (- n 1) (* acc n)))) 5 1)`, `120`},
+		{`((fn* [x & more] (if (> x 2) more (recur (+ x 1) [x]))) 0)`, `[2]`},
+		{`((fn* ([] 0) ([n] (if (> n 0) (recur (- n 1)) :done))) 3)`, `:done`},
+		{`(loop* [i 0] (let* [j (+ i 1)] (if (< j 3) (recur j) j)))`, `3`},
+		{`(loop* [i 0] (if (< i 2) (recur (+ i 1)) (loop* [j i] (if (< j 4) (recur (+ j 1)) j))))`, `4`},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			val, err := eval(context.Background(), c.src)
+			if err != nil {
+				t.Fatal(err)
+			} else if printed := printer.Print(val, true); printed != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, printed)
+			}
+		})
+	}
+}
+
+// TestRecurConstantStack checks loops do not nest evaluations, so a long loop
+// runs within a small depth limit.
+func TestRecurConstantStack(t *testing.T) {
+	ctx := runtime.WithLimits(context.Background(), runtime.Limits{MaxDepth: 10})
+	for _, src := range []string{
+		`(loop* [i 0] (if (< i 100000) (recur (+ i 1)) i))`,
+		`((fn* [i] (if (< i 100000) (recur (+ i 1)) i)) 0)`,
+	} {
+		if val, err := eval(ctx, src); err != nil || val != int64(100000) {
+			t.Fatalf("expected %v to reach 100000, got %v %v", src, val, err)
+		}
+	}
+}
+
+// TestRecurErrors checks recur forms that are wrong in the special forms of a
+// body are reported when the fn* or loop* is created, without calling it.
+func TestRecurErrors(t *testing.T) {
+	cases := []struct {
+		src     string
+		errType types.ErrorType
+	}{
+		{`(def! f (fn* [x] (recur)))`, types.ArityError},
+		{`(def! f (fn* [x] (if x (recur 1 2) 0)))`, types.ArityError},
+		{`(def! f (fn* [x & more] (recur x)))`, types.ArityError},
+		{`(def! f (fn* ([x] (recur x)) ([x y] (recur x))))`, types.ArityError},
+		{`(def! f (fn* [x] (loop* [a 1 b 2] (recur a))))`, types.ArityError},
+		{`(def! f (fn* [x] (let* [y 1] (recur x y))))`, types.ArityError},
+		{`(def! f (fn* [x] (do (recur x) x)))`, types.SyntaxError},
+		{`(def! f (fn* [x] (if (recur x) 1 2)))`, types.SyntaxError},
+		{`(def! f (fn* [x] (let* [y (recur x)] y)))`, types.SyntaxError},
+		{`(def! f (fn* [x] (recur (recur x))))`, types.SyntaxError},
+		{`(recur)`, types.SyntaxError},
+		{`(+ 1 (loop* [i 0] (+ 1 (recur i))))`, types.SyntaxError},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			if _, err := eval(context.Background(), c.src); !errors.Is(err, c.errType) {
+				t.Fatalf("expected %v, got %v", c.errType, err)
+			}
+		})
+	}
+}
@@ -1,70 +1,162 @@
 package runtime
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"strings"
 
+	"github.com/tanema/mal/wotlisp/src/interop"
 	"github.com/tanema/mal/wotlisp/src/types"
 )
 
-func Eval(e types.Env, object types.Base) (types.Base, error) {
-	var err error
+// recurTarget is the loop* or fn* that a recur in tail position jumps back to
+type recurTarget struct {
+	params []types.Base
+	env    types.Env
+	body   types.Base
+}
+
+// Eval evaluates the object in the env. The evaluation stops with the error of
+// ctx when it is done and with the limits set on it with WithLimits.
+func Eval(ctx context.Context, e types.Env, object types.Base) (types.Base, error) {
+	return eval(ctx, e, object, nil, nil)
+}
+
+// eval evaluates the object with tail calls, loop* and recur handled in this
+// loop so they do not grow the stack. Anything not in tail position is
+// evaluated with Eval so it has no recur target. frame is the function call
+// being evaluated, it is replaced by tail calls and added to the stack of any
+// error that escapes. Every iteration is a step checked against ctx.
+func eval(ctx context.Context, e types.Env, object types.Base, target *recurTarget, frame *types.Frame) (result types.Base, err error) {
+	b := budgetOf(ctx)
+	if b != nil {
+		if err := b.enter(); err != nil {
+			return nil, err
+		}
+		defer b.leave()
+	}
+
+	// form is the innermost form with a source position, errors that do not
+	// already have a position are reported at it.
+	form := object
+	defer func() {
+		if err != nil {
+			err = withPosition(err, form)
+			if frame != nil {
+				err = withFrame(err, *frame)
+			}
+		}
+	}()
+
 	for {
-		object, err = macroExpand(e, object)
+		if err = step(ctx, b); err != nil {
+			return nil, err
+		}
+		object, err = seqForm(object)
+		if err != nil {
+			return nil, err
+		}
+		if _, hasPos := types.PositionOf(object); hasPos {
+			form = object
+		}
+		object, err = macroExpand(ctx, e, object)
 		if err != nil {
 			return nil, err
 		}
 
 		switch tobject := object.(type) {
 		case *types.List:
-			if len(tobject.Forms) == 0 {
+			if tobject.Count() == 0 {
 				return tobject, nil
 			}
-			sym, _ := tobject.Forms[0].(types.Symbol)
+			forms := tobject.Data()
+			sym, _ := forms[0].(types.Symbol)
 			switch sym {
 			case "try*":
-				object, err = evalTry(e, tobject.Forms[1:]...)
+				return evalTry(ctx, e, forms[1:]...)
 			case "quote":
-				if len(tobject.Forms) < 2 {
+				if len(forms) < 2 {
 					return nil, nil
 				}
-				return tobject.Forms[1], nil
+				return forms[1], nil
 			case "quasiquote":
-				object = evalQuasiQuote(e, tobject.Forms[1])
+				if len(forms) < 2 {
+					return nil, types.Errorf(types.SyntaxError, "not enough arguments for quasiquote call")
+				}
+				object = evalQuasiQuote(e, forms[1])
 			case "do":
-				object, err = evalDo(e, tobject.Forms[1:]...)
+				object, err = evalDo(ctx, e, forms[1:]...)
 			case "if":
-				object, err = evalIf(e, tobject.Forms[1:]...)
+				object, err = evalIf(ctx, e, forms[1:]...)
 			case "defmacro!":
-				return evalDefMacro(e, tobject.Forms[1:]...)
+				return evalDefMacro(ctx, e, forms[1:]...)
 			case "macroexpand":
-				return macroExpand(e, tobject.Forms[1])
+				if len(forms) < 2 {
+					return nil, types.Errorf(types.SyntaxError, "not enough arguments for macroexpand call")
+				}
+				return macroExpand(ctx, e, forms[1])
 			case "fn*":
-				return types.NewFunc(e, Eval, tobject.Forms[1:]...)
+				return newFunc(e, forms[1:]...)
+			case "lazy-seq":
+				return evalLazySeq(ctx, e, forms[1:]...), nil
 			case "def!":
-				return evalDef(e, tobject.Forms[1:]...)
+				return evalDef(ctx, e, forms[1:]...)
+			case "binding":
+				return evalBinding(ctx, e, forms[1:]...)
+			case "set!":
+				return evalSetVar(ctx, e, forms[1:]...)
 			case "let*":
-				object, e, err = evalLet(e, tobject.Forms[1:]...)
+				object, e, err = evalLet(ctx, e, forms[1:]...)
+			case "loop*":
+				target, err = evalLoop(ctx, e, forms[1:]...)
+				if err == nil {
+					object, e = target.body, target.env
+				}
+			case "recur":
+				object, e, err = evalRecur(ctx, e, target, forms[1:]...)
+			case ".":
+				return evalDot(ctx, e, forms[1:]...)
 			default:
-				lst, err := evalAST(e, tobject)
+				if strings.HasPrefix(string(sym), ".-") && len(sym) > 2 {
+					return evalField(ctx, e, string(sym[2:]), forms[1:]...)
+				}
+				lst, err := evalAST(ctx, e, tobject)
 				if err != nil {
 					return nil, err
 				}
-				list := lst.(*types.List)
-				switch fn := list.Forms[0].(type) {
+				list := lst.(*types.List).Data()
+				switch fn := list[0].(type) {
 				case *types.StdFunc:
-					return fn.Fn(e, list.Forms[1:])
+					val, err := fn.Fn(types.WithContext(e, ctx), list[1:])
+					if err == nil {
+						err = Allocate(ctx, sizeOf(val))
+					}
+					if err != nil {
+						return nil, withFrame(withPosition(err, form), *callFrame(forms[0], "", form))
+					}
+					return val, nil
 				case *types.ExtFunc:
-					newEnv, err := fn.Env.Child(fn.Params, list.Forms[1:])
+					arity, err := fn.Dispatch(list[1:])
 					if err != nil {
 						return nil, err
 					}
-					object, e = fn.AST, newEnv
+					newEnv, err := bindParams(ctx, fn.Env, arity.Params, list[1:])
+					if err != nil {
+						return nil, err
+					}
+					elided := 0
+					if frame != nil {
+						elided = frame.Elided + 1
+					}
+					frame = callFrame(forms[0], fn.Name, form)
+					frame.Elided = elided
+					object, e, target = arity.AST, newEnv, arityTarget(fn, arity)
 				default:
-					return nil, fmt.Errorf("attempt to call non-function %v", list.Forms[0])
+					return types.CallFunc(types.WithContext(e, ctx), fn, list[1:])
 				}
 			}
 		default:
-			return evalAST(e, tobject)
+			return evalAST(ctx, e, tobject)
 		}
 
 		if err != nil {
@@ -73,135 +165,653 @@ func Eval(e types.Env, object types.Base) (types.Base, error) {
 	}
 }
 
-func evalAST(env types.Env, ast types.Base) (types.Base, error) {
+func evalAST(ctx context.Context, env types.Env, ast types.Base) (types.Base, error) {
 	switch tobject := ast.(type) {
 	case types.Symbol:
 		symVal, err := env.Get(tobject)
 		if err != nil {
 			return nil, err
+		} else if v, isVar := symVal.(*types.Var); isVar {
+			return v.Value(ctx), nil
 		}
 		return symVal, nil
 	case *types.List:
-		lst, err := evalListForms(tobject.Data(), env)
-		return &types.List{Forms: lst}, err
+		lst, err := evalListForms(ctx, tobject.Data(), env)
+		return types.NewList(lst...), err
 	case *types.Vector:
-		lst, err := evalListForms(tobject.Forms, env)
-		return &types.Vector{Forms: lst}, err
+		lst, err := evalListForms(ctx, tobject.Data(), env)
+		return types.NewVect(lst...), err
 	case *types.Hashmap:
-		lst, err := evalListForms(tobject.ToList(), env)
+		lst, err := evalListForms(ctx, tobject.ToList(), env)
 		if err != nil {
 			return nil, err
 		}
 		return types.NewHashmap(lst)
+	case *types.Set:
+		lst, err := evalListForms(ctx, tobject.Data(), env)
+		return types.NewSet(lst...), err
 	default:
 		return ast, nil
 	}
 }
 
-func evalTry(e types.Env, args ...types.Base) (types.Base, error) {
+// evalTry evaluates (try* body... (catch* type e handler...)... (finally* cleanup...)).
+// The first catch* whose type matches the error handles it. The type is a
+// keyword matched against the :type of the error data, :default to match
+// anything, a form like (fn* [e] ...) that evaluates to a predicate called with
+// the error, or a vector of types any of which can match. A catch* with only a
+// symbol catches everything. The finally* forms always run after the body and any
+// handler but their value is ignored. Errors from a done context or going over
+// the limits are never caught.
+func evalTry(ctx context.Context, e types.Env, args ...types.Base) (result types.Base, err error) {
 	if len(args) < 1 {
-		return nil, fmt.Errorf("not enough arguments")
+		return nil, types.Errorf(types.SyntaxError, "not enough arguments for try* call")
 	}
 
-	var catch []types.Base
-	var catchDefined bool
+	body, catches, finally, err := tryClauses(args)
+	if err != nil {
+		return nil, err
+	}
+	if finally != nil {
+		defer func() {
+			if _, finallyErr := evalBody(ctx, e, finally); finallyErr != nil {
+				result, err = nil, finallyErr
+			}
+		}()
+	}
+
+	val, evalErr := evalBody(ctx, e, body)
+	if lazy, isLazy := val.(*types.LazySeq); isLazy && evalErr == nil {
+		// realize the first cell of lazy results so an error raised before
+		// anything is produced is still caught by this try. The rest is left
+		// lazy, like clojure, so an infinite seq can still be returned.
+		_, evalErr = types.ToSeq(lazy)
+	}
+	if evalErr == nil {
+		return val, nil
+	} else if interrupted(evalErr) {
+		return nil, evalErr
+	}
 
-	if len(args) > 1 {
-		catch, catchDefined = isPair(args[1])
-		if catchDefined {
-			catchSym, isCatchSym := catch[0].(types.Symbol)
-			_, isErrSym := catch[1].(types.Symbol)
-			if len(catch) < 3 || !isCatchSym || catchSym != "catch*" || !isErrSym {
-				return nil, fmt.Errorf("invalid catch declaration")
+	thrown := CaughtValue(evalErr)
+	for _, catch := range catches {
+		if catch.test != nil {
+			matched, err := catchMatches(ctx, e, catch.test, thrown)
+			if err != nil {
+				return nil, err
+			} else if !matched {
+				continue
 			}
 		}
+		newEnv := e.Child()
+		newEnv.Set(catch.sym, thrown)
+		return evalBody(ctx, newEnv, catch.body)
 	}
+	return nil, evalErr
+}
+
+// catchClause is a parsed (catch* test sym body...) or (catch* sym body...)
+// which has no test and catches everything.
+type catchClause struct {
+	test types.Base
+	sym  types.Symbol
+	body []types.Base
+}
 
-	val, evalErr := Eval(e, args[0])
-	if evalErr != nil && catchDefined {
-		binds := []types.Base{catch[1].(types.Symbol)}
-		exprs := []types.Base{string(evalErr.Error())}
-		if userErr, isUserErr := evalErr.(types.UserError); isUserErr {
-			exprs = []types.Base{userErr.Val}
+// tryClauses splits the arguments of try* into the body, the catch* clauses
+// and the forms of the finally* clause.
+func tryClauses(args []types.Base) (body []types.Base, catches []catchClause, finally []types.Base, err error) {
+	for i, arg := range args {
+		var head types.Symbol
+		clause, isClause := isPair(arg)
+		if isClause {
+			head, _ = clause[0].(types.Symbol)
 		}
-		newEnv, err := e.Child(binds, exprs)
-		if err != nil {
+		switch {
+		case head == "catch*":
+			if finally != nil {
+				return nil, nil, nil, types.Errorf(types.SyntaxError, "finally* must be the last clause of try*")
+			}
+			catch, err := parseCatch(clause)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			catches = append(catches, catch)
+		case head == "finally*":
+			if finally != nil {
+				return nil, nil, nil, types.Errorf(types.SyntaxError, "try* can only have one finally* clause")
+			}
+			finally = clause[1:]
+		case len(catches) > 0 || finally != nil:
+			return nil, nil, nil, types.Errorf(types.SyntaxError, "only catch* and finally* clauses can follow the body of try*")
+		default:
+			body = args[:i+1]
+		}
+	}
+	return body, catches, finally, nil
+}
+
+// parseCatch reads a catch* clause. It has a test if the first form is a
+// keyword, a list or a vector followed by a symbol, otherwise the first form
+// is the symbol bound to the error.
+func parseCatch(clause []types.Base) (catchClause, error) {
+	if len(clause) >= 4 && isCatchTest(clause[1]) {
+		if sym, isSym := clause[2].(types.Symbol); isSym {
+			return catchClause{test: clause[1], sym: sym, body: clause[3:]}, nil
+		}
+	}
+	if len(clause) < 3 {
+		return catchClause{}, types.Errorf(types.SyntaxError, "invalid catch declaration")
+	}
+	sym, isSym := clause[1].(types.Symbol)
+	if !isSym {
+		return catchClause{}, types.Errorf(types.SyntaxError, "invalid catch declaration")
+	}
+	return catchClause{sym: sym, body: clause[2:]}, nil
+}
+
+func isCatchTest(form types.Base) bool {
+	switch form.(type) {
+	case types.Keyword, *types.List, *types.Vector:
+		return true
+	}
+	return false
+}
+
+// catchMatches reports if the thrown value matches the test of a catch*
+func catchMatches(ctx context.Context, e types.Env, test, thrown types.Base) (bool, error) {
+	switch ttest := test.(type) {
+	case types.Keyword:
+		return ttest == "default" || ttest == errorType(thrown), nil
+	case *types.Vector:
+		for _, alt := range ttest.Data() {
+			if matched, err := catchMatches(ctx, e, alt, thrown); err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+	pred, err := Eval(ctx, e, test)
+	if err != nil {
+		return false, err
+	}
+	result, err := types.CallFunc(types.WithContext(e, ctx), pred, []types.Base{thrown})
+	return result != nil && result != false, err
+}
+
+// errorType is the :type in the data of an ex-info or a thrown map
+func errorType(thrown types.Base) types.Base {
+	if exInfo, isExInfo := thrown.(*types.ExInfo); isExInfo {
+		thrown = exInfo.Data
+	}
+	if hmap, isMap := thrown.(types.Map); isMap {
+		val, _ := hmap.Get(types.Keyword("type"))
+		return val
+	}
+	return nil
+}
+
+// CaughtValue is the value bound by catch*. It is the value that was thrown
+// or any other error as a map of its :type, :message and :data. Errors that
+// are not categorised have the type :error. The call stack the error unwound
+// through is the :stack of the map, or the stack of a thrown ex-info.
+func CaughtValue(err error) types.Base {
+	var userErr types.UserError
+	var wotErr *types.Error
+	var srcErr types.SourceError
+	stack := StackTrace(err)
+	if errors.As(err, &userErr) {
+		if exInfo, isExInfo := userErr.Val.(*types.ExInfo); isExInfo && stack != nil {
+			caught := *exInfo
+			caught.Stack = stack
+			return &caught
+		}
+		return userErr.Val
+	} else if errors.As(err, &wotErr) {
+		return withStack(wotErr.Map(), stack)
+	} else if errors.As(err, &srcErr) {
+		err = srcErr.Err
+	}
+	return withStack((&types.Error{Type: "error", Message: err.Error()}).Map(), stack)
+}
+
+func withStack(hmap *types.Hashmap, stack types.Base) *types.Hashmap {
+	if stack == nil {
+		return hmap
+	}
+	withStack, _ := hmap.Assoc(types.Keyword("stack"), stack)
+	return withStack
+}
+
+// StackTrace is the call stack of an error as a vector of maps with the :name
+// of each function, where it was called from and how many tail calls it
+// replaced. It is nil if the error has no stack.
+func StackTrace(err error) types.Base {
+	var stackErr *types.StackError
+	if !errors.As(err, &stackErr) {
+		return nil
+	}
+	frames := make([]types.Base, len(stackErr.Frames))
+	for i, frame := range stackErr.Frames {
+		values := []types.Base{types.Keyword("name"), frame.Name, types.Keyword("elided"), int64(frame.Elided)}
+		if frame.HasPos {
+			values = append(values, types.Keyword("line"), int64(frame.Pos.Line), types.Keyword("column"), int64(frame.Pos.Column))
+			if frame.Pos.File != "" {
+				values = append(values, types.Keyword("file"), frame.Pos.File)
+			}
+		}
+		frames[i], _ = types.NewHashmap(values)
+	}
+	return types.NewVect(frames...)
+}
+
+// evalBody evaluates the forms in order and returns the value of the last one
+func evalBody(ctx context.Context, e types.Env, forms []types.Base) (result types.Base, err error) {
+	for _, form := range forms {
+		if result, err = Eval(ctx, e, form); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// evalDot evaluates (. obj Method args...) or (. obj (Method args...)) which
+// calls a method of a wrapped go value.
+func evalDot(ctx context.Context, e types.Env, args ...types.Base) (types.Base, error) {
+	if len(args) < 2 {
+		return nil, types.Errorf(types.SyntaxError, "improperly formatted . statement")
+	}
+	method, methodArgs := args[1], args[2:]
+	if call, isList := method.(*types.List); isList && call.Count() > 0 && len(args) == 2 {
+		data := call.Data()
+		method, methodArgs = data[0], data[1:]
+	}
+	name, isSym := method.(types.Symbol)
+	if !isSym {
+		return nil, types.Errorf(types.SyntaxError, "method name must be a symbol")
+	}
+	obj, err := Eval(ctx, e, args[0])
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]types.Base, len(methodArgs))
+	for i, arg := range methodArgs {
+		if vals[i], err = Eval(ctx, e, arg); err != nil {
 			return nil, err
 		}
-		return Eval(newEnv, catch[2])
 	}
+	return interop.CallMethod(types.WithContext(e, ctx), obj, string(name), vals)
+}
 
-	return val, evalErr
+// evalField evaluates (.-Field obj) which reads a field of a wrapped go struct
+func evalField(ctx context.Context, e types.Env, name string, args ...types.Base) (types.Base, error) {
+	if len(args) != 1 {
+		return nil, types.Errorf(types.SyntaxError, "improperly formatted .-%v statement", name)
+	}
+	obj, err := Eval(ctx, e, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return interop.Field(obj, name)
 }
 
-func evalDefMacro(e types.Env, args ...types.Base) (types.Base, error) {
-	val, err := evalDef(e, args...)
+func evalDefMacro(ctx context.Context, e types.Env, args ...types.Base) (types.Base, error) {
+	val, err := evalDef(ctx, e, args...)
 	if err != nil {
 		return nil, err
 	}
 	fn, ok := val.(*types.ExtFunc)
 	if !ok {
-		return nil, fmt.Errorf("non-func value passed to defmacro")
+		return nil, types.Errorf(types.TypeError, "non-func value passed to defmacro")
 	}
 	fn.IsMacro = true
 	return fn, nil
 }
 
-func evalDef(e types.Env, args ...types.Base) (types.Base, error) {
+// evalDef evaluates (def! name value). (def! ^:dynamic name value) defines a
+// var that can be rebound with binding. Defining a name that is already a var
+// in the same env sets the root value of the var.
+func evalDef(ctx context.Context, e types.Env, args ...types.Base) (types.Base, error) {
 	if len(args) < 2 {
-		return nil, fmt.Errorf("not enough arguments")
+		return nil, types.Errorf(types.SyntaxError, "not enough arguments for def! call")
 	}
 
-	name, ok := args[0].(types.Symbol)
+	name, dynamic, ok := defName(args[0])
 	if !ok {
-		return nil, fmt.Errorf("non-symbol bind value")
+		return nil, types.Errorf(types.SyntaxError, "non-symbol bind value")
+	}
+	value, err := Eval(ctx, e, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if fn, isFn := value.(*types.ExtFunc); isFn && fn.Name == "" {
+		fn.Name = string(name)
+	}
+	if e.Find(name) == e {
+		if existing, _ := e.Get(name); existing != nil {
+			if v, isVar := existing.(*types.Var); isVar {
+				v.SetRoot(value)
+				return value, nil
+			}
+		}
 	}
-	value, err := Eval(e, args[1])
-	if err == nil {
+	if dynamic {
+		e.Set(name, types.NewVar(name, value, true))
+	} else {
 		e.Set(name, value)
 	}
-	return value, err
+	return value, nil
 }
 
-func evalLet(e types.Env, args ...types.Base) (types.Base, types.Env, error) {
-	if len(args) < 2 {
-		return nil, nil, fmt.Errorf("not enough arguments for  let* call")
+// defName is the name defined by def! and if it was marked ^:dynamic, which
+// the reader reads as (with-meta name :dynamic)
+func defName(form types.Base) (types.Symbol, bool, bool) {
+	if name, ok := form.(types.Symbol); ok {
+		return name, false, true
+	}
+	lst, ok := form.(*types.List)
+	if !ok || lst.Count() != 3 || lst.Data()[0] != types.Symbol("with-meta") {
+		return "", false, false
+	}
+	name, ok := lst.Data()[1].(types.Symbol)
+	switch meta := lst.Data()[2].(type) {
+	case types.Keyword:
+		return name, meta == "dynamic", ok
+	case types.Map:
+		dynamic, _ := meta.Get(types.Keyword("dynamic"))
+		return name, dynamic != nil && dynamic != false, ok
 	}
-	newEnv, err := e.Child(nil, nil)
+	return name, false, ok
+}
+
+// lookupVar finds the dynamic var named by a symbol for binding and set!
+func lookupVar(e types.Env, form types.Base) (*types.Var, error) {
+	name, ok := form.(types.Symbol)
+	if !ok {
+		return nil, types.Errorf(types.SyntaxError, "non-symbol bind value")
+	}
+	val, err := e.Get(name)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	v, isVar := val.(*types.Var)
+	if !isVar || !v.Dynamic {
+		return nil, types.Errorf(types.StateError, "%v is not a dynamic var", name)
 	}
+	return v, nil
+}
+
+// evalBinding evaluates (binding [var value...] body...). The values are
+// evaluated first, then the body is evaluated with the vars bound to them.
+func evalBinding(ctx context.Context, e types.Env, args ...types.Base) (types.Base, error) {
+	if len(args) < 1 {
+		return nil, types.Errorf(types.SyntaxError, "not enough arguments for binding call")
+	}
+	bindings, ok := args[0].(types.Collection)
+	if !ok || bindings.Count()%2 == 1 {
+		return nil, types.Errorf(types.SyntaxError, "invalid binding definition")
+	}
+	definitions := bindings.Data()
+	vals := make(map[*types.Var]types.Base, len(definitions)/2)
+	for i := 0; i < len(definitions); i += 2 {
+		v, err := lookupVar(e, definitions[i])
+		if err != nil {
+			return nil, err
+		}
+		if vals[v], err = Eval(ctx, e, definitions[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return evalBody(types.WithBindings(ctx, vals), e, args[1:])
+}
+
+// evalSetVar evaluates (set! var value) which changes the value of a var in
+// the binding it is in
+func evalSetVar(ctx context.Context, e types.Env, args ...types.Base) (types.Base, error) {
+	if len(args) != 2 {
+		return nil, types.Errorf(types.SyntaxError, "improperly formatted set! statement")
+	}
+	v, err := lookupVar(e, args[0])
+	if err != nil {
+		return nil, err
+	}
+	value, err := Eval(ctx, e, args[1])
+	if err != nil {
+		return nil, err
+	}
+	return value, v.Set(ctx, value)
+}
+
+func evalLet(ctx context.Context, e types.Env, args ...types.Base) (types.Base, types.Env, error) {
+	if len(args) < 2 {
+		return nil, nil, types.Errorf(types.SyntaxError, "not enough arguments for let* call")
+	}
+	newEnv := e.Child()
 
 	var definitions []types.Base
 	switch lst := args[0].(type) {
 	case types.Collection:
 		definitions = lst.Data()
 	default:
-		return nil, nil, fmt.Errorf("invalid let* environment definition")
+		return nil, nil, types.Errorf(types.SyntaxError, "invalid let* environment definition")
 	}
 
+	if err := evalBindings(ctx, newEnv, definitions); err != nil {
+		return nil, nil, err
+	}
+
+	return args[1], newEnv, nil
+}
+
+// evalBindings evaluates each value in order and binds it to its binding form
+// so later values can refer to earlier bindings.
+func evalBindings(ctx context.Context, e types.Env, definitions []types.Base) error {
+	if len(definitions)%2 == 1 {
+		return types.Errorf(types.SyntaxError, "bindings require an even number of forms")
+	}
 	for i := 0; i < len(definitions); i += 2 {
-		if _, err := evalDef(newEnv, definitions[i:]...); err != nil {
-			return nil, nil, err
+		value, err := Eval(ctx, e, definitions[i+1])
+		if err != nil {
+			return err
+		} else if err := bind(ctx, e, definitions[i], value); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return args[1], newEnv, nil
+func newFunc(e types.Env, args ...types.Base) (*types.ExtFunc, error) {
+	var fn *types.ExtFunc
+	fn, err := types.NewFunc(e, func(ctx context.Context, env types.Env, arity *types.Arity, arguments []types.Base) (types.Base, error) {
+		newEnv, err := bindParams(ctx, env, arity.Params, arguments)
+		if err != nil {
+			return nil, err
+		}
+		return eval(ctx, newEnv, arity.AST, arityTarget(fn, arity), &types.Frame{Name: funcName(fn.Name, nil)})
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, arity := range fn.Arities {
+		count := len(arity.Params)
+		if arity.Variadic {
+			count--
+		}
+		if err := checkRecur(arity.AST, count); err != nil {
+			return nil, err
+		}
+	}
+	return fn, nil
+}
+
+func arityTarget(fn *types.ExtFunc, arity *types.Arity) *recurTarget {
+	return &recurTarget{params: arity.Params, env: fn.Env, body: arity.AST}
 }
 
-func evalDo(e types.Env, args ...types.Base) (types.Base, error) {
-	_, err := evalAST(e, types.NewList(args[:len(args)-1]...))
+// evalLoop binds the initial values of a loop* like let* does and returns the
+// target that recur will jump back to. The env of the returned target holds
+// the first bindings.
+func evalLoop(ctx context.Context, e types.Env, args ...types.Base) (*recurTarget, error) {
+	if len(args) < 1 {
+		return nil, types.Errorf(types.SyntaxError, "not enough arguments for loop* call")
+	}
+	bindings, ok := args[0].(types.Collection)
+	if !ok || bindings.Count()%2 == 1 {
+		return nil, types.Errorf(types.SyntaxError, "invalid loop* binding definition")
+	}
+
+	body := loopBody(args[1:])
+	if err := checkRecur(body, bindings.Count()/2); err != nil {
+		return nil, err
+	}
+
+	definitions := bindings.Data()
+	params := []types.Base{}
+	loopEnv := e.Child()
+	if err := evalBindings(ctx, loopEnv, definitions); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(definitions); i += 2 {
+		params = append(params, definitions[i])
+	}
+	return &recurTarget{params: params, env: loopEnv, body: body}, nil
+}
+
+// loopBody is the body of a loop*, several forms are evaluated in a do
+func loopBody(forms []types.Base) types.Base {
+	switch len(forms) {
+	case 0:
+		return nil
+	case 1:
+		return forms[0]
+	default:
+		return types.NewList(append([]types.Base{types.Symbol("do")}, forms...)...)
+	}
+}
+
+// checkRecur checks the recur forms of a fn* or loop* body when it is created
+// rather than when it runs. A recur in tail position must pass count values
+// and a recur anywhere else in the special forms of the body is an error. The
+// arguments of function and macro calls are not looked into, so a recur that
+// a macro puts in tail position is still only checked when it runs.
+func checkRecur(form types.Base, count int) error {
+	lst, ok := form.(*types.List)
+	if !ok || lst.Count() == 0 {
+		return nil
+	}
+	forms := lst.Data()
+	sym, _ := forms[0].(types.Symbol)
+	args := forms[1:]
+	switch sym {
+	case "recur":
+		if len(args) != count {
+			return withPosition(types.Errorf(types.ArityError, "recur expected %v arguments, got %v", count, len(args)), form)
+		}
+		return checkNotRecur(args...)
+	case "do":
+		if len(args) == 0 {
+			return nil
+		} else if err := checkNotRecur(args[:len(args)-1]...); err != nil {
+			return err
+		}
+		return checkRecur(args[len(args)-1], count)
+	case "if":
+		if len(args) == 0 {
+			return nil
+		} else if err := checkNotRecur(args[0]); err != nil {
+			return err
+		}
+		for i := 1; i < len(args) && i < 3; i++ {
+			if err := checkRecur(args[i], count); err != nil {
+				return err
+			}
+		}
+	case "let*":
+		if len(args) < 2 {
+			return nil
+		} else if bindings, ok := args[0].(types.Collection); ok {
+			if err := checkNotRecur(bindings.Data()...); err != nil {
+				return err
+			}
+		}
+		return checkRecur(args[1], count)
+	case "loop*":
+		if len(args) < 1 {
+			return nil
+		}
+		bindings, ok := args[0].(types.Collection)
+		if !ok || bindings.Count()%2 == 1 {
+			return nil
+		} else if err := checkNotRecur(bindings.Data()...); err != nil {
+			return err
+		}
+		return checkRecur(loopBody(args[1:]), bindings.Count()/2)
+	}
+	return nil
+}
+
+// checkNotRecur reports an error if any of the forms is a recur, they are not
+// in tail position.
+func checkNotRecur(forms ...types.Base) error {
+	for _, form := range forms {
+		if lst, ok := form.(*types.List); ok && lst.Count() > 0 && lst.First() == types.Symbol("recur") {
+			return withPosition(types.Errorf(types.SyntaxError, "recur can only be used in tail position of loop* or fn*"), form)
+		}
+	}
+	return nil
+}
+
+// evalRecur evaluates the new values for the recur target and returns its
+// body with an env that binds them. The target env is only used as the parent
+// so each iteration gets fresh bindings.
+func evalRecur(ctx context.Context, e types.Env, target *recurTarget, args ...types.Base) (types.Base, types.Env, error) {
+	if target == nil {
+		return nil, nil, types.Errorf(types.SyntaxError, "recur can only be used in tail position of loop* or fn*")
+	}
+	binds := []types.Base{}
+	for _, param := range target.params {
+		if sym, ok := param.(types.Symbol); !ok || sym != "&" {
+			binds = append(binds, param)
+		}
+	}
+	if len(args) != len(binds) {
+		return nil, nil, types.Errorf(types.ArityError, "recur expected %v arguments, got %v", len(binds), len(args))
+	}
+	vals, err := evalListForms(ctx, args, e)
+	if err != nil {
+		return nil, nil, err
+	}
+	newEnv, err := bindParams(ctx, target.env, binds, vals)
+	return target.body, newEnv, err
+}
+
+// evalLazySeq makes a lazy seq of the body, it is realized with the context of
+// the evaluation that made it.
+func evalLazySeq(ctx context.Context, e types.Env, body ...types.Base) *types.LazySeq {
+	return types.NewLazySeq(func() (types.Base, error) {
+		if len(body) == 0 {
+			return nil, nil
+		}
+		return Eval(ctx, e, types.NewList(append([]types.Base{types.Symbol("do")}, body...)...))
+	})
+}
+
+func evalDo(ctx context.Context, e types.Env, args ...types.Base) (types.Base, error) {
+	if len(args) < 1 {
+		return nil, types.Errorf(types.SyntaxError, "not enough arguments for do call")
+	}
+	_, err := evalAST(ctx, e, types.NewList(args[:len(args)-1]...))
 	if err != nil {
 		return nil, err
 	}
 	return args[len(args)-1], nil
 }
 
-func evalIf(e types.Env, args ...types.Base) (types.Base, error) {
+func evalIf(ctx context.Context, e types.Env, args ...types.Base) (types.Base, error) {
 	if len(args) < 2 {
-		return nil, fmt.Errorf("improperly formatted if statement")
+		return nil, types.Errorf(types.SyntaxError, "improperly formatted if statement")
 	}
-	if condition, err := evalBool(e, args[0]); err != nil {
+	if condition, err := evalBool(ctx, e, args[0]); err != nil {
 		return nil, err
 	} else if condition {
 		return args[1], nil
@@ -211,8 +821,8 @@ func evalIf(e types.Env, args ...types.Base) (types.Base, error) {
 	return nil, nil
 }
 
-func evalBool(e types.Env, condition types.Base) (bool, error) {
-	value, err := Eval(e, condition)
+func evalBool(ctx context.Context, e types.Env, condition types.Base) (bool, error) {
+	value, err := Eval(ctx, e, condition)
 	if err != nil {
 		return false, err
 	}
@@ -242,11 +852,11 @@ func evalQuasiQuote(e types.Env, object types.Base) types.Base {
 	return types.NewList(types.Symbol("cons"), evalQuasiQuote(e, pair[0]), evalQuasiQuote(e, types.NewList(pair[1:]...)))
 }
 
-func evalListForms(values []types.Base, env types.Env) ([]types.Base, error) {
+func evalListForms(ctx context.Context, values []types.Base, env types.Env) ([]types.Base, error) {
 	var err error
 	forms := make([]types.Base, len(values))
 	for i, form := range values {
-		forms[i], err = Eval(env, form)
+		forms[i], err = Eval(ctx, env, form)
 		if err != nil {
 			return forms, err
 		}
@@ -265,11 +875,11 @@ func isPair(val types.Base) ([]types.Base, bool) {
 
 func isMacroCall(e types.Env, ast types.Base) (*types.List, bool) {
 	lst, isList := ast.(*types.List)
-	if !isList || len(lst.Forms) == 0 {
+	if !isList || lst.Count() == 0 {
 		return lst, false
 	}
 
-	sym, ok := lst.Forms[0].(types.Symbol)
+	sym, ok := lst.First().(types.Symbol)
 	if !ok {
 		return lst, false
 	}
@@ -287,16 +897,95 @@ func isMacroCall(e types.Env, ast types.Base) (*types.List, bool) {
 	return lst, fn.IsMacro
 }
 
-func macroExpand(e types.Env, ast types.Base) (types.Base, error) {
+func macroExpand(ctx context.Context, e types.Env, ast types.Base) (types.Base, error) {
 	list, is := isMacroCall(e, ast)
 	for ; is; list, is = isMacroCall(e, ast) {
 		var err error
-		sym := list.Forms[0].(types.Symbol)
+		sym := list.First().(types.Symbol)
 		val, _ := e.Get(sym)
-		ast, err = val.(*types.ExtFunc).Apply(list.Forms[1:])
+		ast, err = val.(*types.ExtFunc).Apply(ctx, list.Rest().Data())
 		if err != nil {
 			return nil, err
 		}
+		if ast, err = seqForm(ast); err != nil {
+			return nil, err
+		}
 	}
 	return ast, nil
 }
+
+// seqForm turns lazy seqs and cons cells, like those built by concat in
+// quasiquote, into lists so they can be evaluated as code
+func seqForm(ast types.Base) (types.Base, error) {
+	if !types.IsSeq(ast) {
+		return ast, nil
+	}
+	data, err := types.SeqData(ast)
+	return types.NewList(data...), err
+}
+
+// withPosition wraps the error with the position of the form unless the error
+// already came from a more specific position.
+func withPosition(err error, form types.Base) error {
+	var srcErr types.SourceError
+	if errors.As(err, &srcErr) {
+		return err
+	} else if pos, hasPos := unboundSymbolPosition(err, form); hasPos {
+		return types.SourceError{Err: err, Pos: pos}
+	} else if pos, hasPos := types.PositionOf(form); hasPos {
+		return types.SourceError{Err: err, Pos: pos}
+	}
+	return err
+}
+
+// unboundSymbolPosition is the position of the symbol that was not found if it
+// is in the form
+func unboundSymbolPosition(err error, form types.Base) (types.Position, bool) {
+	var wotErr *types.Error
+	if !errors.As(err, &wotErr) || wotErr.Type != types.UnboundSymbolError {
+		return types.Position{}, false
+	}
+	data, _ := wotErr.Data.(types.Map)
+	if data == nil {
+		return types.Position{}, false
+	}
+	sym, _ := data.Get(types.Keyword("symbol"))
+	if sym, isSym := sym.(types.Symbol); isSym {
+		return types.SymbolPosition(form, sym)
+	}
+	return types.Position{}, false
+}
+
+// withFrame adds the frame to the stack of the error as it unwinds. The error
+// is copied since errors kept by futures and lazy seqs are raised again every
+// time they are used, maybe by several goroutines at once.
+func withFrame(err error, frame types.Frame) error {
+	var stackErr *types.StackError
+	switch terr := err.(type) {
+	case *types.StackError:
+		frames := make([]types.Frame, len(terr.Frames), len(terr.Frames)+1)
+		copy(frames, terr.Frames)
+		return &types.StackError{Err: terr.Err, Frames: append(frames, frame)}
+	case types.SourceError:
+		if errors.As(terr.Err, &stackErr) {
+			return types.SourceError{Err: withFrame(terr.Err, frame), Pos: terr.Pos}
+		}
+	}
+	return &types.StackError{Err: err, Frames: []types.Frame{frame}}
+}
+
+// callFrame creates the frame for calling a function named name, or the
+// symbol it was called with, from the call site form
+func callFrame(head types.Base, name string, site types.Base) *types.Frame {
+	pos, hasPos := types.PositionOf(site)
+	return &types.Frame{Name: funcName(name, head), Pos: pos, HasPos: hasPos}
+}
+
+func funcName(name string, head types.Base) string {
+	if name != "" {
+		return name
+	} else if sym, isSym := head.(types.Symbol); isSym {
+		return string(sym)
+	}
+	return "fn"
+}
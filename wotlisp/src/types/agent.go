@@ -0,0 +1,187 @@
+package types
+
+import (
+	"context"
+	goruntime "runtime"
+	"sync"
+)
+
+// agentPool limits how many actions sent with send run at once. Actions sent
+// with send-off may block on io so they are not limited.
+var agentPool = make(chan struct{}, goruntime.NumCPU()+2)
+
+// Agent is a reference whose value is changed by actions sent to it. Actions
+// run one at a time, in the order they were sent, on a goroutine of their own.
+// The state is kept in an atom so new values go through the validator and
+// watches the same way. An action that fails stops the agent until it is
+// restarted.
+type Agent struct {
+	state   *Atom
+	mu      sync.Mutex
+	queue   []agentAction
+	running bool
+	err     error
+}
+
+// agentAction is an action sent to an agent, or a marker used by await when
+// done is set
+type agentAction struct {
+	e      Env
+	fn     Base
+	args   []Base
+	pooled bool
+	done   chan error
+}
+
+func NewAgent(val Base) *Agent {
+	agent := &Agent{}
+	agent.state = &Atom{val: val, owner: agent}
+	return agent
+}
+
+// Deref returns the current state of the agent
+func (agent *Agent) Deref() Base {
+	return agent.state.Deref()
+}
+
+// Err is the error of the action that failed the agent, nil if it has not
+// failed
+func (agent *Agent) Err() error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	return agent.err
+}
+
+// Send queues (fn state args...) to be run on the agent. Pooled actions share
+// a limited number of goroutines and should not block. It returns an error if
+// the agent has failed.
+func (agent *Agent) Send(e Env, fn Base, args []Base, pooled bool) error {
+	return agent.dispatch(agentAction{e: e, fn: fn, args: args, pooled: pooled})
+}
+
+// Await waits for every action sent to the agent before it was called to
+// finish. It returns an error if the agent fails.
+func (agent *Agent) Await(ctx context.Context) error {
+	done := make(chan error, 1)
+	if err := agent.dispatch(agentAction{done: done}); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Restart sets the state of a failed agent and starts running its actions
+// again, or drops them if clear is set.
+func (agent *Agent) Restart(e Env, val Base, clear bool) error {
+	if agent.Err() == nil {
+		return Errorf(StateError, "agent does not need a restart")
+	} else if _, err := agent.state.Reset(e, val); err != nil {
+		return err
+	}
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	agent.err = nil
+	if clear {
+		agent.queue = nil
+	}
+	agent.start()
+	return nil
+}
+
+// SetValidator sets the function every new state must pass, nil removes it
+func (agent *Agent) SetValidator(e Env, fn Base) error {
+	return agent.state.SetValidator(e, fn)
+}
+
+// Validator returns the validator of the agent or nil if it has none
+func (agent *Agent) Validator() Base {
+	return agent.state.Validator()
+}
+
+// AddWatch adds a watch called with (key agent old new) after the state
+// changes
+func (agent *Agent) AddWatch(key, fn Base) {
+	agent.state.AddWatch(key, fn)
+}
+
+// RemoveWatch removes the watch with an equal key
+func (agent *Agent) RemoveWatch(key Base) {
+	agent.state.RemoveWatch(key)
+}
+
+func (agent *Agent) failed() error {
+	return Errorf(StateError, "agent has failed and must be restarted").Wrap(agent.err)
+}
+
+func (agent *Agent) dispatch(action agentAction) error {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	if agent.err != nil {
+		return agent.failed()
+	}
+	agent.queue = append(agent.queue, action)
+	agent.start()
+	return nil
+}
+
+// start runs the queue on a new goroutine if it is not already running, the
+// lock must be held
+func (agent *Agent) start() {
+	if !agent.running && len(agent.queue) > 0 {
+		agent.running = true
+		go agent.run()
+	}
+}
+
+func (agent *Agent) run() {
+	for {
+		agent.mu.Lock()
+		if agent.err != nil || len(agent.queue) == 0 {
+			agent.running = false
+			agent.mu.Unlock()
+			return
+		}
+		action := agent.queue[0]
+		agent.queue = agent.queue[1:]
+		agent.mu.Unlock()
+
+		if action.done != nil {
+			action.done <- nil
+		} else if err := agent.exec(action); err != nil {
+			agent.fail(err)
+		}
+	}
+}
+
+func (agent *Agent) exec(action agentAction) error {
+	if action.pooled {
+		agentPool <- struct{}{}
+		defer func() { <-agentPool }()
+	}
+	val, err := CallFunc(action.e, action.fn, append([]Base{agent.state.Deref()}, action.args...))
+	if err != nil {
+		return err
+	}
+	_, err = agent.state.Reset(action.e, val)
+	return err
+}
+
+// fail stops the agent and wakes everything waiting on it with the error
+func (agent *Agent) fail(err error) {
+	agent.mu.Lock()
+	defer agent.mu.Unlock()
+	agent.err = err
+	queue := agent.queue[:0]
+	for _, action := range agent.queue {
+		if action.done != nil {
+			action.done <- agent.failed()
+		} else {
+			queue = append(queue, action)
+		}
+	}
+	agent.queue = queue
+}
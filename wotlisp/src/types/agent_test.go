@@ -0,0 +1,192 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// appendTo is an agent action that appends its argument to a vector state
+func appendTo(e Env, a []Base) (Base, error) {
+	return a[0].(*Vector).Conj(a[1]), nil
+}
+
+var failAction = Func(func(e Env, a []Base) (Base, error) {
+	return nil, Errorf(StateError, "action failed")
+})
+
+func TestAgentRunsActionsInOrder(t *testing.T) {
+	agent := NewAgent(NewVect())
+	for i := 0; i < 100; i++ {
+		if err := agent.Send(nil, Func(appendTo), []Base{int64(i)}, i%2 == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := agent.Await(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data := agent.Deref().(*Vector).Data()
+	if len(data) != 100 {
+		t.Fatalf("expected 100 values, got %v", len(data))
+	}
+	for i, val := range data {
+		if val != int64(i) {
+			t.Fatalf("expected the actions to run in order, got %v at %v", val, i)
+		}
+	}
+}
+
+func TestAgentConcurrentSends(t *testing.T) {
+	agent := NewAgent(int64(0))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if err := agent.Send(nil, Func(inc), nil, true); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := agent.Await(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if val := agent.Deref(); val != int64(4000) {
+		t.Fatalf("expected 4000 after concurrent sends, got %v", val)
+	}
+}
+
+func TestAgentAwaitCancelled(t *testing.T) {
+	agent := NewAgent(nil)
+	release := make(chan struct{})
+	block := Func(func(e Env, a []Base) (Base, error) {
+		<-release
+		return a[0], nil
+	})
+	if err := agent.Send(nil, block, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := agent.Await(ctx); err != context.Canceled {
+		t.Fatalf("expected the wait to be cancelled, got %v", err)
+	}
+	close(release)
+	if err := agent.Await(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAgentFailure(t *testing.T) {
+	agent := NewAgent(int64(1))
+	if err := agent.Send(nil, failAction, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.Await(context.Background()); !errors.Is(err, StateError) {
+		t.Fatalf("expected await to report the failure, got %v", err)
+	} else if err := agent.Err(); err == nil || err.Error() != "action failed" {
+		t.Fatalf("expected the error of the action, got %v", err)
+	} else if err := agent.Send(nil, Func(inc), nil, true); !errors.Is(err, StateError) {
+		t.Fatalf("expected sends to a failed agent to be refused, got %v", err)
+	} else if val := agent.Deref(); val != int64(1) {
+		t.Fatalf("expected the state to be unchanged, got %v", val)
+	}
+}
+
+// TestAgentRestart checks actions queued behind a failed action are run after
+// a restart, or dropped if the restart clears them.
+func TestAgentRestart(t *testing.T) {
+	for _, clear := range []bool{false, true} {
+		agent := NewAgent(int64(0))
+		release := make(chan struct{})
+		block := Func(func(e Env, a []Base) (Base, error) {
+			<-release
+			return nil, Errorf(StateError, "action failed")
+		})
+		for _, fn := range []Base{block, Func(inc), Func(inc)} {
+			if err := agent.Send(nil, fn, nil, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(release)
+		if err := agent.Await(context.Background()); err == nil {
+			t.Fatal("expected the agent to fail")
+		}
+		if err := agent.Restart(nil, int64(10), clear); err != nil {
+			t.Fatal(err)
+		} else if err := agent.Await(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		expected := int64(12)
+		if clear {
+			expected = 10
+		}
+		if val := agent.Deref(); val != expected {
+			t.Fatalf("expected %v after a restart with clear %v, got %v", expected, clear, val)
+		}
+	}
+}
+
+func TestAgentRestartNotFailed(t *testing.T) {
+	agent := NewAgent(int64(0))
+	if err := agent.Restart(nil, int64(1), false); !errors.Is(err, StateError) {
+		t.Fatalf("expected a state error, got %v", err)
+	} else if val := agent.Deref(); val != int64(0) {
+		t.Fatalf("expected the state to be unchanged, got %v", val)
+	}
+}
+
+func TestAgentValidator(t *testing.T) {
+	agent := NewAgent(int64(1))
+	small := Func(func(e Env, a []Base) (Base, error) { return a[0].(int64) < 3, nil })
+	if err := agent.SetValidator(nil, small); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := agent.Send(nil, Func(inc), nil, true); err != nil && !errors.Is(err, StateError) {
+			t.Fatal(err)
+		}
+	}
+	if err := agent.Await(context.Background()); !errors.Is(err, StateError) {
+		t.Fatalf("expected the invalid state to fail the agent, got %v", err)
+	} else if val := agent.Deref(); val != int64(2) {
+		t.Fatalf("expected the last valid state, got %v", val)
+	}
+	if err := agent.Restart(nil, int64(5), true); !errors.Is(err, StateError) {
+		t.Fatalf("expected an invalid restart state to be refused, got %v", err)
+	} else if agent.Err() == nil {
+		t.Fatal("expected the agent to stay failed")
+	}
+}
+
+func TestAgentWatches(t *testing.T) {
+	agent := NewAgent(int64(0))
+	var mu sync.Mutex
+	var seen [][]Base
+	agent.AddWatch(Keyword("w"), Func(func(e Env, a []Base) (Base, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, a)
+		return nil, nil
+	}))
+	if err := agent.Send(nil, Func(inc), nil, true); err != nil {
+		t.Fatal(err)
+	} else if err := agent.Await(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	agent.RemoveWatch(Keyword("w"))
+	if err := agent.Send(nil, Func(inc), nil, true); err != nil {
+		t.Fatal(err)
+	} else if err := agent.Await(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 1 || seen[0][1] != agent || seen[0][2] != int64(0) || seen[0][3] != int64(1) {
+		t.Fatalf("expected one watch call with the agent, 0 and 1, got %v", seen)
+	}
+}
@@ -0,0 +1,134 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Arity is a single body of a function along with the parameters it binds
+type Arity struct {
+	Params   []Base
+	AST      Base
+	Required int
+	Variadic bool
+}
+
+func newArity(args []Base) (*Arity, error) {
+	if len(args) < 1 {
+		return nil, Errorf(SyntaxError, "improperly formatted fn* statement")
+	}
+	params, ok := args[0].(Collection)
+	if !ok {
+		return nil, Errorf(SyntaxError, "invalid fn* param declaration")
+	}
+
+	arity := &Arity{Params: params.Data()}
+	for i, param := range arity.Params {
+		if param == Symbol("&") {
+			if i != len(arity.Params)-2 {
+				return nil, Errorf(SyntaxError, "& must be followed by exactly one parameter")
+			}
+			arity.Variadic = true
+			break
+		}
+		arity.Required++
+	}
+
+	switch len(args) {
+	case 1:
+	case 2:
+		arity.AST = args[1]
+	default:
+		arity.AST = NewList(append([]Base{Symbol("do")}, args[1:]...)...)
+	}
+	return arity, nil
+}
+
+// isMultiArity reports if the fn* arguments are a list of arities, each a list
+// starting with a parameter list.
+func isMultiArity(args []Base) bool {
+	for _, arg := range args {
+		lst, ok := arg.(*List)
+		if !ok || lst.Count() == 0 {
+			return false
+		} else if _, ok := lst.First().(Collection); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func checkArities(arities []*Arity) error {
+	var variadic *Arity
+	fixed := map[int]bool{}
+	for _, arity := range arities {
+		if arity.Variadic {
+			if variadic != nil {
+				return Errorf(SyntaxError, "a function can only have one variadic arity")
+			}
+			variadic = arity
+		} else if fixed[arity.Required] {
+			return Errorf(SyntaxError, "a function cannot have two arities with %v parameters", arity.Required)
+		} else {
+			fixed[arity.Required] = true
+		}
+	}
+	if variadic != nil {
+		for required := range fixed {
+			if required > variadic.Required {
+				return Errorf(SyntaxError, "a fixed arity cannot have more parameters than the variadic arity")
+			}
+		}
+	}
+	return nil
+}
+
+// Dispatch finds the arity that accepts the arguments, preferring an exact
+// match over the variadic arity.
+func (fn *ExtFunc) Dispatch(arguments []Base) (*Arity, error) {
+	var variadic *Arity
+	for _, arity := range fn.Arities {
+		if arity.Variadic {
+			variadic = arity
+		} else if arity.Required == len(arguments) {
+			return arity, nil
+		}
+	}
+	if variadic != nil && len(arguments) >= variadic.Required {
+		return variadic, nil
+	}
+	return nil, fn.arityError(len(arguments))
+}
+
+func (fn *ExtFunc) arityError(count int) error {
+	name := fn.Name
+	if name == "" {
+		name = "fn"
+	}
+
+	counts := []int{}
+	variadic := -1
+	for _, arity := range fn.Arities {
+		if arity.Variadic {
+			variadic = arity.Required
+		} else {
+			counts = append(counts, arity.Required)
+		}
+	}
+	sort.Ints(counts)
+	expected := []string{}
+	for _, count := range counts {
+		expected = append(expected, fmt.Sprint(count))
+	}
+	if variadic >= 0 {
+		expected = append(expected, fmt.Sprintf("at least %v", variadic))
+	}
+
+	expectation := expected[len(expected)-1]
+	if len(expected) > 1 {
+		expectation = strings.Join(expected[:len(expected)-1], ", ") + " or " + expectation
+	}
+	return Errorf(ArityError, "wrong number of arguments (%v) passed to %v, expected %v", count, name, expectation).
+		With(Keyword("name"), name, Keyword("count"), int64(count))
+}
@@ -0,0 +1,110 @@
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+// params builds a parameter vector from symbol names
+func params(names ...string) *Vector {
+	syms := make([]Base, len(names))
+	for i, name := range names {
+		syms[i] = Symbol(name)
+	}
+	return NewVect(syms...)
+}
+
+func body(names ...string) *List {
+	return NewList(params(names...), Keyword("body"))
+}
+
+func TestDispatch(t *testing.T) {
+	fn, err := NewFunc(nil, nil, body(), body("x"), body("x", "y"), body("x", "y", "&", "more"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		count    int
+		required int
+		variadic bool
+	}{
+		{0, 0, false},
+		{1, 1, false},
+		{2, 2, false},
+		{3, 2, true},
+		{10, 2, true},
+	}
+	for _, c := range cases {
+		arity, err := fn.Dispatch(make([]Base, c.count))
+		if err != nil {
+			t.Fatal(err)
+		} else if arity.Required != c.required || arity.Variadic != c.variadic {
+			t.Errorf("expected %v arguments to dispatch to %v params (variadic %v), got %v (variadic %v)",
+				c.count, c.required, c.variadic, arity.Required, arity.Variadic)
+		}
+	}
+}
+
+func TestDispatchPrefersFixedArity(t *testing.T) {
+	fn, err := NewFunc(nil, nil, body("x", "&", "more"), body("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arity, err := fn.Dispatch([]Base{int64(1)}); err != nil || arity.Variadic {
+		t.Fatalf("expected the fixed arity, got %v %v", arity, err)
+	} else if arity, err := fn.Dispatch([]Base{int64(1), int64(2)}); err != nil || !arity.Variadic {
+		t.Fatalf("expected the variadic arity, got %v %v", arity, err)
+	}
+}
+
+func TestArityErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []Base
+		count    int
+		expected string
+	}{
+		{"", []Base{params("x"), Keyword("body")}, 2, "wrong number of arguments (2) passed to fn, expected 1"},
+		{"f", []Base{params("x", "y"), Keyword("body")}, 0, "wrong number of arguments (0) passed to f, expected 2"},
+		{"f", []Base{body("x"), body("x", "y", "z")}, 2, "wrong number of arguments (2) passed to f, expected 1 or 3"},
+		{"f", []Base{body(), body("x"), body("x", "y", "z", "&", "more")}, 2, "wrong number of arguments (2) passed to f, expected 0, 1 or at least 3"},
+		{"f", []Base{params("x", "&", "more"), Keyword("body")}, 0, "wrong number of arguments (0) passed to f, expected at least 1"},
+	}
+	for _, c := range cases {
+		t.Run(c.expected, func(t *testing.T) {
+			fn, err := NewFunc(nil, nil, c.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fn.Name = c.name
+			_, err = fn.Dispatch(make([]Base, c.count))
+			if !errors.Is(err, ArityError) {
+				t.Fatalf("expected an arity error, got %v", err)
+			} else if err.Error() != c.expected {
+				t.Fatalf("expected %q, got %q", c.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestArityDeclarationErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		args []Base
+	}{
+		{"no params", nil},
+		{"params that are not a vector", []Base{Symbol("x"), Keyword("body")}},
+		{"nothing after &", []Base{params("x", "&"), Keyword("body")}},
+		{"two params after &", []Base{params("&", "x", "y"), Keyword("body")}},
+		{"two arities with the same count", []Base{body("x"), body("y")}},
+		{"two variadic arities", []Base{body("&", "x"), body("x", "&", "y")}},
+		{"fixed arity past the variadic arity", []Base{body("x", "&", "more"), body("x", "y", "z")}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := NewFunc(nil, nil, c.args...); !errors.Is(err, SyntaxError) {
+				t.Fatalf("expected a syntax error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package types
+
+import (
+	"math"
+	"sync"
+)
+
+// Atom is a reference to a value that can be shared between goroutines. Its
+// value is changed with compare and swap on a version that counts the changes
+// so concurrent updates are never lost.
+// A validator can reject new values and watches are called after every
+// change.
+type Atom struct {
+	mu        sync.Mutex
+	val       Base
+	version   uint64
+	validator Base
+	watches   []watch
+	// owner is the reference passed to watches when the atom holds the state
+	// of another reference, like an agent
+	owner Base
+}
+
+// watch is a function called with (key atom old new) after the atom changes
+type watch struct {
+	key Base
+	fn  Base
+}
+
+func NewAtom(val Base) *Atom {
+	return &Atom{val: val}
+}
+
+// Deref returns the current value of the atom
+func (atom *Atom) Deref() Base {
+	atom.mu.Lock()
+	defer atom.mu.Unlock()
+	return atom.val
+}
+
+// Reset sets the value of the atom without looking at the old value
+func (atom *Atom) Reset(e Env, val Base) (Base, error) {
+	ctx := ContextOf(e)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		old, version := atom.state()
+		if swapped, err := atom.set(e, old, version, val); err != nil || swapped {
+			return val, err
+		}
+	}
+}
+
+// Swap sets the value of the atom to (fn old args...). If the atom changes
+// while fn is running it is called again with the new value, so fn can be
+// called more than once and should not have side effects.
+func (atom *Atom) Swap(e Env, fn Base, args []Base) (Base, error) {
+	ctx := ContextOf(e)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		old, version := atom.state()
+		val, err := CallFunc(e, fn, append([]Base{old}, args...))
+		if err != nil {
+			return nil, err
+		}
+		if swapped, err := atom.set(e, old, version, val); err != nil {
+			return nil, err
+		} else if swapped {
+			return val, nil
+		}
+	}
+}
+
+// CompareAndSet sets the value of the atom to val only if it is still old,
+// compared by identity. It reports if the value was set.
+func (atom *Atom) CompareAndSet(e Env, old, val Base) (bool, error) {
+	current, version := atom.state()
+	if !identical(current, old) {
+		return false, nil
+	}
+	return atom.set(e, old, version, val)
+}
+
+func (atom *Atom) state() (Base, uint64) {
+	atom.mu.Lock()
+	defer atom.mu.Unlock()
+	return atom.val, atom.version
+}
+
+// set sets the value of the atom to val only if it has not changed since the
+// version was read
+func (atom *Atom) set(e Env, old Base, version uint64, val Base) (bool, error) {
+	if err := atom.validate(e, val); err != nil {
+		return false, err
+	}
+	atom.mu.Lock()
+	if atom.version != version {
+		atom.mu.Unlock()
+		return false, nil
+	}
+	atom.val = val
+	atom.version++
+	watches := atom.watches
+	atom.mu.Unlock()
+
+	var ref Base = atom
+	if atom.owner != nil {
+		ref = atom.owner
+	}
+	for _, w := range watches {
+		if _, err := CallFunc(e, w.fn, []Base{w.key, ref, old, val}); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// identical compares values by identity, a NaN is identical to itself
+func identical(a, b Base) bool {
+	if af, ok := a.(float64); ok {
+		bf, ok := b.(float64)
+		return ok && math.Float64bits(af) == math.Float64bits(bf)
+	}
+	return a == b
+}
+
+// SetValidator sets the function that every new value must pass, nil removes
+// it. The current value must pass the new validator.
+func (atom *Atom) SetValidator(e Env, fn Base) error {
+	if fn != nil {
+		if err := checkValid(e, fn, atom.Deref()); err != nil {
+			return err
+		}
+	}
+	atom.mu.Lock()
+	defer atom.mu.Unlock()
+	atom.validator = fn
+	return nil
+}
+
+// Validator returns the validator of the atom or nil if it has none
+func (atom *Atom) Validator() Base {
+	atom.mu.Lock()
+	defer atom.mu.Unlock()
+	return atom.validator
+}
+
+func (atom *Atom) validate(e Env, val Base) error {
+	if validator := atom.Validator(); validator != nil {
+		return checkValid(e, validator, val)
+	}
+	return nil
+}
+
+func checkValid(e Env, validator, val Base) error {
+	valid, err := CallFunc(e, validator, []Base{val})
+	if err != nil {
+		return err
+	} else if valid == nil || valid == false {
+		return Errorf(StateError, "invalid reference state").With(Keyword("value"), val)
+	}
+	return nil
+}
+
+// AddWatch adds a watch called after the atom changes, replacing any watch
+// with an equal key.
+func (atom *Atom) AddWatch(key, fn Base) {
+	atom.mu.Lock()
+	defer atom.mu.Unlock()
+	watches := make([]watch, 0, len(atom.watches)+1)
+	for _, w := range atom.watches {
+		if !Equal(w.key, key) {
+			watches = append(watches, w)
+		}
+	}
+	atom.watches = append(watches, watch{key: key, fn: fn})
+}
+
+// RemoveWatch removes the watch with an equal key
+func (atom *Atom) RemoveWatch(key Base) {
+	atom.mu.Lock()
+	defer atom.mu.Unlock()
+	watches := make([]watch, 0, len(atom.watches))
+	for _, w := range atom.watches {
+		if !Equal(w.key, key) {
+			watches = append(watches, w)
+		}
+	}
+	atom.watches = watches
+}
@@ -0,0 +1,117 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+)
+
+func inc(e Env, a []Base) (Base, error) {
+	return a[0].(int64) + 1, nil
+}
+
+func TestAtomConcurrentSwap(t *testing.T) {
+	atom := NewAtom(int64(0))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if _, err := atom.Swap(nil, Func(inc), nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if val := atom.Deref(); val != int64(8000) {
+		t.Fatalf("expected 8000 after concurrent swaps, got %v", val)
+	}
+}
+
+func TestAtomCompareAndSet(t *testing.T) {
+	atom := NewAtom(int64(1))
+	if swapped, err := atom.CompareAndSet(nil, int64(2), int64(3)); err != nil || swapped {
+		t.Fatalf("expected no swap for a stale value, got %v %v", swapped, err)
+	}
+	if swapped, err := atom.CompareAndSet(nil, int64(1), int64(3)); err != nil || !swapped {
+		t.Fatalf("expected a swap for the current value, got %v %v", swapped, err)
+	}
+	if val := atom.Deref(); val != int64(3) {
+		t.Fatalf("expected 3, got %v", val)
+	}
+}
+
+func TestAtomValidator(t *testing.T) {
+	atom := NewAtom(int64(1))
+	positive := Func(func(e Env, a []Base) (Base, error) { return a[0].(int64) > 0, nil })
+	if err := atom.SetValidator(nil, positive); err != nil {
+		t.Fatal(err)
+	}
+	_, err := atom.Reset(nil, int64(-1))
+	if !errors.Is(err, StateError) {
+		t.Fatalf("expected a state error for an invalid value, got %v", err)
+	} else if val := atom.Deref(); val != int64(1) {
+		t.Fatalf("expected the value to be unchanged, got %v", val)
+	}
+	if err := atom.SetValidator(nil, Func(func(e Env, a []Base) (Base, error) { return false, nil })); !errors.Is(err, StateError) {
+		t.Fatalf("expected a validator that rejects the current value to fail, got %v", err)
+	}
+}
+
+func TestAtomWatches(t *testing.T) {
+	atom := NewAtom(int64(0))
+	var mu sync.Mutex
+	calls := [][]Base{}
+	watcher := Func(func(e Env, a []Base) (Base, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, a)
+		return nil, nil
+	})
+	atom.AddWatch(Keyword("a"), watcher)
+	atom.AddWatch(Keyword("a"), watcher)
+	if _, err := atom.Reset(nil, int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	atom.RemoveWatch(Keyword("a"))
+	if _, err := atom.Reset(nil, int64(2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("expected one watch call, got %v", len(calls))
+	}
+	call := calls[0]
+	if call[0] != Keyword("a") || call[1] != atom || call[2] != int64(0) || call[3] != int64(1) {
+		t.Fatalf("unexpected watch arguments %v", call)
+	}
+}
+
+func TestAtomNaN(t *testing.T) {
+	atom := NewAtom(math.NaN())
+	if val, err := atom.Reset(nil, int64(1)); err != nil || val != int64(1) {
+		t.Fatalf("expected reset to replace NaN, got %v %v", val, err)
+	}
+	atom = NewAtom(math.NaN())
+	if val, err := atom.Swap(nil, Func(func(e Env, a []Base) (Base, error) { return int64(2), nil }), nil); err != nil || val != int64(2) {
+		t.Fatalf("expected swap to replace NaN, got %v %v", val, err)
+	}
+	nan := math.NaN()
+	atom = NewAtom(nan)
+	if swapped, err := atom.CompareAndSet(nil, nan, int64(3)); err != nil || !swapped {
+		t.Fatalf("expected compare and set to match NaN, got %v %v", swapped, err)
+	}
+}
+
+func TestAtomSwapCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	atom := NewAtom(int64(0))
+	if _, err := atom.Swap(WithContext(nil, ctx), Func(inc), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled swap to stop, got %v", err)
+	}
+}
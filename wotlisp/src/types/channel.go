@@ -0,0 +1,184 @@
+package types
+
+import (
+	"context"
+	"sync"
+)
+
+// BufferKind is how a channel buffers values. A fixed buffer blocks puts when
+// it is full, a dropping buffer drops the new value and a sliding buffer drops
+// the oldest value.
+type BufferKind string
+
+const (
+	FixedBuffer    BufferKind = "fixed"
+	DroppingBuffer BufferKind = "dropping"
+	SlidingBuffer  BufferKind = "sliding"
+)
+
+// Chan is a channel of values between goroutines. Closing it stops puts but
+// values already buffered can still be taken, after that takes return nil.
+// nil cannot be put on a channel since it means the channel is closed.
+type Chan struct {
+	ch     chan Base
+	closed chan struct{}
+	once   sync.Once
+	kind   BufferKind
+	// slide serialises puts to sliding buffers so they can make room
+	slide sync.Mutex
+}
+
+// NewChan creates a channel with a buffer of the size, a size of 0 is a
+// channel where every put waits for a take.
+func NewChan(size int, kind BufferKind) (*Chan, error) {
+	if size < 0 {
+		return nil, Errorf(TypeError, "channel buffer size cannot be negative")
+	} else if size == 0 && kind != FixedBuffer {
+		return nil, Errorf(TypeError, "a %v buffer needs a size", kind)
+	}
+	return &Chan{ch: make(chan Base, size), closed: make(chan struct{}), kind: kind}, nil
+}
+
+// Put puts the value on the channel, waiting for room in a fixed buffer. It
+// reports false if the channel is closed.
+func (c *Chan) Put(ctx context.Context, val Base) (bool, error) {
+	if val == nil {
+		return false, Errorf(TypeError, "cannot put nil on a channel")
+	} else if c.Closed() {
+		return false, nil
+	}
+	switch c.kind {
+	case DroppingBuffer:
+		select {
+		case c.ch <- val:
+		default:
+		}
+		return true, nil
+	case SlidingBuffer:
+		c.slide.Lock()
+		defer c.slide.Unlock()
+		for {
+			select {
+			case c.ch <- val:
+				return true, nil
+			default:
+			}
+			select {
+			case <-c.ch:
+			default:
+			}
+		}
+	}
+	select {
+	case c.ch <- val:
+		return true, nil
+	case <-c.closed:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Take takes a value from the channel, waiting for one if it is empty. It
+// returns nil once the channel is closed and empty.
+func (c *Chan) Take(ctx context.Context) (Base, error) {
+	select {
+	case val := <-c.ch:
+		return val, nil
+	case <-c.closed:
+		return c.Poll(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Poll takes a value if one is ready without waiting, nil otherwise
+func (c *Chan) Poll() Base {
+	select {
+	case val := <-c.ch:
+		return val
+	default:
+		return nil
+	}
+}
+
+// Offer puts a value only if it can be put without waiting and reports if it
+// was put
+func (c *Chan) Offer(val Base) bool {
+	if c.Closed() {
+		return false
+	} else if c.kind != FixedBuffer {
+		ok, _ := c.Put(context.Background(), val)
+		return ok
+	}
+	select {
+	case c.ch <- val:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the channel, closing it again does nothing
+func (c *Chan) Close() {
+	c.once.Do(func() { close(c.closed) })
+}
+
+// Closed reports if the channel has been closed
+func (c *Chan) Closed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Buffer is the kind of buffer, its size and how many values are in it
+func (c *Chan) Buffer() (kind BufferKind, size, count int) {
+	return c.kind, cap(c.ch), len(c.ch)
+}
+
+// Channels returns the go channel that values are taken from and put to, and
+// the go channel that is closed when the channel is closed, to select on.
+func (c *Chan) Channels() (chan Base, chan struct{}) {
+	return c.ch, c.closed
+}
+
+// Mult copies every value taken from a channel to each of its taps
+type Mult struct {
+	mu   sync.Mutex
+	Src  *Chan
+	taps map[*Chan]bool
+}
+
+func NewMult(src *Chan) *Mult {
+	return &Mult{Src: src, taps: map[*Chan]bool{}}
+}
+
+// Tap adds a channel to copy values to, close is if it should be closed when
+// the source is closed
+func (m *Mult) Tap(ch *Chan, close bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.taps[ch] = close
+}
+
+// Untap stops copying values to the channel
+func (m *Mult) Untap(ch *Chan) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.taps, ch)
+}
+
+// Taps returns the channels that are tapped and if each should be closed with
+// the source
+func (m *Mult) Taps() map[*Chan]bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	taps := make(map[*Chan]bool, len(m.taps))
+	for ch, close := range m.taps {
+		taps[ch] = close
+	}
+	return taps
+}
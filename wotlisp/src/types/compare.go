@@ -0,0 +1,89 @@
+package types
+
+import "strings"
+
+// Comparator orders two values, returning a negative number when a sorts before
+// b, zero when they are equal and a positive number when a sorts after b.
+type Comparator func(a, b Base) (int, error)
+
+// ordering of the different kinds of values relative to each other so that
+// Compare is a total order across them
+const (
+	orderNil = iota
+	orderBool
+	orderNumber
+	orderString
+	orderKeyword
+	orderSymbol
+	orderSequence
+)
+
+// Compare is the default comparator. nil sorts first, then booleans, numbers,
+// strings, keywords, symbols and finally sequences. Values of the same kind
+// are compared by value and sequences compare element by element.
+func Compare(a, b Base) (int, error) {
+	orderA, okA := compareOrder(a)
+	orderB, okB := compareOrder(b)
+	if !okA || !okB {
+		return 0, Errorf(TypeError, "cannot compare %v to %v", TypeName(a), TypeName(b))
+	} else if orderA < orderB {
+		return -1, nil
+	} else if orderA > orderB {
+		return 1, nil
+	}
+
+	switch ta := a.(type) {
+	case bool:
+		tb := b.(bool)
+		switch {
+		case ta == tb:
+			return 0, nil
+		case tb:
+			return -1, nil
+		default:
+			return 1, nil
+		}
+	case string:
+		return strings.Compare(ta, b.(string)), nil
+	case Keyword:
+		return strings.Compare(string(ta), string(b.(Keyword))), nil
+	case Symbol:
+		return strings.Compare(string(ta), string(b.(Symbol))), nil
+	case Collection, Seq, *LazySeq:
+		itemsA, _ := sequentialItems(ta)
+		itemsB, _ := sequentialItems(b)
+		return compareSequences(itemsA, itemsB)
+	case nil:
+		return 0, nil
+	default:
+		return NumCompare(a, b)
+	}
+}
+
+func compareSequences(a, b []Base) (int, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if cmp, err := Compare(a[i], b[i]); err != nil || cmp != 0 {
+			return cmp, err
+		}
+	}
+	return len(a) - len(b), nil
+}
+
+func compareOrder(val Base) (int, bool) {
+	switch val.(type) {
+	case nil:
+		return orderNil, true
+	case bool:
+		return orderBool, true
+	case string:
+		return orderString, true
+	case Keyword:
+		return orderKeyword, true
+	case Symbol:
+		return orderSymbol, true
+	case Collection, Seq, *LazySeq:
+		return orderSequence, true
+	default:
+		return orderNumber, IsNumber(val)
+	}
+}
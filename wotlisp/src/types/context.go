@@ -0,0 +1,29 @@
+package types
+
+import "context"
+
+// contextEnv is the env a builtin is called with. It carries the context of
+// the evaluation that called the builtin so functions it calls back into, and
+// lazy seqs it builds, are evaluated with the same cancellation and limits.
+type contextEnv struct {
+	Env
+	ctx context.Context
+}
+
+// WithContext returns the env with ctx attached so it can be found with
+// ContextOf.
+func WithContext(e Env, ctx context.Context) Env {
+	if cenv, ok := e.(*contextEnv); ok {
+		e = cenv.Env
+	}
+	return &contextEnv{Env: e, ctx: ctx}
+}
+
+// ContextOf returns the context attached to the env with WithContext or
+// context.Background if there is none.
+func ContextOf(e Env) context.Context {
+	if cenv, ok := e.(*contextEnv); ok {
+		return cenv.ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,105 @@
+package types
+
+import "fmt"
+
+// UserError is a value thrown with throw
+type UserError struct {
+	Val Base
+}
+
+func (err UserError) Error() string {
+	return "User Error"
+}
+
+// ExInfo is an error created with ex-info that carries a message, a map of
+// data about the error and the error that caused it, if any.
+type ExInfo struct {
+	Message string
+	Data    Base
+	Cause   error
+	// Stack is the call stack the error was caught with
+	Stack Base
+}
+
+func (err *ExInfo) Error() string {
+	return err.Message
+}
+
+func (err *ExInfo) Unwrap() error {
+	return err.Cause
+}
+
+// ErrorType is the category of an error raised by the interpreter. It is the
+// :type of the error when it is caught in wot code and it can be matched with
+// errors.Is in go.
+type ErrorType string
+
+const (
+	ArityError         ErrorType = "arity-error"
+	TypeError          ErrorType = "type-error"
+	UnboundSymbolError ErrorType = "unbound-symbol-error"
+	IndexError         ErrorType = "index-error"
+	IOError            ErrorType = "io-error"
+	ReaderError        ErrorType = "reader-error"
+	SyntaxError        ErrorType = "syntax-error"
+	ArithmeticError    ErrorType = "arithmetic-error"
+	LimitError         ErrorType = "limit-error"
+	StateError         ErrorType = "state-error"
+)
+
+func (typ ErrorType) Error() string {
+	return string(typ)
+}
+
+// Error is an error raised by the interpreter with its category and a map of
+// data about what went wrong.
+type Error struct {
+	Type    ErrorType
+	Message string
+	Data    Base
+	Err     error
+}
+
+// Errorf creates an error of the type with a formatted message
+func Errorf(typ ErrorType, format string, args ...interface{}) *Error {
+	return &Error{Type: typ, Message: fmt.Sprintf(format, args...)}
+}
+
+// With adds the keys and values to the data of the error
+func (err *Error) With(keyvals ...Base) *Error {
+	values := keyvals
+	if hmap, isMap := err.Data.(*Hashmap); isMap {
+		values = append(hmap.ToList(), keyvals...)
+	}
+	err.Data, _ = NewHashmap(values)
+	return err
+}
+
+// Wrap sets the go error that caused the error
+func (err *Error) Wrap(cause error) *Error {
+	err.Err = cause
+	return err
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Is reports if the error is of the type so errors.Is(err, ArityError) works
+func (err *Error) Is(target error) bool {
+	return target == err.Type
+}
+
+// Map is the error as it is seen in wot code, {:type :message :data}
+func (err *Error) Map() *Hashmap {
+	hmap, _ := NewHashmap([]Base{
+		Keyword("type"), Keyword(err.Type),
+		Keyword("message"), err.Message,
+		Keyword("data"), err.Data,
+	})
+	return hmap
+}
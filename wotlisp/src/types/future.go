@@ -0,0 +1,174 @@
+package types
+
+import (
+	"context"
+	"sync"
+)
+
+// Awaitable is a reference whose value may not be ready yet, like a future or
+// a promise. Await blocks until the value is ready or ctx is done.
+type Awaitable interface {
+	Await(ctx context.Context) (Base, error)
+	Done() bool
+}
+
+// Future is the result of a function run on its own goroutine. An error from
+// the function is returned to everything that awaits the future.
+type Future struct {
+	mu        sync.Mutex
+	done      chan struct{}
+	stopped   chan struct{}
+	val       Base
+	err       error
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// NewFuture runs fn on a new goroutine with ctx. Cancelling the future cancels
+// ctx so fn should stop when it is done.
+func NewFuture(ctx context.Context, cancel context.CancelFunc, fn func(context.Context) (Base, error)) *Future {
+	future := &Future{done: make(chan struct{}), stopped: make(chan struct{}), cancel: cancel}
+	go func() {
+		val, err := fn(ctx)
+		future.mu.Lock()
+		future.val, future.err = val, err
+		close(future.done)
+		future.mu.Unlock()
+		cancel()
+	}()
+	return future
+}
+
+// Await waits for the future to finish and returns its value or error. It
+// returns as soon as the future is cancelled.
+func (future *Future) Await(ctx context.Context) (Base, error) {
+	select {
+	case <-future.done:
+	case <-future.stopped:
+	default:
+		if err := await(ctx, future.done, future.stopped); err != nil {
+			return nil, err
+		}
+	}
+	future.mu.Lock()
+	defer future.mu.Unlock()
+	if future.cancelled {
+		return nil, Errorf(StateError, "future was cancelled")
+	}
+	return future.val, future.err
+}
+
+// Done reports if the future has finished or been cancelled
+func (future *Future) Done() bool {
+	select {
+	case <-future.done:
+		return true
+	default:
+		return future.Cancelled()
+	}
+}
+
+// Cancel stops the future if it has not finished or been cancelled yet and
+// reports if it did
+func (future *Future) Cancel() bool {
+	future.mu.Lock()
+	defer future.mu.Unlock()
+	select {
+	case <-future.done:
+		return false
+	default:
+	}
+	if future.cancelled {
+		return false
+	}
+	future.cancelled = true
+	close(future.stopped)
+	future.cancel()
+	return true
+}
+
+// Cancelled reports if the future was cancelled before it finished
+func (future *Future) Cancelled() bool {
+	future.mu.Lock()
+	defer future.mu.Unlock()
+	return future.cancelled
+}
+
+// Status is the state of the future and its value if it is finished
+func (future *Future) Status() (Keyword, Base) {
+	if !future.Done() {
+		return "pending", nil
+	} else if future.Cancelled() {
+		return "cancelled", nil
+	}
+	future.mu.Lock()
+	defer future.mu.Unlock()
+	if future.err != nil {
+		return "failed", nil
+	}
+	return "ready", future.val
+}
+
+// Promise is a value that is delivered once, by any goroutine
+type Promise struct {
+	once sync.Once
+	done chan struct{}
+	val  Base
+}
+
+func NewPromise() *Promise {
+	return &Promise{done: make(chan struct{})}
+}
+
+// Deliver sets the value of the promise if it has not been delivered yet and
+// reports if it was set.
+func (promise *Promise) Deliver(val Base) bool {
+	delivered := false
+	promise.once.Do(func() {
+		promise.val = val
+		close(promise.done)
+		delivered = true
+	})
+	return delivered
+}
+
+// Await waits for the promise to be delivered and returns its value
+func (promise *Promise) Await(ctx context.Context) (Base, error) {
+	if !promise.Done() {
+		if err := await(ctx, promise.done, nil); err != nil {
+			return nil, err
+		}
+	}
+	return promise.val, nil
+}
+
+// Done reports if the promise has been delivered
+func (promise *Promise) Done() bool {
+	select {
+	case <-promise.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Status is :ready and the value once the promise is delivered, :pending
+// before that
+func (promise *Promise) Status() (Keyword, Base) {
+	if promise.Done() {
+		return "ready", promise.val
+	}
+	return "pending", nil
+}
+
+// await blocks until done or stopped is closed or ctx is done, a nil stopped
+// channel never stops it.
+func await(ctx context.Context, done, stopped chan struct{}) error {
+	select {
+	case <-done:
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// GoValue wraps a go value that has no wot equivalent, like a struct or a
+// pointer, so that its methods and fields can be used from wot code.
+type GoValue struct {
+	Val interface{}
+}
+
+// Equals compares the wrapped values with ==, values that cannot be compared
+// are only equal to themselves.
+func (gv *GoValue) Equals(other Base) bool {
+	ogv, ok := other.(*GoValue)
+	if !ok {
+		return false
+	} else if gv == ogv {
+		return true
+	}
+	typ := reflect.TypeOf(gv.Val)
+	return typ == reflect.TypeOf(ogv.Val) && (typ == nil || typ.Comparable()) && gv.Val == ogv.Val
+}
+
+// Hash hashes the go type, since values of the same type may be equal
+func (gv *GoValue) Hash() uint64 {
+	return hashString(seedOther, fmt.Sprintf("%T", gv.Val))
+}
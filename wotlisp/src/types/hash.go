@@ -0,0 +1,199 @@
+package types
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// Hasher can be implemented by types that want to control their own hash code.
+// Any type implementing Hasher should also implement Equaler so that values that
+// are equal always hash the same.
+type Hasher interface {
+	Hash() uint64
+}
+
+// Equaler can be implemented by types that want to control their own equality
+type Equaler interface {
+	Equals(other Base) bool
+}
+
+// seeds keep values of different types that print the same, like the symbol a,
+// the keyword :a and the string "a", from hashing to the same value.
+const (
+	seedNil uint64 = 0x9e3779b97f4a7c15 + iota
+	seedTrue
+	seedFalse
+	seedString
+	seedSymbol
+	seedKeyword
+	seedInteger
+	seedRatio
+	seedDecimal
+	seedFloat
+	seedSequence
+	seedMap
+	seedSet
+	seedPointer
+	seedOther
+)
+
+// Hash computes a hash code for any value that is consistent with Equal, two
+// values that are Equal will always have the same hash.
+func Hash(val Base) uint64 {
+	switch tval := val.(type) {
+	case nil:
+		return seedNil
+	case bool:
+		if tval {
+			return seedTrue
+		}
+		return seedFalse
+	case string:
+		return hashString(seedString, tval)
+	case Symbol:
+		return hashString(seedSymbol, string(tval))
+	case Keyword:
+		return hashString(seedKeyword, string(tval))
+	case int64:
+		return mix(seedInteger, uint64(tval))
+	case *big.Int:
+		if tval.IsInt64() {
+			return mix(seedInteger, uint64(tval.Int64()))
+		}
+		return hashString(seedInteger, tval.String())
+	case *big.Rat:
+		return mix(hashString(seedRatio, tval.Num().String()), hashString(seedRatio, tval.Denom().String()))
+	case *Decimal:
+		normal := normalizeDecimal(tval)
+		return mix(hashString(seedDecimal, normal.Unscaled.String()), uint64(normal.Scale))
+	case float64:
+		if tval == 0 {
+			tval = 0 // collapse -0.0 into 0.0
+		}
+		return mix(seedFloat, math.Float64bits(tval))
+	case Hasher:
+		return tval.Hash()
+	case Collection, Seq, *LazySeq:
+		hash := seedSequence
+		items, _ := sequentialItems(tval)
+		for _, item := range items {
+			hash = mix(hash, Hash(item))
+		}
+		return hash
+	case Map:
+		hash := seedMap
+		tval.Range(func(key, val Base) bool {
+			hash += mix(Hash(key), Hash(val))
+			return true
+		})
+		return hash
+	default:
+		return hashIdentity(val)
+	}
+}
+
+// Equal compares two values by value. Lists, vectors and seqs are equal if they have
+// equal items in the same order, maps and sets are equal whether sorted or not
+// when they have equal keys that map to equal values and numbers follow the
+// same category rules as NumEquiv.
+// Values that have no notion of value equality, like functions, are only equal
+// to themselves.
+func Equal(val1, val2 Base) bool {
+	if IsNumber(val1) {
+		return NumEquiv(val1, val2)
+	}
+
+	switch data := val1.(type) {
+	case Equaler:
+		return data.Equals(val2)
+	case Collection, Seq, *LazySeq:
+		items, ok := sequentialItems(data)
+		other, otherOk := sequentialItems(val2)
+		return ok && otherOk && equalSequences(items, other)
+	case Map:
+		other, ok := val2.(Map)
+		if !ok {
+			return false
+		}
+		return equalMaps(data, other)
+	}
+
+	if reflect.TypeOf(val1) != reflect.TypeOf(val2) {
+		return false
+	} else if val1 == nil {
+		return true
+	} else if !reflect.TypeOf(val1).Comparable() {
+		return hashIdentity(val1) == hashIdentity(val2)
+	}
+	return val1 == val2
+}
+
+func equalSequences(lst1, lst2 []Base) bool {
+	if len(lst1) != len(lst2) {
+		return false
+	}
+	for i, elm := range lst1 {
+		if !Equal(elm, lst2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalMaps(m1, m2 Map) bool {
+	if m1.Count() != m2.Count() {
+		return false
+	}
+	equal := true
+	m1.Range(func(key, val Base) bool {
+		other, found := m2.Get(key)
+		equal = found && Equal(val, other)
+		return equal
+	})
+	return equal
+}
+
+func normalizeDecimal(dec *Decimal) *Decimal {
+	unscaled, scale := new(big.Int).Set(dec.Unscaled), dec.Scale
+	quo, rem := new(big.Int), new(big.Int)
+	for scale > 0 {
+		quo.QuoRem(unscaled, bigTen, rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		unscaled.Set(quo)
+		scale--
+	}
+	return &Decimal{Unscaled: unscaled, Scale: scale}
+}
+
+func hashString(seed uint64, str string) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(str))
+	return mix(seed, hasher.Sum64())
+}
+
+func hashIdentity(val Base) uint64 {
+	rval := reflect.ValueOf(val)
+	switch rval.Kind() {
+	case reflect.Ptr, reflect.Func, reflect.Chan, reflect.Map, reflect.Slice, reflect.UnsafePointer:
+		return mix(seedPointer, uint64(rval.Pointer()))
+	default:
+		return hashString(seedOther, fmt.Sprintf("%T:%v", val, val))
+	}
+}
+
+// mix combines a hash with a new value using the murmur3 finalizer so that
+// small differences in the input spread over all of the bits.
+func mix(hash, val uint64) uint64 {
+	hash ^= val + 0x9e3779b97f4a7c15 + (hash << 6) + (hash >> 2)
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
@@ -0,0 +1,136 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+)
+
+// collider always hashes the same so that maps have to tell them apart by
+// equality alone.
+type collider struct{ id int }
+
+func (c collider) Hash() uint64 { return 42 }
+
+func (c collider) Equals(other Base) bool {
+	o, ok := other.(collider)
+	return ok && o.id == c.id
+}
+
+func TestEqualAndHash(t *testing.T) {
+	cases := []struct {
+		name  string
+		a, b  Base
+		equal bool
+	}{
+		{"vectors", NewVect(int64(1), int64(2)), NewVect(int64(1), int64(2)), true},
+		{"list and vector", NewList(int64(1), int64(2)), NewVect(int64(1), int64(2)), true},
+		{"nested", NewVect(NewList(Keyword("a")), "b"), NewList(NewVect(Keyword("a")), "b"), true},
+		{"different order", NewVect(int64(1), int64(2)), NewVect(int64(2), int64(1)), false},
+		{"int and bigint", int64(1), big.NewInt(1), true},
+		{"int and float", int64(1), 1.0, false},
+		{"decimal scales", dec("1.50"), dec("1.5"), true},
+		{"zero and negative zero", 0.0, negZero(), true},
+		{"string and symbol", "a", Symbol("a"), false},
+		{"keyword and symbol", Keyword("a"), Symbol("a"), false},
+		{"sets", NewSet(int64(1), int64(2)), NewSet(int64(2), int64(1)), true},
+		{"set and sorted set", NewSet(int64(1), int64(2)), mustSortedSet(int64(2), int64(1)), true},
+		{"maps", mustHashmap(Keyword("a"), int64(1)), mustSortedMap(Keyword("a"), int64(1)), true},
+		{"maps with different values", mustHashmap(Keyword("a"), int64(1)), mustHashmap(Keyword("a"), int64(2)), false},
+		{"nil and empty list", nil, NewList(), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if Equal(c.a, c.b) != c.equal || Equal(c.b, c.a) != c.equal {
+				t.Fatalf("expected equality to be %v both ways", c.equal)
+			} else if c.equal && Hash(c.a) != Hash(c.b) {
+				t.Fatalf("expected equal values to hash the same, got %v and %v", Hash(c.a), Hash(c.b))
+			}
+		})
+	}
+}
+
+func negZero() float64 {
+	zero := 0.0
+	return -zero
+}
+
+func mustHashmap(values ...Base) *Hashmap {
+	hm, err := NewHashmap(values)
+	if err != nil {
+		panic(err)
+	}
+	return hm
+}
+
+func mustSortedMap(values ...Base) *SortedMap {
+	sm, err := NewSortedMap(nil, values...)
+	if err != nil {
+		panic(err)
+	}
+	return sm
+}
+
+func mustSortedSet(items ...Base) *SortedSet {
+	ss, err := NewSortedSet(nil, items...)
+	if err != nil {
+		panic(err)
+	}
+	return ss
+}
+
+func TestCollectionKeys(t *testing.T) {
+	hm := mustHashmap(
+		NewVect(int64(1), int64(2)), Keyword("vector"),
+		mustHashmap(Keyword("a"), int64(1)), Keyword("map"),
+		NewSet(Keyword("x")), Keyword("set"),
+	)
+	cases := []struct {
+		key      Base
+		expected Base
+	}{
+		{NewVect(int64(1), int64(2)), Keyword("vector")},
+		{NewList(int64(1), int64(2)), Keyword("vector")},
+		{mustSortedMap(Keyword("a"), int64(1)), Keyword("map")},
+		{NewSet(Keyword("x")), Keyword("set")},
+	}
+	for _, c := range cases {
+		if val, found := hm.Get(c.key); !found || val != c.expected {
+			t.Errorf("expected %v to find %v, got %v %v", c.key, c.expected, val, found)
+		}
+	}
+	if _, found := hm.Get(NewVect(int64(2), int64(1))); found {
+		t.Error("expected a vector with different order to be missing")
+	}
+}
+
+func TestHashCollisions(t *testing.T) {
+	hm := mustHashmap()
+	for i := 0; i < 10; i++ {
+		hm = hm.assoc(collider{i}, int64(i))
+	}
+	if hm.Count() != 10 {
+		t.Fatalf("expected all colliding keys to be kept, got %v", hm.Count())
+	}
+	for i := 0; i < 10; i++ {
+		if val, found := hm.Get(collider{i}); !found || val != int64(i) {
+			t.Fatalf("expected %v for colliding key, got %v %v", i, val, found)
+		}
+	}
+	hm = hm.Dissoc(collider{3}).assoc(collider{4}, "replaced")
+	if hm.Count() != 9 || hm.Contains(collider{3}) {
+		t.Fatalf("expected dissoc to remove only the one key, got %v", hm.Count())
+	} else if val, _ := hm.Get(collider{4}); val != "replaced" {
+		t.Fatalf("expected assoc to replace the colliding key, got %v", val)
+	}
+}
+
+func TestSet(t *testing.T) {
+	s := NewSet(NewVect(int64(1)), NewList(int64(1)), int64(1), big.NewInt(1), 1.0)
+	if s.Count() != 3 {
+		t.Fatalf("expected equal values to be stored once, got %v", s.Data())
+	}
+	s2 := s.Disj(NewList(int64(1)))
+	if s.Count() != 3 || s2.Count() != 2 || s2.Contains(NewVect(int64(1))) {
+		t.Fatalf("expected disj to remove by value and leave the original, got %v %v", s.Data(), s2.Data())
+	}
+}
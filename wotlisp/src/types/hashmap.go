@@ -0,0 +1,308 @@
+package types
+
+import "math/bits"
+
+// Hashmap is a persistent hash array mapped trie. Keys are hashed with Hash and
+// compared with Equal, so any value including collections can be used as a
+// key. Each level of the trie consumes 5 bits of the hash and only the path to
+// a changed entry is copied on update.
+type Hashmap struct {
+	root  *hamtNode
+	count int
+	Meta  Base
+	// pos is the span of a map read from source, see PositionOf
+	pos *Position
+}
+
+// MapEntry is a single key value pair in a Hashmap
+type MapEntry struct {
+	Key Base
+	Val Base
+}
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+// hamtNode is either a bitmap indexed node, holding a compressed array of
+// slots for the bits set in bitmap, or a collision node holding entries whose
+// keys share the same full hash.
+type hamtNode struct {
+	bitmap     uint32
+	slots      []hamtSlot
+	collisions []MapEntry
+	hash       uint64
+}
+
+// hamtSlot holds either a single entry or a child node
+type hamtSlot struct {
+	hash  uint64
+	entry MapEntry
+	node  *hamtNode
+}
+
+var emptyHamtNode = &hamtNode{}
+
+func NewHashmap(values []Base, excludeKeys ...Base) (*Hashmap, error) {
+	if len(values)%2 == 1 {
+		return nil, Errorf(ArityError, "Odd number of arguments to NewHashMap")
+	}
+	hm := &Hashmap{root: emptyHamtNode}
+	for i := 0; i < len(values); i += 2 {
+		key := values[i]
+		found := false
+		for _, exclude := range excludeKeys {
+			if Equal(key, exclude) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			hm = hm.assoc(key, values[i+1])
+		}
+	}
+	return hm, nil
+}
+
+// Get looks up the value for a key and reports if it was found
+func (hm *Hashmap) Get(key Base) (Base, bool) {
+	return hm.root.get(0, Hash(key), key)
+}
+
+// Contains reports if the key is in the map
+func (hm *Hashmap) Contains(key Base) bool {
+	_, found := hm.Get(key)
+	return found
+}
+
+// Count returns the number of entries in the map
+func (hm *Hashmap) Count() int {
+	return hm.count
+}
+
+// Assoc returns a new map with the key value pairs added to it
+func (hm *Hashmap) Assoc(values ...Base) (*Hashmap, error) {
+	if len(values)%2 == 1 {
+		return nil, Errorf(ArityError, "Odd number of arguments to assoc")
+	}
+	result := &Hashmap{root: hm.root, count: hm.count, Meta: hm.Meta}
+	for i := 0; i < len(values); i += 2 {
+		result = result.assoc(values[i], values[i+1])
+	}
+	return result, nil
+}
+
+// Dissoc returns a new map without the given keys
+func (hm *Hashmap) Dissoc(keys ...Base) *Hashmap {
+	result := &Hashmap{root: hm.root, count: hm.count, Meta: hm.Meta}
+	for _, key := range keys {
+		if root, removed := result.root.dissoc(0, Hash(key), key); removed {
+			result = &Hashmap{root: root, count: result.count - 1, Meta: hm.Meta}
+		}
+	}
+	return result
+}
+
+// WithMeta returns the same map with different metadata
+func (hm *Hashmap) WithMeta(meta Base) *Hashmap {
+	return &Hashmap{root: hm.root, count: hm.count, Meta: meta, pos: hm.pos}
+}
+
+// WithPosition returns the same map with its span in the source
+func (hm *Hashmap) WithPosition(pos Position) *Hashmap {
+	return &Hashmap{root: hm.root, count: hm.count, Meta: hm.Meta, pos: &pos}
+}
+
+// Range calls fn for every entry in the map until fn returns false
+func (hm *Hashmap) Range(fn func(key, val Base) bool) {
+	hm.root.each(func(entry MapEntry) bool { return fn(entry.Key, entry.Val) })
+}
+
+func (hm *Hashmap) assoc(key, val Base) *Hashmap {
+	root, added := hm.root.assoc(0, Hash(key), key, val)
+	count := hm.count
+	if added {
+		count++
+	}
+	return &Hashmap{root: root, count: count, Meta: hm.Meta}
+}
+
+func (hm *Hashmap) entries() []MapEntry {
+	entries := make([]MapEntry, 0, hm.count)
+	hm.root.each(func(entry MapEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	return entries
+}
+
+func (hm *Hashmap) ToList() []Base {
+	values := make([]Base, 0, hm.count*2)
+	for _, entry := range hm.entries() {
+		values = append(values, entry.Key, entry.Val)
+	}
+	return values
+}
+
+func (hm *Hashmap) Keys() []Base {
+	keys := make([]Base, 0, hm.count)
+	for _, entry := range hm.entries() {
+		keys = append(keys, entry.Key)
+	}
+	return keys
+}
+
+func (hm *Hashmap) Vals() []Base {
+	vals := make([]Base, 0, hm.count)
+	for _, entry := range hm.entries() {
+		vals = append(vals, entry.Val)
+	}
+	return vals
+}
+
+func hamtBit(shift uint, hash uint64) uint32 {
+	return uint32(1) << ((hash >> shift) & hamtMask)
+}
+
+func (node *hamtNode) position(bit uint32) int {
+	return bits.OnesCount32(node.bitmap & (bit - 1))
+}
+
+func (node *hamtNode) get(shift uint, hash uint64, key Base) (Base, bool) {
+	if node.collisions != nil {
+		for _, entry := range node.collisions {
+			if Equal(entry.Key, key) {
+				return entry.Val, true
+			}
+		}
+		return nil, false
+	}
+	bit := hamtBit(shift, hash)
+	if node.bitmap&bit == 0 {
+		return nil, false
+	}
+	slot := node.slots[node.position(bit)]
+	if slot.node != nil {
+		return slot.node.get(shift+hamtBits, hash, key)
+	} else if Equal(slot.entry.Key, key) {
+		return slot.entry.Val, true
+	}
+	return nil, false
+}
+
+func (node *hamtNode) assoc(shift uint, hash uint64, key, val Base) (*hamtNode, bool) {
+	if node.collisions != nil {
+		return node.assocCollision(shift, hash, key, val)
+	}
+	bit := hamtBit(shift, hash)
+	pos := node.position(bit)
+	if node.bitmap&bit == 0 {
+		slots := make([]hamtSlot, len(node.slots)+1)
+		copy(slots, node.slots[:pos])
+		slots[pos] = hamtSlot{hash: hash, entry: MapEntry{Key: key, Val: val}}
+		copy(slots[pos+1:], node.slots[pos:])
+		return &hamtNode{bitmap: node.bitmap | bit, slots: slots}, true
+	}
+
+	slot := node.slots[pos]
+	added := false
+	switch {
+	case slot.node != nil:
+		slot.node, added = slot.node.assoc(shift+hamtBits, hash, key, val)
+	case Equal(slot.entry.Key, key):
+		slot.entry.Val = val
+	case slot.hash == hash:
+		slot = hamtSlot{node: &hamtNode{hash: hash, collisions: []MapEntry{slot.entry, {Key: key, Val: val}}}}
+		added = true
+	default:
+		slot = hamtSlot{node: mergeHamtSlots(shift+hamtBits, slot, hamtSlot{hash: hash, entry: MapEntry{Key: key, Val: val}})}
+		added = true
+	}
+	slots := append([]hamtSlot{}, node.slots...)
+	slots[pos] = slot
+	return &hamtNode{bitmap: node.bitmap, slots: slots}, added
+}
+
+func (node *hamtNode) assocCollision(shift uint, hash uint64, key, val Base) (*hamtNode, bool) {
+	if hash != node.hash {
+		// the new key only shares part of the hash so push the collisions down a
+		// level behind a bitmap node that can tell them apart
+		bit := hamtBit(shift, node.hash)
+		wrapper := &hamtNode{bitmap: bit, slots: []hamtSlot{{node: node}}}
+		return wrapper.assoc(shift, hash, key, val)
+	}
+	entries := append([]MapEntry{}, node.collisions...)
+	for i, entry := range entries {
+		if Equal(entry.Key, key) {
+			entries[i].Val = val
+			return &hamtNode{hash: hash, collisions: entries}, false
+		}
+	}
+	return &hamtNode{hash: hash, collisions: append(entries, MapEntry{Key: key, Val: val})}, true
+}
+
+func mergeHamtSlots(shift uint, slot1, slot2 hamtSlot) *hamtNode {
+	bit1 := hamtBit(shift, slot1.hash)
+	bit2 := hamtBit(shift, slot2.hash)
+	if bit1 == bit2 {
+		return &hamtNode{bitmap: bit1, slots: []hamtSlot{{node: mergeHamtSlots(shift+hamtBits, slot1, slot2)}}}
+	} else if bit1 > bit2 {
+		slot1, slot2 = slot2, slot1
+	}
+	return &hamtNode{bitmap: bit1 | bit2, slots: []hamtSlot{slot1, slot2}}
+}
+
+func (node *hamtNode) dissoc(shift uint, hash uint64, key Base) (*hamtNode, bool) {
+	if node.collisions != nil {
+		for i, entry := range node.collisions {
+			if Equal(entry.Key, key) {
+				entries := append(append([]MapEntry{}, node.collisions[:i]...), node.collisions[i+1:]...)
+				return &hamtNode{hash: hash, collisions: entries}, true
+			}
+		}
+		return node, false
+	}
+	bit := hamtBit(shift, hash)
+	if node.bitmap&bit == 0 {
+		return node, false
+	}
+	pos := node.position(bit)
+	slot := node.slots[pos]
+	if slot.node != nil {
+		child, removed := slot.node.dissoc(shift+hamtBits, hash, key)
+		if !removed {
+			return node, false
+		} else if !child.isEmpty() {
+			slots := append([]hamtSlot{}, node.slots...)
+			slots[pos].node = child
+			return &hamtNode{bitmap: node.bitmap, slots: slots}, true
+		}
+	} else if !Equal(slot.entry.Key, key) {
+		return node, false
+	}
+	slots := append(append([]hamtSlot{}, node.slots[:pos]...), node.slots[pos+1:]...)
+	return &hamtNode{bitmap: node.bitmap &^ bit, slots: slots}, true
+}
+
+func (node *hamtNode) isEmpty() bool {
+	return len(node.slots) == 0 && len(node.collisions) == 0
+}
+
+func (node *hamtNode) each(fn func(MapEntry) bool) bool {
+	for _, entry := range node.collisions {
+		if !fn(entry) {
+			return false
+		}
+	}
+	for _, slot := range node.slots {
+		if slot.node != nil {
+			if !slot.node.each(fn) {
+				return false
+			}
+		} else if !fn(slot.entry) {
+			return false
+		}
+	}
+	return true
+}
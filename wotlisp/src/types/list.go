@@ -0,0 +1,80 @@
+package types
+
+// List is a persistent singly linked list. Adding to the front of a list shares
+// the whole of the existing list so cons is constant time.
+type List struct {
+	first Base
+	rest  *List
+	count int
+	Meta  Base
+	// pos is the span of a list read from source and positions are the
+	// positions of its symbols. They are kept out of Meta so user code does
+	// not see them.
+	pos       *Position
+	positions []Position
+}
+
+var emptyList = &List{}
+
+func NewList(forms ...Base) *List {
+	list := &List{}
+	for i := len(forms) - 1; i >= 0; i-- {
+		list = list.Cons(forms[i])
+	}
+	return list
+}
+
+// Cons returns a new list with the value added to the front
+func (l *List) Cons(val Base) *List {
+	return &List{first: val, rest: l, count: l.count + 1}
+}
+
+// First returns the head of the list or nil if it is empty
+func (l *List) First() Base { return l.first }
+
+// Rest returns the list without its head, the rest of an empty list is empty
+func (l *List) Rest() *List {
+	if l.rest == nil {
+		return emptyList
+	}
+	return l.rest
+}
+
+// Count returns the length of the list
+func (l *List) Count() int { return l.count }
+
+// Nth returns the value at index i and reports if the index was in range
+func (l *List) Nth(i int) (Base, bool) {
+	if i < 0 || i >= l.count {
+		return nil, false
+	}
+	for ; i > 0; i-- {
+		l = l.rest
+	}
+	return l.first, true
+}
+
+// WithMeta returns the same list with different metadata
+func (l *List) WithMeta(meta Base) *List {
+	return &List{first: l.first, rest: l.rest, count: l.count, Meta: meta, pos: l.pos, positions: l.positions}
+}
+
+// WithPosition returns the same list with its span in the source, see
+// PositionOf
+func (l *List) WithPosition(pos Position) *List {
+	return &List{first: l.first, rest: l.rest, count: l.count, Meta: l.Meta, pos: &pos, positions: l.positions}
+}
+
+// WithPositions returns the same list with the source positions of its
+// symbols, see SymbolPosition
+func (l *List) WithPositions(positions []Position) *List {
+	return &List{first: l.first, rest: l.rest, count: l.count, Meta: l.Meta, pos: l.pos, positions: positions}
+}
+
+func (l *List) Data() []Base {
+	data := make([]Base, 0, l.count)
+	for node := l; node.count > 0; node = node.rest {
+		data = append(data, node.first)
+	}
+	return data
+}
@@ -0,0 +1,540 @@
+package types
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+// The numeric tower is made up of int64, *big.Int, *big.Rat, *Decimal and
+// float64 values. When two numbers of different kinds meet in an operation the
+// result is contagious towards the right of that list, so an int plus a ratio is
+// a ratio and anything plus a float is a float.
+const (
+	rankInt = iota
+	rankBigInt
+	rankRatio
+	rankDecimal
+	rankFloat
+)
+
+var (
+	ErrDivideByZero   = Errorf(ArithmeticError, "divide by zero")
+	ErrNonTerminating = Errorf(ArithmeticError, "non-terminating decimal expansion; no exact representable decimal result")
+	ErrNotANumber     = Errorf(TypeError, "non-number value passed to numeric operation")
+
+	bigOne  = big.NewInt(1)
+	bigTwo  = big.NewInt(2)
+	bigFive = big.NewInt(5)
+	bigTen  = big.NewInt(10)
+)
+
+// Decimal is an arbitrary precision decimal number, read with an M suffix. Its
+// value is Unscaled * 10^-Scale.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+// ParseDecimal parses a plain or exponent formatted decimal string like 1.50 or
+// 12e-3 into a Decimal, keeping the scale it was written with.
+func ParseDecimal(src string) (*Decimal, error) {
+	mantissa, exponent := src, 0
+	if idx := strings.IndexAny(src, "eE"); idx >= 0 {
+		mantissa = src[:idx]
+		exp, ok := new(big.Int).SetString(strings.TrimPrefix(src[idx+1:], "+"), 10)
+		if !ok || !exp.IsInt64() {
+			return nil, Errorf(ReaderError, "improperly formatted decimal")
+		}
+		exponent = int(exp.Int64())
+	}
+	scale := 0
+	if idx := strings.IndexByte(mantissa, '.'); idx >= 0 {
+		scale = len(mantissa) - idx - 1
+		mantissa = mantissa[:idx] + mantissa[idx+1:]
+	}
+	unscaled, ok := new(big.Int).SetString(strings.TrimPrefix(mantissa, "+"), 10)
+	if !ok {
+		return nil, Errorf(ReaderError, "improperly formatted decimal")
+	}
+	scale -= exponent
+	if scale < 0 {
+		unscaled.Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	return &Decimal{Unscaled: unscaled, Scale: scale}, nil
+}
+
+// Rat returns the exact rational value of the decimal
+func (d *Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.Unscaled, pow10(d.Scale))
+}
+
+func (d *Decimal) String() string {
+	digits := new(big.Int).Abs(d.Unscaled).String()
+	sign := ""
+	if d.Unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if d.Scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - d.Scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// ratToDecimal converts an exact rational to a decimal with at least minScale
+// digits after the point. Rationals whose denominator has prime factors other
+// than 2 and 5 have no exact decimal representation.
+func ratToDecimal(r *big.Rat, minScale int) (*Decimal, error) {
+	denom := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	mod := new(big.Int)
+	for {
+		if quo, rem := new(big.Int).QuoRem(denom, bigTwo, mod); rem.Sign() == 0 {
+			denom, twos = quo, twos+1
+			continue
+		}
+		if quo, rem := new(big.Int).QuoRem(denom, bigFive, mod); rem.Sign() == 0 {
+			denom, fives = quo, fives+1
+			continue
+		}
+		break
+	}
+	if denom.Cmp(bigOne) != 0 {
+		return nil, ErrNonTerminating
+	}
+	scale := minScale
+	if twos > scale {
+		scale = twos
+	}
+	if fives > scale {
+		scale = fives
+	}
+	unscaled := new(big.Int).Mul(r.Num(), pow10(scale))
+	unscaled.Quo(unscaled, r.Denom())
+	return &Decimal{Unscaled: unscaled, Scale: scale}, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// IsNumber reports whether the value is part of the numeric tower
+func IsNumber(val Base) bool {
+	_, ok := rank(val)
+	return ok
+}
+
+// IsInteger reports whether the value is an int64 or a *big.Int
+func IsInteger(val Base) bool {
+	r, ok := rank(val)
+	return ok && r <= rankBigInt
+}
+
+// ToInt converts an integer value to a Go int if it fits
+func ToInt(val Base) (int, bool) {
+	switch num := val.(type) {
+	case int64:
+		return int(num), int64(int(num)) == num
+	case *big.Int:
+		if num.IsInt64() {
+			return ToInt(num.Int64())
+		}
+	}
+	return 0, false
+}
+
+// ToFloat converts any number to a float64
+func ToFloat(val Base) (float64, bool) {
+	switch num := val.(type) {
+	case int64:
+		return float64(num), true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(num).Float64()
+		return f, true
+	case *big.Rat:
+		f, _ := num.Float64()
+		return f, true
+	case *Decimal:
+		f, _ := num.Rat().Float64()
+		return f, true
+	case float64:
+		return num, true
+	default:
+		return 0, false
+	}
+}
+
+func rank(val Base) (int, bool) {
+	switch val.(type) {
+	case int64:
+		return rankInt, true
+	case *big.Int:
+		return rankBigInt, true
+	case *big.Rat:
+		return rankRatio, true
+	case *Decimal:
+		return rankDecimal, true
+	case float64:
+		return rankFloat, true
+	default:
+		return 0, false
+	}
+}
+
+func ranks(x, y Base) (int, int, int, error) {
+	rx, okx := rank(x)
+	ry, oky := rank(y)
+	if !okx || !oky {
+		return 0, 0, 0, ErrNotANumber
+	}
+	if rx > ry {
+		return rx, rx, ry, nil
+	}
+	return ry, rx, ry, nil
+}
+
+func toBig(val Base) *big.Int {
+	switch num := val.(type) {
+	case int64:
+		return big.NewInt(num)
+	case *big.Int:
+		return num
+	}
+	return nil
+}
+
+func toRat(val Base) *big.Rat {
+	switch num := val.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(num)
+	case *big.Int:
+		return new(big.Rat).SetInt(num)
+	case *big.Rat:
+		return num
+	case *Decimal:
+		return num.Rat()
+	}
+	return nil
+}
+
+func scaleOf(val Base) int {
+	if dec, ok := val.(*Decimal); ok {
+		return dec.Scale
+	}
+	return 0
+}
+
+// normalizeRat turns ratios with a denominator of one back into integers.
+// keepBig keeps the integer as a *big.Int when a big integer took part in the
+// operation so that bigint contagion is preserved.
+func normalizeRat(r *big.Rat, keepBig bool) Base {
+	if !r.IsInt() {
+		return r
+	}
+	return normalizeInt(new(big.Int).Set(r.Num()), keepBig)
+}
+
+func normalizeInt(i *big.Int, keepBig bool) Base {
+	if !keepBig && i.IsInt64() {
+		return i.Int64()
+	}
+	return i
+}
+
+// Add adds two numbers following the contagion rules of the numeric tower
+func Add(x, y Base) (Base, error) {
+	if a, ok := x.(int64); ok {
+		if b, ok := y.(int64); ok {
+			if c := a + b; (c > a) == (b > 0) {
+				return c, nil
+			}
+			return new(big.Int).Add(big.NewInt(a), big.NewInt(b)), nil
+		}
+	}
+	return arith(x, y,
+		func(a, b *big.Int) *big.Int { return new(big.Int).Add(a, b) },
+		func(a, b *big.Rat) *big.Rat { return new(big.Rat).Add(a, b) },
+		func(sa, sb int) int { return maxInt(sa, sb) },
+		func(a, b float64) float64 { return a + b },
+	)
+}
+
+// Sub subtracts y from x following the contagion rules of the numeric tower
+func Sub(x, y Base) (Base, error) {
+	if a, ok := x.(int64); ok {
+		if b, ok := y.(int64); ok {
+			if c := a - b; (c < a) == (b > 0) {
+				return c, nil
+			}
+			return new(big.Int).Sub(big.NewInt(a), big.NewInt(b)), nil
+		}
+	}
+	return arith(x, y,
+		func(a, b *big.Int) *big.Int { return new(big.Int).Sub(a, b) },
+		func(a, b *big.Rat) *big.Rat { return new(big.Rat).Sub(a, b) },
+		func(sa, sb int) int { return maxInt(sa, sb) },
+		func(a, b float64) float64 { return a - b },
+	)
+}
+
+// Mul multiplies two numbers following the contagion rules of the numeric tower
+func Mul(x, y Base) (Base, error) {
+	if a, ok := x.(int64); ok {
+		if b, ok := y.(int64); ok {
+			if a == 0 || b == 0 {
+				return int64(0), nil
+			}
+			if c := a * b; c/b == a && !(b == -1 && a == math.MinInt64) {
+				return c, nil
+			}
+			return new(big.Int).Mul(big.NewInt(a), big.NewInt(b)), nil
+		}
+	}
+	return arith(x, y,
+		func(a, b *big.Int) *big.Int { return new(big.Int).Mul(a, b) },
+		func(a, b *big.Rat) *big.Rat { return new(big.Rat).Mul(a, b) },
+		func(sa, sb int) int { return sa + sb },
+		func(a, b float64) float64 { return a * b },
+	)
+}
+
+// Div divides x by y. Integers that do not divide evenly produce a ratio.
+func Div(x, y Base) (Base, error) {
+	top, rx, ry, err := ranks(x, y)
+	if err != nil {
+		return nil, err
+	}
+	if top == rankFloat {
+		a, _ := ToFloat(x)
+		b, _ := ToFloat(y)
+		return a / b, nil
+	}
+	if isZero(y) {
+		return nil, ErrDivideByZero
+	}
+	quotient := new(big.Rat).Quo(toRat(x), toRat(y))
+	if top == rankDecimal {
+		return ratToDecimal(quotient, maxInt(scaleOf(x)-scaleOf(y), 0))
+	}
+	return normalizeRat(quotient, rx == rankBigInt || ry == rankBigInt), nil
+}
+
+func arith(
+	x, y Base,
+	intOp func(a, b *big.Int) *big.Int,
+	ratOp func(a, b *big.Rat) *big.Rat,
+	scaleOp func(sa, sb int) int,
+	floatOp func(a, b float64) float64,
+) (Base, error) {
+	top, rx, ry, err := ranks(x, y)
+	if err != nil {
+		return nil, err
+	}
+	switch top {
+	case rankInt, rankBigInt:
+		return intOp(toBig(x), toBig(y)), nil
+	case rankRatio:
+		return normalizeRat(ratOp(toRat(x), toRat(y)), rx == rankBigInt || ry == rankBigInt), nil
+	case rankDecimal:
+		return ratToDecimal(ratOp(toRat(x), toRat(y)), scaleOp(scaleOf(x), scaleOf(y)))
+	default:
+		a, _ := ToFloat(x)
+		b, _ := ToFloat(y)
+		return floatOp(a, b), nil
+	}
+}
+
+func isZero(val Base) bool {
+	switch num := val.(type) {
+	case int64:
+		return num == 0
+	case *big.Int:
+		return num.Sign() == 0
+	case *big.Rat:
+		return num.Sign() == 0
+	case *Decimal:
+		return num.Unscaled.Sign() == 0
+	case float64:
+		return num == 0
+	}
+	return false
+}
+
+// Quot divides x by y and truncates the result towards zero
+func Quot(x, y Base) (Base, error) {
+	top, rx, ry, err := ranks(x, y)
+	if err != nil {
+		return nil, err
+	}
+	if isZero(y) {
+		return nil, ErrDivideByZero
+	}
+	switch top {
+	case rankInt:
+		a, b := x.(int64), y.(int64)
+		if a == math.MinInt64 && b == -1 {
+			return new(big.Int).Neg(toBig(a)), nil
+		}
+		return a / b, nil
+	case rankBigInt:
+		return new(big.Int).Quo(toBig(x), toBig(y)), nil
+	case rankFloat:
+		a, _ := ToFloat(x)
+		b, _ := ToFloat(y)
+		return math.Trunc(a / b), nil
+	}
+	quotient := new(big.Rat).Quo(toRat(x), toRat(y))
+	truncated := new(big.Int).Quo(quotient.Num(), quotient.Denom())
+	if top == rankDecimal {
+		return &Decimal{Unscaled: truncated, Scale: 0}, nil
+	}
+	return normalizeInt(truncated, rx == rankBigInt || ry == rankBigInt), nil
+}
+
+// Rem is the remainder of truncated division, its sign follows the dividend
+func Rem(x, y Base) (Base, error) {
+	if a, ok := x.(int64); ok {
+		if b, ok := y.(int64); ok && b != 0 {
+			return a % b, nil
+		}
+	}
+	quotient, err := Quot(x, y)
+	if err != nil {
+		return nil, err
+	}
+	if top, _, _, _ := ranks(x, y); top == rankFloat {
+		a, _ := ToFloat(x)
+		b, _ := ToFloat(y)
+		return math.Mod(a, b), nil
+	}
+	product, err := Mul(y, quotient)
+	if err != nil {
+		return nil, err
+	}
+	return Sub(x, product)
+}
+
+// Mod is the remainder of floored division, its sign follows the divisor
+func Mod(x, y Base) (Base, error) {
+	remainder, err := Rem(x, y)
+	if err != nil {
+		return nil, err
+	}
+	if !isZero(remainder) && Sign(remainder) != Sign(y) {
+		return Add(remainder, y)
+	}
+	return remainder, nil
+}
+
+// Negate flips the sign of a number
+func Negate(x Base) (Base, error) {
+	return Sub(int64(0), x)
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of the number
+func Sign(x Base) int {
+	switch num := x.(type) {
+	case int64:
+		switch {
+		case num < 0:
+			return -1
+		case num > 0:
+			return 1
+		}
+	case *big.Int:
+		return num.Sign()
+	case *big.Rat:
+		return num.Sign()
+	case *Decimal:
+		return num.Unscaled.Sign()
+	case float64:
+		switch {
+		case num < 0:
+			return -1
+		case num > 0:
+			return 1
+		}
+	}
+	return 0
+}
+
+// NumCompare orders two numbers, returning -1, 0 or 1
+func NumCompare(x, y Base) (int, error) {
+	if a, ok := x.(int64); ok {
+		if b, ok := y.(int64); ok {
+			switch {
+			case a < b:
+				return -1, nil
+			case a > b:
+				return 1, nil
+			default:
+				return 0, nil
+			}
+		}
+	}
+	top, _, _, err := ranks(x, y)
+	if err != nil {
+		return 0, err
+	}
+	switch top {
+	case rankInt, rankBigInt:
+		return toBig(x).Cmp(toBig(y)), nil
+	case rankFloat:
+		a, _ := ToFloat(x)
+		b, _ := ToFloat(y)
+		switch {
+		case a < b:
+			return -1, nil
+		case a > b:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	default:
+		return toRat(x).Cmp(toRat(y)), nil
+	}
+}
+
+// NumEquals compares two numbers by value regardless of their kind
+func NumEquals(x, y Base) (bool, error) {
+	if a, ok := x.(float64); ok && math.IsNaN(a) {
+		return false, nil
+	} else if b, ok := y.(float64); ok && math.IsNaN(b) {
+		return false, nil
+	}
+	cmp, err := NumCompare(x, y)
+	return cmp == 0, err
+}
+
+// NumEquiv is the equality used by =. Numbers are only equal when they are in
+// the same category (integer, ratio, decimal or float) and have the same value.
+func NumEquiv(x, y Base) bool {
+	rx, okx := rank(x)
+	ry, oky := rank(y)
+	if !okx || !oky {
+		return false
+	}
+	if rx == rankBigInt {
+		rx = rankInt
+	}
+	if ry == rankBigInt {
+		ry = rankInt
+	}
+	if rx != ry {
+		return false
+	}
+	equal, _ := NumEquals(x, y)
+	return equal
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,154 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func dec(src string) *Decimal {
+	d, err := ParseDecimal(src)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func bigInt(src string) *big.Int {
+	i, _ := new(big.Int).SetString(src, 10)
+	return i
+}
+
+// showNum is the kind and value of a number so results can be compared
+// including the kind they were promoted to
+func showNum(val Base) string {
+	return fmt.Sprintf("%T %v", val, val)
+}
+
+func TestArithmetic(t *testing.T) {
+	cases := []struct {
+		name     string
+		op       func(x, y Base) (Base, error)
+		x, y     Base
+		expected string
+	}{
+		{"int add", Add, int64(1), int64(2), "int64 3"},
+		{"add overflow", Add, int64(math.MaxInt64), int64(1), "*big.Int 9223372036854775808"},
+		{"add negative overflow", Add, int64(math.MinInt64), int64(-1), "*big.Int -9223372036854775809"},
+		{"sub overflow", Sub, int64(math.MinInt64), int64(1), "*big.Int -9223372036854775809"},
+		{"mul overflow", Mul, int64(math.MaxInt64), int64(2), "*big.Int 18446744073709551614"},
+		{"mul min int by -1", Mul, int64(math.MinInt64), int64(-1), "*big.Int 9223372036854775808"},
+		{"mul by zero", Mul, int64(math.MaxInt64), int64(0), "int64 0"},
+		{"bigint stays big", Add, bigInt("1"), int64(1), "*big.Int 2"},
+		{"bigint contagion to ratio", Div, bigInt("4"), int64(2), "*big.Int 2"},
+		{"exact division", Div, int64(6), int64(3), "int64 2"},
+		{"ratio division", Div, int64(1), int64(3), "*big.Rat 1/3"},
+		{"ratio back to int", Add, big.NewRat(1, 2), big.NewRat(1, 2), "int64 1"},
+		{"int and ratio", Add, int64(1), big.NewRat(1, 3), "*big.Rat 4/3"},
+		{"ratio and decimal", Add, big.NewRat(1, 2), dec("1.25"), "*types.Decimal 1.75"},
+		{"decimal scale", Add, dec("1.5"), dec("1.25"), "*types.Decimal 2.75"},
+		{"decimal mul scale", Mul, dec("1.5"), dec("1.5"), "*types.Decimal 2.25"},
+		{"int and decimal", Mul, int64(2), dec("1.50"), "*types.Decimal 3.00"},
+		{"decimal and float", Add, dec("1.5"), 1.5, "float64 3"},
+		{"int and float", Add, int64(1), 0.5, "float64 1.5"},
+		{"ratio and float", Mul, big.NewRat(1, 2), 3.0, "float64 1.5"},
+		{"float division by zero", Div, 1.0, int64(0), "float64 +Inf"},
+		{"quot truncates", Quot, int64(-7), int64(2), "int64 -3"},
+		{"quot min int by -1", Quot, int64(math.MinInt64), int64(-1), "*big.Int 9223372036854775808"},
+		{"rem follows dividend", Rem, int64(-7), int64(2), "int64 -1"},
+		{"mod follows divisor", Mod, int64(-7), int64(2), "int64 1"},
+		{"mod of ratio", Mod, big.NewRat(7, 2), int64(2), "*big.Rat 3/2"},
+		{"mod of float", Mod, -7.5, 2.0, "float64 0.5"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			val, err := c.op(c.x, c.y)
+			if err != nil {
+				t.Fatal(err)
+			} else if showNum(val) != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, showNum(val))
+			}
+		})
+	}
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		op       func(x, y Base) (Base, error)
+		x, y     Base
+		expected error
+	}{
+		{"int divide by zero", Div, int64(1), int64(0), ErrDivideByZero},
+		{"ratio divide by zero", Div, big.NewRat(1, 2), big.NewRat(0, 1), ErrDivideByZero},
+		{"quot by zero", Quot, int64(1), int64(0), ErrDivideByZero},
+		{"mod by zero", Mod, int64(1), int64(0), ErrDivideByZero},
+		{"non-terminating decimal", Div, dec("1"), dec("3"), ErrNonTerminating},
+		{"not a number", Add, int64(1), "1", ErrNotANumber},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := c.op(c.x, c.y); !errors.Is(err, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+func TestNumCompare(t *testing.T) {
+	cases := []struct {
+		x, y     Base
+		cmp      int
+		equals   bool
+		equiv    bool
+		comparer string
+	}{
+		{int64(1), bigInt("1"), 0, true, true, "int and bigint"},
+		{int64(1), 1.0, 0, true, false, "int and float"},
+		{big.NewRat(1, 2), dec("0.5"), 0, true, false, "ratio and decimal"},
+		{dec("1.50"), dec("1.5"), 0, true, true, "decimals of different scales"},
+		{big.NewRat(1, 3), 0.3, 1, false, false, "ratio and float"},
+		{bigInt("9223372036854775808"), int64(math.MaxInt64), 1, false, false, "bigint past int64"},
+	}
+	for _, c := range cases {
+		t.Run(c.comparer, func(t *testing.T) {
+			if cmp, err := NumCompare(c.x, c.y); err != nil || cmp != c.cmp {
+				t.Errorf("expected compare to be %v, got %v %v", c.cmp, cmp, err)
+			}
+			if equals, err := NumEquals(c.x, c.y); err != nil || equals != c.equals {
+				t.Errorf("expected == to be %v, got %v %v", c.equals, equals, err)
+			}
+			if equiv := NumEquiv(c.x, c.y); equiv != c.equiv {
+				t.Errorf("expected = to be %v, got %v", c.equiv, equiv)
+			}
+		})
+	}
+}
+
+func TestNaNEquality(t *testing.T) {
+	nan := math.NaN()
+	if equals, err := NumEquals(nan, nan); err != nil || equals {
+		t.Fatalf("expected NaN not to equal itself, got %v %v", equals, err)
+	} else if NumEquiv(nan, nan) {
+		t.Fatal("expected NaN not to be equivalent to itself")
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for src, expected := range map[string]string{
+		"1.50":   "1.50",
+		"12e-3":  "0.012",
+		"1.5e2":  "150",
+		"-0.05":  "-0.05",
+		"+2.000": "2.000",
+	} {
+		if d, err := ParseDecimal(src); err != nil || d.String() != expected {
+			t.Errorf("expected %v to parse as %v, got %v %v", src, expected, d, err)
+		}
+	}
+	if _, err := ParseDecimal("1.2.3"); !errors.Is(err, ReaderError) {
+		t.Errorf("expected a reader error, got %v", err)
+	}
+}
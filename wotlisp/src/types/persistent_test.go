@@ -0,0 +1,211 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The benchmarks compare the persistent vector and map with copying the whole
+// slice or go map on every change, which is what they replaced. Changing the
+// persistent structures should stay close to flat as the size grows while the
+// copies grow linearly.
+
+var benchSizes = []int{10, 1000, 100000}
+
+func benchVector(n int) *Vector {
+	v := NewVect()
+	for i := 0; i < n; i++ {
+		v = v.Conj(int64(i))
+	}
+	return v
+}
+
+func benchSlice(n int) []Base {
+	forms := make([]Base, n)
+	for i := range forms {
+		forms[i] = int64(i)
+	}
+	return forms
+}
+
+func benchHashmap(n int) *Hashmap {
+	hm, _ := NewHashmap(nil)
+	for i := 0; i < n; i++ {
+		hm = hm.assoc(int64(i), int64(i))
+	}
+	return hm
+}
+
+func benchGoMap(n int) map[Base]Base {
+	m := make(map[Base]Base, n)
+	for i := 0; i < n; i++ {
+		m[int64(i)] = int64(i)
+	}
+	return m
+}
+
+func copyConj(forms []Base, val Base) []Base {
+	next := make([]Base, len(forms), len(forms)+1)
+	copy(next, forms)
+	return append(next, val)
+}
+
+func copyAssoc(m map[Base]Base, key, val Base) map[Base]Base {
+	next := make(map[Base]Base, len(m)+1)
+	for k, v := range m {
+		next[k] = v
+	}
+	next[key] = val
+	return next
+}
+
+func copyDissoc(m map[Base]Base, key Base) map[Base]Base {
+	next := make(map[Base]Base, len(m))
+	for k, v := range m {
+		if k != key {
+			next[k] = v
+		}
+	}
+	return next
+}
+
+func BenchmarkVectorConj(b *testing.B) {
+	for _, n := range benchSizes {
+		v := benchVector(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.Conj(int64(i))
+			}
+		})
+	}
+}
+
+func BenchmarkCopyConj(b *testing.B) {
+	for _, n := range benchSizes {
+		forms := benchSlice(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copyConj(forms, int64(i))
+			}
+		})
+	}
+}
+
+func BenchmarkVectorAssoc(b *testing.B) {
+	for _, n := range benchSizes {
+		v := benchVector(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := v.Assoc(i%n, int64(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCopyVectorAssoc(b *testing.B) {
+	for _, n := range benchSizes {
+		forms := benchSlice(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				next := make([]Base, len(forms))
+				copy(next, forms)
+				next[i%n] = int64(i)
+			}
+		})
+	}
+}
+
+func BenchmarkVectorNth(b *testing.B) {
+	for _, n := range benchSizes {
+		v := benchVector(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				v.Nth(i % n)
+			}
+		})
+	}
+}
+
+func BenchmarkSliceNth(b *testing.B) {
+	for _, n := range benchSizes {
+		forms := benchSlice(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			var val Base
+			for i := 0; i < b.N; i++ {
+				val = forms[i%n]
+			}
+			_ = val
+		})
+	}
+}
+
+func BenchmarkHashmapAssoc(b *testing.B) {
+	for _, n := range benchSizes {
+		hm := benchHashmap(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hm.assoc(int64(i), int64(i))
+			}
+		})
+	}
+}
+
+func BenchmarkCopyAssoc(b *testing.B) {
+	for _, n := range benchSizes {
+		m := benchGoMap(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copyAssoc(m, int64(i), int64(i))
+			}
+		})
+	}
+}
+
+func BenchmarkHashmapDissoc(b *testing.B) {
+	for _, n := range benchSizes {
+		hm := benchHashmap(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hm.Dissoc(int64(i % n))
+			}
+		})
+	}
+}
+
+func BenchmarkCopyDissoc(b *testing.B) {
+	for _, n := range benchSizes {
+		m := benchGoMap(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copyDissoc(m, int64(i%n))
+			}
+		})
+	}
+}
+
+// TestPersistentUnchanged checks changing a vector or map leaves the original
+// as it was.
+func TestPersistentUnchanged(t *testing.T) {
+	v := benchVector(1000)
+	v2 := v.Conj(int64(1000))
+	v3, err := v.Assoc(500, "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Count() != 1000 || v2.Count() != 1001 {
+		t.Fatalf("expected conj to leave the original, got %v and %v", v.Count(), v2.Count())
+	}
+	if val, _ := v.Nth(500); val != int64(500) {
+		t.Fatalf("expected assoc to leave the original, got %v", val)
+	} else if val, _ := v3.Nth(500); val != "changed" {
+		t.Fatalf("expected the new vector to change, got %v", val)
+	}
+
+	hm := benchHashmap(1000)
+	hm2 := hm.Dissoc(int64(10))
+	if hm.Count() != 1000 || hm2.Count() != 999 || hm2.Contains(int64(10)) || !hm.Contains(int64(10)) {
+		t.Fatalf("expected dissoc to leave the original, got %v and %v", hm.Count(), hm2.Count())
+	}
+}
@@ -0,0 +1,106 @@
+package types
+
+import "fmt"
+
+// Position is the span of a form in source code. Lines and columns start at 1
+// and the end column is just past the last character of the form.
+type Position struct {
+	File      string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+}
+
+// String formats the start of the position as file:line:column, leaving out the
+// file when the source did not come from one.
+func (pos Position) String() string {
+	if pos.File == "" {
+		return fmt.Sprintf("%v:%v", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%v:%v:%v", pos.File, pos.Line, pos.Column)
+}
+
+// PositionOf returns the source position of a form read by the reader. Only
+// collections keep their position, see SymbolPosition for symbols.
+func PositionOf(form Base) (Position, bool) {
+	var pos *Position
+	switch tform := form.(type) {
+	case *List:
+		pos = tform.pos
+	case *Vector:
+		pos = tform.pos
+	case *Hashmap:
+		pos = tform.pos
+	case *Set:
+		pos = tform.pos
+	}
+	if pos == nil {
+		return Position{}, false
+	}
+	return *pos, true
+}
+
+// SymbolPosition returns the source position of the first sym in a list or
+// vector read from source. Symbols cannot have metadata so the reader keeps
+// their positions in the form they were read in, by index.
+func SymbolPosition(form Base, sym Symbol) (Position, bool) {
+	var positions []Position
+	var data []Base
+	switch tform := form.(type) {
+	case *List:
+		positions, data = tform.positions, tform.Data()
+	case *Vector:
+		positions, data = tform.positions, tform.Data()
+	}
+	for i, pos := range positions {
+		if i < len(data) && pos.Line > 0 && data[i] == sym {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// SourceError is an error raised while evaluating the form at Pos
+type SourceError struct {
+	Err error
+	Pos Position
+}
+
+func (err SourceError) Error() string {
+	return err.Pos.String() + ": " + err.Err.Error()
+}
+
+func (err SourceError) Unwrap() error {
+	return err.Err
+}
+
+// Frame is a function call on the wot call stack
+type Frame struct {
+	Name   string
+	Pos    Position
+	HasPos bool
+	Elided int
+}
+
+func (frame Frame) String() string {
+	if !frame.HasPos {
+		return frame.Name
+	}
+	return frame.Name + ", called at " + frame.Pos.String()
+}
+
+// StackError is an error along with the call stack that it unwound through,
+// innermost call first.
+type StackError struct {
+	Err    error
+	Frames []Frame
+}
+
+func (err *StackError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *StackError) Unwrap() error {
+	return err.Err
+}
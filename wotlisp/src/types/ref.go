@@ -0,0 +1,302 @@
+package types
+
+import (
+	"context"
+	"errors"
+	goruntime "runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrRetry is returned when a transaction conflicts with another one that
+// committed first. The transaction is run again from the start.
+var ErrRetry = errors.New("transaction conflict")
+
+// stmClock is the point of the latest commit. Transactions read the values
+// refs had at the point they started.
+var stmClock uint64
+
+// stmCommit is held while a transaction commits so commits happen one at a
+// time.
+var stmCommit sync.Mutex
+
+const (
+	// refHistory is how many committed values a ref keeps for transactions
+	// that started before the latest commits
+	refHistory = 10
+	// maxRetries is how many times a transaction is run before giving up
+	maxRetries = 10000
+)
+
+type refVersion struct {
+	val   Base
+	point uint64
+}
+
+// Ref is a reference that is changed in transactions with dosync. Each ref
+// keeps its recent values with the point they were committed at so a
+// transaction sees every ref as it was when the transaction started.
+type Ref struct {
+	mu sync.RWMutex
+	// history is newest first
+	history []refVersion
+}
+
+func NewRef(val Base) *Ref {
+	return &Ref{history: []refVersion{{val: val}}}
+}
+
+// Deref is the latest committed value of the ref
+func (ref *Ref) Deref() Base {
+	ref.mu.RLock()
+	defer ref.mu.RUnlock()
+	return ref.history[0].val
+}
+
+// at is the value the ref had at the point, false if it is no longer kept
+func (ref *Ref) at(point uint64) (Base, bool) {
+	ref.mu.RLock()
+	defer ref.mu.RUnlock()
+	for _, version := range ref.history {
+		if version.point <= point {
+			return version.val, true
+		}
+	}
+	return nil, false
+}
+
+func (ref *Ref) latest() uint64 {
+	ref.mu.RLock()
+	defer ref.mu.RUnlock()
+	return ref.history[0].point
+}
+
+func (ref *Ref) commit(val Base, point uint64) {
+	ref.mu.Lock()
+	defer ref.mu.Unlock()
+	ref.history = append([]refVersion{{val: val, point: point}}, ref.history...)
+	if len(ref.history) > refHistory {
+		ref.history = ref.history[:refHistory]
+	}
+}
+
+type commute struct {
+	e    Env
+	fn   Base
+	args []Base
+}
+
+// Txn is a running transaction. Values set in a transaction are only seen by
+// it until it commits.
+type Txn struct {
+	mu        sync.Mutex
+	readPoint uint64
+	vals      map[*Ref]Base
+	sets      map[*Ref]bool
+	ensures   map[*Ref]bool
+	commutes  map[*Ref][]commute
+	after     []func()
+	done      bool
+}
+
+type txnKey struct{}
+
+// TransactionOf returns the transaction running in ctx, nil if there is none
+func TransactionOf(ctx context.Context) *Txn {
+	txn, _ := ctx.Value(txnKey{}).(*Txn)
+	return txn
+}
+
+// WithoutTransaction returns ctx without the transaction running in it, for
+// work that happens outside of the transaction
+func WithoutTransaction(ctx context.Context) context.Context {
+	if TransactionOf(ctx) == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, txnKey{}, (*Txn)(nil))
+}
+
+// RunTransaction calls fn in a transaction and commits it, calling fn again
+// whenever the transaction conflicts with another one. If a transaction is
+// already running in ctx fn joins it.
+func RunTransaction(ctx context.Context, fn func(context.Context) (Base, error)) (Base, error) {
+	if TransactionOf(ctx) != nil {
+		return fn(ctx)
+	}
+	for i := 0; i < maxRetries; i++ {
+		txn := &Txn{
+			readPoint: atomic.LoadUint64(&stmClock),
+			vals:      map[*Ref]Base{},
+			sets:      map[*Ref]bool{},
+			ensures:   map[*Ref]bool{},
+			commutes:  map[*Ref][]commute{},
+		}
+		val, err := fn(context.WithValue(ctx, txnKey{}, txn))
+		if err == nil {
+			err = txn.commit()
+		}
+		txn.finish()
+		if err == nil {
+			for _, fn := range txn.after {
+				fn()
+			}
+		}
+		if !errors.Is(err, ErrRetry) {
+			return val, err
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		goruntime.Gosched()
+	}
+	return nil, Errorf(StateError, "transaction did not commit after %v retries", maxRetries)
+}
+
+// Get is the value of the ref in the transaction
+func (txn *Txn) Get(ref *Ref) (Base, error) {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	return txn.get(ref)
+}
+
+func (txn *Txn) get(ref *Ref) (Base, error) {
+	if txn.done {
+		return nil, Errorf(StateError, "transaction is no longer running")
+	} else if val, ok := txn.vals[ref]; ok {
+		return val, nil
+	}
+	val, ok := ref.at(txn.readPoint)
+	if !ok {
+		return nil, ErrRetry
+	}
+	txn.vals[ref] = val
+	return val, nil
+}
+
+// Set sets the value of the ref in the transaction
+func (txn *Txn) Set(ref *Ref, val Base) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return Errorf(StateError, "transaction is no longer running")
+	} else if len(txn.commutes[ref]) > 0 {
+		return Errorf(StateError, "cannot set a ref after commuting it in the same transaction")
+	}
+	txn.vals[ref] = val
+	txn.sets[ref] = true
+	return nil
+}
+
+// Alter sets the ref to (fn val args...) in the transaction
+func (txn *Txn) Alter(e Env, ref *Ref, fn Base, args []Base) (Base, error) {
+	old, err := txn.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	val, err := CallFunc(e, fn, append([]Base{old}, args...))
+	if err != nil {
+		return nil, err
+	}
+	return val, txn.Set(ref, val)
+}
+
+// Commute sets the ref to (fn val args...) in the transaction, and calls fn
+// again with the latest value of the ref when the transaction commits. It
+// never conflicts so fn should not depend on the order it is applied in.
+func (txn *Txn) Commute(e Env, ref *Ref, fn Base, args []Base) (Base, error) {
+	old, err := txn.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	val, err := CallFunc(e, fn, append([]Base{old}, args...))
+	if err != nil {
+		return nil, err
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return nil, Errorf(StateError, "transaction is no longer running")
+	}
+	txn.vals[ref] = val
+	txn.commutes[ref] = append(txn.commutes[ref], commute{e: e, fn: fn, args: args})
+	return val, nil
+}
+
+// AfterCommit calls fn once the transaction has committed. It is not called if
+// the transaction fails and is dropped if the transaction is retried.
+func (txn *Txn) AfterCommit(fn func()) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.done {
+		return Errorf(StateError, "transaction is no longer running")
+	}
+	txn.after = append(txn.after, fn)
+	return nil
+}
+
+// Ensure makes the transaction conflict with any other that changes the ref
+// before it commits, even though it does not change the ref itself.
+func (txn *Txn) Ensure(ref *Ref) (Base, error) {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	val, err := txn.get(ref)
+	if err == nil {
+		txn.ensures[ref] = true
+	}
+	return val, err
+}
+
+// commit checks that no ref set or ensured in the transaction was committed
+// by another transaction since it started, then commits the new values.
+// Commutes are called again with the latest values of their refs, outside of
+// the transaction. The new values are added to the refs before the clock moves
+// so transactions started during the commit do not see them.
+func (txn *Txn) commit() error {
+	txn.mu.Lock()
+	txn.done = true
+	txn.mu.Unlock()
+
+	stmCommit.Lock()
+	defer stmCommit.Unlock()
+	for ref := range txn.sets {
+		if ref.latest() > txn.readPoint {
+			return ErrRetry
+		}
+	}
+	for ref := range txn.ensures {
+		if ref.latest() > txn.readPoint {
+			return ErrRetry
+		}
+	}
+
+	vals := map[*Ref]Base{}
+	for ref := range txn.sets {
+		vals[ref] = txn.vals[ref]
+	}
+	for ref, commutes := range txn.commutes {
+		if txn.sets[ref] {
+			continue
+		}
+		val := ref.Deref()
+		for _, c := range commutes {
+			e := WithContext(c.e, WithoutTransaction(ContextOf(c.e)))
+			var err error
+			if val, err = CallFunc(e, c.fn, append([]Base{val}, c.args...)); err != nil {
+				return err
+			}
+		}
+		vals[ref] = val
+	}
+
+	point := atomic.LoadUint64(&stmClock) + 1
+	for ref, val := range vals {
+		ref.commit(val, point)
+	}
+	atomic.StoreUint64(&stmClock, point)
+	return nil
+}
+
+func (txn *Txn) finish() {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	txn.done = true
+}
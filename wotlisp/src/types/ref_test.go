@@ -0,0 +1,152 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func sumRefs(txn *Txn, refs []*Ref) (int64, error) {
+	var total int64
+	for _, ref := range refs {
+		val, err := txn.Get(ref)
+		if err != nil {
+			return 0, err
+		}
+		total += val.(int64)
+	}
+	return total, nil
+}
+
+// TestRefTransfers moves amounts between accounts from many goroutines while
+// others read every account, the total must be the same in every transaction.
+func TestRefTransfers(t *testing.T) {
+	ctx := context.Background()
+	accounts := make([]*Ref, 10)
+	for i := range accounts {
+		accounts[i] = NewRef(int64(100))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for j := 0; j < 500; j++ {
+				from, to, amount := accounts[rnd.Intn(len(accounts))], accounts[rnd.Intn(len(accounts))], int64(rnd.Intn(20))
+				_, err := RunTransaction(ctx, func(ctx context.Context) (Base, error) {
+					txn := TransactionOf(ctx)
+					balance, err := txn.Get(from)
+					if err != nil || balance.(int64) < amount {
+						return nil, err
+					} else if err := txn.Set(from, balance.(int64)-amount); err != nil {
+						return nil, err
+					}
+					balance, err = txn.Get(to)
+					if err != nil {
+						return nil, err
+					}
+					return nil, txn.Set(to, balance.(int64)+amount)
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(int64(i))
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				total, err := RunTransaction(ctx, func(ctx context.Context) (Base, error) {
+					return sumRefs(TransactionOf(ctx), accounts)
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				} else if total != int64(1000) {
+					t.Errorf("expected a total of 1000 in a transaction, got %v", total)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var total int64
+	for _, account := range accounts {
+		if account.Deref().(int64) < 0 {
+			t.Fatalf("expected no account to go below 0, got %v", account.Deref())
+		}
+		total += account.Deref().(int64)
+	}
+	if total != 1000 {
+		t.Fatalf("expected a total of 1000 after the transfers, got %v", total)
+	}
+}
+
+func TestRefCommute(t *testing.T) {
+	ctx := context.Background()
+	counter := NewRef(int64(0))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				_, err := RunTransaction(ctx, func(ctx context.Context) (Base, error) {
+					return TransactionOf(ctx).Commute(nil, counter, Func(inc), nil)
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if val := counter.Deref(); val != int64(4000) {
+		t.Fatalf("expected 4000 after concurrent commutes, got %v", val)
+	}
+}
+
+// TestRefEnsure runs two transactions that each take one ref off duty only if
+// the other is still on duty. Ensuring the other ref stops both going off.
+func TestRefEnsure(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 200; i++ {
+		a, b := NewRef(int64(1)), NewRef(int64(1))
+		offDuty := func(mine, other *Ref) {
+			_, err := RunTransaction(ctx, func(ctx context.Context) (Base, error) {
+				txn := TransactionOf(ctx)
+				onDuty, err := txn.Ensure(other)
+				if err != nil || onDuty != int64(1) {
+					return nil, err
+				}
+				return nil, txn.Set(mine, int64(0))
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); offDuty(a, b) }()
+		go func() { defer wg.Done(); offDuty(b, a) }()
+		wg.Wait()
+		if a.Deref().(int64)+b.Deref().(int64) == 0 {
+			t.Fatal("expected one ref to stay on duty")
+		}
+	}
+}
+
+func TestRefOutsideTransaction(t *testing.T) {
+	ref := NewRef(int64(1))
+	txn := &Txn{vals: map[*Ref]Base{}, sets: map[*Ref]bool{}, ensures: map[*Ref]bool{}, commutes: map[*Ref][]commute{}}
+	txn.finish()
+	if _, err := txn.Get(ref); !errors.Is(err, StateError) {
+		t.Fatalf("expected a state error from a finished transaction, got %v", err)
+	}
+}
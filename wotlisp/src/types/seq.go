@@ -0,0 +1,228 @@
+package types
+
+import (
+	"strings"
+	"sync"
+)
+
+// Seq is a sequence with at least one value. First is the head of the sequence
+// and More is the rest of it, which may be any seqable value including a lazy
+// seq that has not been realized yet.
+type Seq interface {
+	First() Base
+	More() Base
+}
+
+// Cons is a sequence cell that puts a value on the front of any seqable value
+// without realizing it.
+type Cons struct {
+	first Base
+	more  Base
+	Meta  Base
+}
+
+func NewCons(first, more Base) *Cons {
+	return &Cons{first: first, more: more}
+}
+
+// First returns the head of the sequence
+func (c *Cons) First() Base { return c.first }
+
+// More returns the rest of the sequence
+func (c *Cons) More() Base { return c.more }
+
+// LazySeq is a sequence whose values are computed on demand. The function is
+// run at most once and its result, or its error, is cached.
+type LazySeq struct {
+	mu       sync.Mutex
+	fn       func() (Base, error)
+	val      Base
+	seq      Seq
+	err      error
+	realized bool
+	Meta     Base
+}
+
+func NewLazySeq(fn func() (Base, error)) *LazySeq {
+	return &LazySeq{fn: fn}
+}
+
+// Seq realizes the lazy seq and returns its first cell, nil if it is empty.
+// Lazy seqs that return lazy seqs are unwrapped in a loop rather than through
+// recursion so long chains cannot overflow the stack.
+func (ls *LazySeq) Seq() (Seq, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.realized {
+		return ls.seq, ls.err
+	}
+	val, err := ls.sval()
+	for err == nil {
+		inner, isLazy := val.(*LazySeq)
+		if !isLazy {
+			break
+		}
+		inner.mu.Lock()
+		val, err = inner.sval()
+		inner.mu.Unlock()
+	}
+	if err == nil {
+		ls.seq, err = ToSeq(val)
+	}
+	ls.val, ls.err, ls.realized = nil, err, true
+	return ls.seq, ls.err
+}
+
+// sval runs the function if it has not already been run. The caller must hold
+// the lock.
+func (ls *LazySeq) sval() (Base, error) {
+	if ls.realized {
+		return ls.seq, ls.err
+	} else if ls.fn != nil {
+		ls.val, ls.err = ls.fn()
+		ls.fn = nil
+	}
+	return ls.val, ls.err
+}
+
+// Realized reports if the values of the lazy seq have been computed
+func (ls *LazySeq) Realized() bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.realized
+}
+
+// More returns the list without its head so lists can be used as a Seq
+func (l *List) More() Base { return l.Rest() }
+
+// vectorSeq walks a vector by index so taking the seq of a vector does not
+// copy it.
+type vectorSeq struct {
+	vec *Vector
+	i   int
+}
+
+func (vs *vectorSeq) First() Base {
+	val, _ := vs.vec.Nth(vs.i)
+	return val
+}
+
+func (vs *vectorSeq) More() Base {
+	if vs.i+1 >= vs.vec.Count() {
+		return emptyList
+	}
+	return &vectorSeq{vec: vs.vec, i: vs.i + 1}
+}
+
+// ToSeq returns a Seq over any seqable value, nil if the value is empty. Lazy
+// seqs are realized as far as their first value.
+func ToSeq(val Base) (Seq, error) {
+	switch tval := val.(type) {
+	case nil:
+		return nil, nil
+	case *List:
+		if tval.Count() == 0 {
+			return nil, nil
+		}
+		return tval, nil
+	case *Vector:
+		if tval.Count() == 0 {
+			return nil, nil
+		}
+		return &vectorSeq{vec: tval}, nil
+	case *LazySeq:
+		return tval.Seq()
+	case Seq:
+		return tval, nil
+	case Map:
+		if tval.Count() == 0 {
+			return nil, nil
+		}
+		entries := []Base{}
+		tval.Range(func(key, val Base) bool {
+			entries = append(entries, NewVect(key, val))
+			return true
+		})
+		return NewList(entries...), nil
+	case string:
+		if tval == "" {
+			return nil, nil
+		}
+		chars := []Base{}
+		for _, ch := range strings.Split(tval, "") {
+			chars = append(chars, ch)
+		}
+		return NewList(chars...), nil
+	}
+	if set, isSet := asMembers(val); isSet {
+		if set.Count() == 0 {
+			return nil, nil
+		}
+		return NewList(set.Data()...), nil
+	}
+	return nil, Errorf(TypeError, "cannot create a seq from %v", TypeName(val))
+}
+
+// SeqData realizes all the values of a seqable value
+func SeqData(val Base) ([]Base, error) {
+	data := []Base{}
+	seq, err := ToSeq(val)
+	for ; seq != nil && err == nil; seq, err = ToSeq(seq.More()) {
+		data = append(data, seq.First())
+	}
+	return data, err
+}
+
+// IsSeq reports if the value is a seq other than a list, like a lazy seq or a
+// cons cell.
+func IsSeq(val Base) bool {
+	switch val.(type) {
+	case *List:
+		return false
+	case Seq, *LazySeq:
+		return true
+	default:
+		return false
+	}
+}
+
+// sequentialItems returns the values of lists, vectors and seqs and reports
+// if the value was sequential. A seq that fails to realize is not sequential.
+func sequentialItems(val Base) ([]Base, bool) {
+	switch tval := val.(type) {
+	case Collection:
+		return tval.Data(), true
+	case Seq, *LazySeq:
+		data, err := SeqData(tval)
+		return data, err == nil
+	default:
+		return nil, false
+	}
+}
+
+// Realize forces every lazy seq in the values, including ones nested inside of
+// collections, and returns the first error raised while computing them.
+func Realize(vals ...Base) error {
+	for _, val := range vals {
+		var items []Base
+		switch tval := val.(type) {
+		case Collection:
+			items = tval.Data()
+		case Map:
+			items = tval.ToList()
+		case Seq, *LazySeq:
+			var err error
+			if items, err = SeqData(tval); err != nil {
+				return err
+			}
+		default:
+			if set, isSet := asMembers(val); isSet {
+				items = set.Data()
+			}
+		}
+		if err := Realize(items...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package types
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingSeq is a lazy seq of val that counts how many times it is computed
+func countingSeq(calls *int64, val Base, err error) *LazySeq {
+	return NewLazySeq(func() (Base, error) {
+		atomic.AddInt64(calls, 1)
+		return val, err
+	})
+}
+
+func TestLazySeqCaches(t *testing.T) {
+	var calls int64
+	ls := countingSeq(&calls, NewList(int64(1), int64(2)), nil)
+	if ls.Realized() {
+		t.Fatal("expected the seq not to be realized before it is used")
+	}
+	for i := 0; i < 3; i++ {
+		if data, err := SeqData(ls); err != nil || len(data) != 2 {
+			t.Fatalf("expected 2 values, got %v %v", data, err)
+		}
+	}
+	if calls != 1 || !ls.Realized() {
+		t.Fatalf("expected the seq to be computed once, got %v", calls)
+	}
+}
+
+func TestLazySeqCachesErrors(t *testing.T) {
+	var calls int64
+	failure := Errorf(StateError, "failed")
+	ls := countingSeq(&calls, nil, failure)
+	for i := 0; i < 3; i++ {
+		if _, err := ls.Seq(); !errors.Is(err, StateError) {
+			t.Fatalf("expected the error, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the error to be cached, computed %v times", calls)
+	}
+}
+
+func TestLazySeqRealizedOnce(t *testing.T) {
+	var calls int64
+	ls := countingSeq(&calls, NewList(int64(1)), nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if seq, err := ls.Seq(); err != nil || seq.First() != int64(1) {
+				t.Errorf("expected 1, got %v %v", seq, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("expected the seq to be computed once, got %v", calls)
+	}
+}
+
+func TestLazySeqEmpty(t *testing.T) {
+	for _, val := range []Base{nil, NewList(), NewVect(), NewLazySeq(func() (Base, error) { return nil, nil })} {
+		ls := NewLazySeq(func() (Base, error) { return val, nil })
+		if seq, err := ls.Seq(); err != nil || seq != nil {
+			t.Errorf("expected a lazy seq of %v to be empty, got %v %v", val, seq, err)
+		}
+	}
+}
+
+// TestLazySeqDeepNesting checks lazy seqs that return lazy seqs, thousands deep,
+// are unwrapped without overflowing the stack.
+func TestLazySeqDeepNesting(t *testing.T) {
+	var ls Base = NewList(Keyword("end"))
+	for i := 0; i < 100000; i++ {
+		inner := ls
+		ls = NewLazySeq(func() (Base, error) { return inner, nil })
+	}
+	if seq, err := ToSeq(ls); err != nil || seq.First() != Keyword("end") {
+		t.Fatalf("expected :end, got %v %v", seq, err)
+	}
+}
+
+// TestLazySeqLongChain walks a long lazy seq where each rest is another lazy
+// seq, like (iterate inc 0), without recursing.
+func TestLazySeqLongChain(t *testing.T) {
+	var from func(n int64) *LazySeq
+	from = func(n int64) *LazySeq {
+		return NewLazySeq(func() (Base, error) {
+			if n == 100000 {
+				return nil, nil
+			}
+			return NewCons(n, from(n+1)), nil
+		})
+	}
+	data, err := SeqData(from(0))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(data) != 100000 || data[99999] != int64(99999) {
+		t.Fatalf("expected a hundred thousand values, got %v", len(data))
+	}
+}
+
+func TestToSeq(t *testing.T) {
+	cases := []struct {
+		name     string
+		val      Base
+		expected []Base
+	}{
+		{"nil", nil, nil},
+		{"empty list", NewList(), nil},
+		{"empty vector", NewVect(), nil},
+		{"empty string", "", nil},
+		{"empty map", mustHashmap(), nil},
+		{"empty set", NewSet(), nil},
+		{"list", NewList(int64(1), int64(2)), []Base{int64(1), int64(2)}},
+		{"vector", NewVect(int64(1), int64(2)), []Base{int64(1), int64(2)}},
+		{"string", "ab", []Base{"a", "b"}},
+		{"map", mustHashmap(Keyword("a"), int64(1)), []Base{NewVect(Keyword("a"), int64(1))}},
+		{"sorted set", mustSortedSet(int64(2), int64(1)), []Base{int64(1), int64(2)}},
+		{"cons", NewCons(int64(1), NewVect(int64(2))), []Base{int64(1), int64(2)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			seq, err := ToSeq(c.val)
+			if err != nil {
+				t.Fatal(err)
+			} else if c.expected == nil {
+				if seq != nil {
+					t.Fatalf("expected an empty seq, got %v", seq)
+				}
+				return
+			}
+			data, err := SeqData(seq)
+			if err != nil || !equalSequences(data, c.expected) {
+				t.Fatalf("expected %v, got %v %v", c.expected, data, err)
+			}
+		})
+	}
+	if _, err := ToSeq(int64(1)); !errors.Is(err, TypeError) {
+		t.Fatalf("expected a type error for a number, got %v", err)
+	}
+}
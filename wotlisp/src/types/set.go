@@ -0,0 +1,111 @@
+package types
+
+// Set is a persistent collection of unique values. It is stored as a Hashmap
+// of each value to itself so it shares the same structural sharing and value
+// equality as maps.
+type Set struct {
+	items *Hashmap
+	Meta  Base
+	// pos is the span of a set read from source, see PositionOf
+	pos *Position
+}
+
+func NewSet(items ...Base) *Set {
+	set := &Set{items: &Hashmap{root: emptyHamtNode}}
+	for _, item := range items {
+		set.items = set.items.assoc(item, item)
+	}
+	return set
+}
+
+// Get returns the member of the set equal to val and reports if it was found
+func (s *Set) Get(val Base) (Base, bool) {
+	return s.items.Get(val)
+}
+
+// Contains reports if the value is a member of the set
+func (s *Set) Contains(val Base) bool {
+	return s.items.Contains(val)
+}
+
+// Count returns the number of members in the set
+func (s *Set) Count() int {
+	return s.items.Count()
+}
+
+// Conj returns a new set with the values added to it
+func (s *Set) Conj(vals ...Base) *Set {
+	items := s.items
+	for _, val := range vals {
+		items = items.assoc(val, val)
+	}
+	return &Set{items: items, Meta: s.Meta}
+}
+
+// Disj returns a new set without the values
+func (s *Set) Disj(vals ...Base) *Set {
+	return &Set{items: s.items.Dissoc(vals...), Meta: s.Meta}
+}
+
+// WithMeta returns the same set with different metadata
+func (s *Set) WithMeta(meta Base) *Set {
+	return &Set{items: s.items, Meta: meta, pos: s.pos}
+}
+
+// WithPosition returns the same set with its span in the source
+func (s *Set) WithPosition(pos Position) *Set {
+	return &Set{items: s.items, Meta: s.Meta, pos: &pos}
+}
+
+func (s *Set) Data() []Base {
+	return s.items.Keys()
+}
+
+// Hash implements Hasher, the order of members does not affect the hash
+func (s *Set) Hash() uint64 {
+	return hashSet(s)
+}
+
+// Equals implements Equaler, sets are equal when they have equal members
+func (s *Set) Equals(other Base) bool {
+	return equalSets(s, other)
+}
+
+// members is the read only view shared by Set and SortedSet
+type members interface {
+	Count() int
+	Contains(Base) bool
+	Data() []Base
+}
+
+func asMembers(val Base) (members, bool) {
+	switch set := val.(type) {
+	case *Set:
+		return set, true
+	case *SortedSet:
+		return set, true
+	default:
+		return nil, false
+	}
+}
+
+func hashSet(set members) uint64 {
+	hash := seedSet
+	for _, item := range set.Data() {
+		hash += Hash(item)
+	}
+	return hash
+}
+
+func equalSets(set members, other Base) bool {
+	otherSet, ok := asMembers(other)
+	if !ok || set.Count() != otherSet.Count() {
+		return false
+	}
+	for _, item := range set.Data() {
+		if !otherSet.Contains(item) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,366 @@
+package types
+
+// treeNode is a node in a persistent AVL tree. Updates copy the path from the
+// root to the changed node and rebalance it, sharing every other node.
+type treeNode struct {
+	key, val    Base
+	left, right *treeNode
+	height      int
+}
+
+func newTreeNode(key, val Base, left, right *treeNode) *treeNode {
+	height := treeHeight(left)
+	if rh := treeHeight(right); rh > height {
+		height = rh
+	}
+	return &treeNode{key: key, val: val, left: left, right: right, height: height + 1}
+}
+
+func treeHeight(node *treeNode) int {
+	if node == nil {
+		return 0
+	}
+	return node.height
+}
+
+func balanceTree(key, val Base, left, right *treeNode) *treeNode {
+	switch diff := treeHeight(left) - treeHeight(right); {
+	case diff > 1:
+		if treeHeight(left.left) < treeHeight(left.right) {
+			left = rotateLeft(left)
+		}
+		return rotateRight(newTreeNode(key, val, left, right))
+	case diff < -1:
+		if treeHeight(right.right) < treeHeight(right.left) {
+			right = rotateRight(right)
+		}
+		return rotateLeft(newTreeNode(key, val, left, right))
+	default:
+		return newTreeNode(key, val, left, right)
+	}
+}
+
+func rotateRight(node *treeNode) *treeNode {
+	left := node.left
+	return newTreeNode(left.key, left.val, left.left, newTreeNode(node.key, node.val, left.right, node.right))
+}
+
+func rotateLeft(node *treeNode) *treeNode {
+	right := node.right
+	return newTreeNode(right.key, right.val, newTreeNode(node.key, node.val, node.left, right.left), right.right)
+}
+
+func treeGet(node *treeNode, key Base, cmp Comparator) (*treeNode, error) {
+	for node != nil {
+		c, err := cmp(key, node.key)
+		switch {
+		case err != nil:
+			return nil, err
+		case c < 0:
+			node = node.left
+		case c > 0:
+			node = node.right
+		default:
+			return node, nil
+		}
+	}
+	return nil, nil
+}
+
+func treeInsert(node *treeNode, key, val Base, cmp Comparator) (*treeNode, bool, error) {
+	if node == nil {
+		return newTreeNode(key, val, nil, nil), true, nil
+	}
+	c, err := cmp(key, node.key)
+	if err != nil {
+		return nil, false, err
+	} else if c == 0 {
+		return newTreeNode(node.key, val, node.left, node.right), false, nil
+	} else if c < 0 {
+		left, added, err := treeInsert(node.left, key, val, cmp)
+		if err != nil {
+			return nil, false, err
+		}
+		return balanceTree(node.key, node.val, left, node.right), added, nil
+	}
+	right, added, err := treeInsert(node.right, key, val, cmp)
+	if err != nil {
+		return nil, false, err
+	}
+	return balanceTree(node.key, node.val, node.left, right), added, nil
+}
+
+func treeDelete(node *treeNode, key Base, cmp Comparator) (*treeNode, bool, error) {
+	if node == nil {
+		return nil, false, nil
+	}
+	c, err := cmp(key, node.key)
+	if err != nil {
+		return nil, false, err
+	} else if c < 0 {
+		left, removed, err := treeDelete(node.left, key, cmp)
+		if err != nil || !removed {
+			return node, false, err
+		}
+		return balanceTree(node.key, node.val, left, node.right), true, nil
+	} else if c > 0 {
+		right, removed, err := treeDelete(node.right, key, cmp)
+		if err != nil || !removed {
+			return node, false, err
+		}
+		return balanceTree(node.key, node.val, node.left, right), true, nil
+	} else if node.left == nil {
+		return node.right, true, nil
+	} else if node.right == nil {
+		return node.left, true, nil
+	}
+	successor := node.right
+	for successor.left != nil {
+		successor = successor.left
+	}
+	return balanceTree(successor.key, successor.val, node.left, treeDeleteMin(node.right)), true, nil
+}
+
+func treeDeleteMin(node *treeNode) *treeNode {
+	if node.left == nil {
+		return node.right
+	}
+	return balanceTree(node.key, node.val, treeDeleteMin(node.left), node.right)
+}
+
+// treeWalk visits nodes in order, or in reverse order when ascending is false,
+// until fn returns false. When from is given the walk begins at the first node
+// at or past that key in the direction of the walk.
+func treeWalk(node *treeNode, ascending bool, from []Base, cmp Comparator, fn func(*treeNode) bool) (bool, error) {
+	if node == nil {
+		return true, nil
+	}
+	first, second := node.left, node.right
+	if !ascending {
+		first, second = second, first
+	}
+	if len(from) > 0 {
+		c, err := cmp(node.key, from[0])
+		if err != nil {
+			return false, err
+		} else if (ascending && c < 0) || (!ascending && c > 0) {
+			return treeWalk(second, ascending, from, cmp, fn)
+		}
+	}
+	if cont, err := treeWalk(first, ascending, from, cmp, fn); err != nil || !cont {
+		return cont, err
+	} else if !fn(node) {
+		return false, nil
+	}
+	return treeWalk(second, ascending, nil, cmp, fn)
+}
+
+// SortedMap is a persistent map that keeps its entries ordered by key using a
+// comparator.
+type SortedMap struct {
+	root  *treeNode
+	count int
+	cmp   Comparator
+	Meta  Base
+}
+
+// NewSortedMap creates a sorted map from key value pairs. If cmp is nil the
+// default Compare is used.
+func NewSortedMap(cmp Comparator, values ...Base) (*SortedMap, error) {
+	if cmp == nil {
+		cmp = Compare
+	}
+	return (&SortedMap{cmp: cmp}).Assoc(values...)
+}
+
+// Comparator returns the function used to order the keys of the map
+func (sm *SortedMap) Comparator() Comparator { return sm.cmp }
+
+// Count returns the number of entries in the map
+func (sm *SortedMap) Count() int { return sm.count }
+
+// Lookup finds the value for a key, returning an error if the comparator
+// could not compare the key to the keys in the map
+func (sm *SortedMap) Lookup(key Base) (Base, bool, error) {
+	node, err := treeGet(sm.root, key, sm.cmp)
+	if err != nil || node == nil {
+		return nil, false, err
+	}
+	return node.val, true, nil
+}
+
+// Get looks up the value for a key and reports if it was found
+func (sm *SortedMap) Get(key Base) (Base, bool) {
+	val, found, _ := sm.Lookup(key)
+	return val, found
+}
+
+// Contains reports if the key is in the map
+func (sm *SortedMap) Contains(key Base) bool {
+	_, found := sm.Get(key)
+	return found
+}
+
+// Assoc returns a new map with the key value pairs added to it
+func (sm *SortedMap) Assoc(values ...Base) (*SortedMap, error) {
+	if len(values)%2 == 1 {
+		return nil, Errorf(ArityError, "Odd number of arguments to assoc")
+	}
+	result := &SortedMap{root: sm.root, count: sm.count, cmp: sm.cmp, Meta: sm.Meta}
+	for i := 0; i < len(values); i += 2 {
+		root, added, err := treeInsert(result.root, values[i], values[i+1], sm.cmp)
+		if err != nil {
+			return nil, err
+		}
+		result.root = root
+		if added {
+			result.count++
+		}
+	}
+	return result, nil
+}
+
+// Dissoc returns a new map without the given keys
+func (sm *SortedMap) Dissoc(keys ...Base) (*SortedMap, error) {
+	result := &SortedMap{root: sm.root, count: sm.count, cmp: sm.cmp, Meta: sm.Meta}
+	for _, key := range keys {
+		root, removed, err := treeDelete(result.root, key, sm.cmp)
+		if err != nil {
+			return nil, err
+		} else if removed {
+			result.root = root
+			result.count--
+		}
+	}
+	return result, nil
+}
+
+// WithMeta returns the same map with different metadata
+func (sm *SortedMap) WithMeta(meta Base) *SortedMap {
+	return &SortedMap{root: sm.root, count: sm.count, cmp: sm.cmp, Meta: meta}
+}
+
+// Range calls fn for every entry in key order until fn returns false
+func (sm *SortedMap) Range(fn func(key, val Base) bool) {
+	treeWalk(sm.root, true, nil, sm.cmp, func(node *treeNode) bool { return fn(node.key, node.val) })
+}
+
+// Seek walks the entries in order, or reverse order when ascending is false,
+// starting at from if it is given, until fn returns false.
+func (sm *SortedMap) Seek(ascending bool, from []Base, fn func(key, val Base) bool) error {
+	_, err := treeWalk(sm.root, ascending, from, sm.cmp, func(node *treeNode) bool { return fn(node.key, node.val) })
+	return err
+}
+
+func (sm *SortedMap) ToList() []Base {
+	values := make([]Base, 0, sm.count*2)
+	sm.Range(func(key, val Base) bool {
+		values = append(values, key, val)
+		return true
+	})
+	return values
+}
+
+func (sm *SortedMap) Keys() []Base {
+	keys := make([]Base, 0, sm.count)
+	sm.Range(func(key, val Base) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (sm *SortedMap) Vals() []Base {
+	vals := make([]Base, 0, sm.count)
+	sm.Range(func(key, val Base) bool {
+		vals = append(vals, val)
+		return true
+	})
+	return vals
+}
+
+// SortedSet is a persistent set that keeps its members ordered using a
+// comparator.
+type SortedSet struct {
+	items *SortedMap
+	Meta  Base
+}
+
+// NewSortedSet creates a sorted set of the items. If cmp is nil the default
+// Compare is used.
+func NewSortedSet(cmp Comparator, items ...Base) (*SortedSet, error) {
+	set, err := NewSortedMap(cmp)
+	if err != nil {
+		return nil, err
+	}
+	return (&SortedSet{items: set}).Conj(items...)
+}
+
+// Comparator returns the function used to order the members of the set
+func (ss *SortedSet) Comparator() Comparator { return ss.items.cmp }
+
+// Count returns the number of members in the set
+func (ss *SortedSet) Count() int { return ss.items.Count() }
+
+// Get returns the member of the set equal to val and reports if it was found
+func (ss *SortedSet) Get(val Base) (Base, bool) {
+	node, err := treeGet(ss.items.root, val, ss.items.cmp)
+	if err != nil || node == nil {
+		return nil, false
+	}
+	return node.key, true
+}
+
+// Contains reports if the value is a member of the set
+func (ss *SortedSet) Contains(val Base) bool {
+	return ss.items.Contains(val)
+}
+
+// Conj returns a new set with the values added to it
+func (ss *SortedSet) Conj(vals ...Base) (*SortedSet, error) {
+	items := ss.items
+	for _, val := range vals {
+		if items.Contains(val) {
+			continue
+		}
+		var err error
+		if items, err = items.Assoc(val, val); err != nil {
+			return nil, err
+		}
+	}
+	return &SortedSet{items: items, Meta: ss.Meta}, nil
+}
+
+// Disj returns a new set without the values
+func (ss *SortedSet) Disj(vals ...Base) (*SortedSet, error) {
+	items, err := ss.items.Dissoc(vals...)
+	if err != nil {
+		return nil, err
+	}
+	return &SortedSet{items: items, Meta: ss.Meta}, nil
+}
+
+// WithMeta returns the same set with different metadata
+func (ss *SortedSet) WithMeta(meta Base) *SortedSet {
+	return &SortedSet{items: ss.items, Meta: meta}
+}
+
+// Seek walks the members in order, or reverse order when ascending is false,
+// starting at from if it is given, until fn returns false.
+func (ss *SortedSet) Seek(ascending bool, from []Base, fn func(val Base) bool) error {
+	return ss.items.Seek(ascending, from, func(key, val Base) bool { return fn(key) })
+}
+
+func (ss *SortedSet) Data() []Base {
+	return ss.items.Keys()
+}
+
+// Hash implements Hasher, sorted sets hash the same as sets with equal members
+func (ss *SortedSet) Hash() uint64 {
+	return hashSet(ss)
+}
+
+// Equals implements Equaler, sorted sets are equal to any set with equal members
+func (ss *SortedSet) Equals(other Base) bool {
+	return equalSets(ss, other)
+}
@@ -0,0 +1,85 @@
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+func reverseCompare(a, b Base) (int, error) {
+	cmp, err := Compare(a, b)
+	return -cmp, err
+}
+
+func TestSortedMapOrder(t *testing.T) {
+	sm := mustSortedMap()
+	for _, key := range []int64{5, 3, 8, 1, 4, 7, 9, 2, 6} {
+		var err error
+		if sm, err = sm.Assoc(key, key*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := sm.Keys(); !Equal(NewVect(keys...), NewVect(int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(7), int64(8), int64(9))) {
+		t.Fatalf("expected keys in order, got %v", keys)
+	}
+	smaller, err := sm.Dissoc(int64(5), int64(1))
+	if err != nil {
+		t.Fatal(err)
+	} else if sm.Count() != 9 || smaller.Count() != 7 || smaller.Contains(int64(5)) {
+		t.Fatalf("expected dissoc to leave the original, got %v and %v", sm.Keys(), smaller.Keys())
+	}
+	if val, found := sm.Get(int64(7)); !found || val != int64(70) {
+		t.Fatalf("expected 70, got %v %v", val, found)
+	}
+}
+
+func TestSortedSetComparator(t *testing.T) {
+	ss, err := NewSortedSet(reverseCompare, "b", "c", "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	} else if data := ss.Data(); !Equal(NewVect(data...), NewVect("c", "b", "a")) {
+		t.Fatalf("expected members in comparator order without duplicates, got %v", data)
+	}
+	if _, err := ss.Conj(mustHashmap()); !errors.Is(err, TypeError) {
+		t.Fatalf("expected a type error comparing a map to strings, got %v", err)
+	}
+}
+
+func TestSortedSeek(t *testing.T) {
+	ss := mustSortedSet(int64(1), int64(3), int64(5), int64(7), int64(9))
+	cases := []struct {
+		name      string
+		ascending bool
+		from      []Base
+		expected  *Vector
+	}{
+		{"all ascending", true, nil, NewVect(int64(1), int64(3), int64(5), int64(7), int64(9))},
+		{"all descending", false, nil, NewVect(int64(9), int64(7), int64(5), int64(3), int64(1))},
+		{"from a member", true, []Base{int64(5)}, NewVect(int64(5), int64(7), int64(9))},
+		{"from between members", true, []Base{int64(4)}, NewVect(int64(5), int64(7), int64(9))},
+		{"descending from between members", false, []Base{int64(6)}, NewVect(int64(5), int64(3), int64(1))},
+		{"from past the end", true, []Base{int64(10)}, NewVect()},
+		{"descending from before the start", false, []Base{int64(0)}, NewVect()},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			found := []Base{}
+			if err := ss.Seek(c.ascending, c.from, func(val Base) bool {
+				found = append(found, val)
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			} else if !Equal(NewVect(found...), c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected.Data(), found)
+			}
+		})
+	}
+
+	visited := 0
+	ss.Seek(true, nil, func(val Base) bool {
+		visited++
+		return val != int64(3)
+	})
+	if visited != 2 {
+		t.Fatalf("expected seek to stop when fn returns false, visited %v", visited)
+	}
+}
@@ -0,0 +1,19 @@
+package types
+
+// Stream holds a writer, reader or line reader of the host, like the roots of
+// *out*, *err* and *in*. Unlike a GoValue its methods cannot be called from wot
+// code so scripts can print and read through it without being able to close
+// or otherwise reach the host's files.
+type Stream struct {
+	Name Symbol
+	val  interface{}
+}
+
+func NewStream(name Symbol, val interface{}) *Stream {
+	return &Stream{Name: name, val: val}
+}
+
+// Val is the wrapped stream
+func (s *Stream) Val() interface{} {
+	return s.val
+}
@@ -1,99 +1,40 @@
 package types
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"math/big"
 )
 
 type (
 	Base    interface{}
-	Atom    struct{ Val Base }
 	Symbol  string
 	Keyword string
 )
 
 type Env interface {
-	Child([]Base, []Base) (Env, error)
+	Child() Env
 	Find(Symbol) Env
 	Set(Symbol, Base)
 	Get(Symbol) (Base, error)
 }
 
+// Collection is implemented by the sequential collections, lists and vectors
 type Collection interface {
 	Data() []Base
+	Count() int
+	Nth(int) (Base, bool)
 }
 
-type List struct {
-	Forms []Base
-	Meta  Base
-}
-
-func NewList(forms ...Base) *List {
-	return &List{Forms: forms}
-}
-
-func (l *List) Data() []Base { return l.Forms }
-
-type Vector struct {
-	Forms []Base
-	Meta  Base
-}
-
-func NewVect(forms ...Base) *Vector {
-	return &Vector{Forms: forms}
-}
-
-func (l *Vector) Data() []Base { return l.Forms }
-
-type Hashmap struct {
-	Forms map[Base]Base
-	Meta  Base
-}
-
-func NewHashmap(values []Base, excludeKeys ...Base) (*Hashmap, error) {
-	if len(values)%2 == 1 {
-		return nil, errors.New("Odd number of arguments to NewHashMap")
-	}
-	m := map[Base]Base{}
-	for i := 0; i < len(values); i += 2 {
-		key := values[i]
-		found := false
-		for _, exclude := range excludeKeys {
-			if key == exclude {
-				found = true
-				break
-			}
-		}
-		if !found {
-			m[key] = values[i+1]
-		}
-	}
-	return &Hashmap{Forms: m}, nil
-}
-
-func (hm *Hashmap) ToList() []Base {
-	values := []Base{}
-	for key, val := range hm.Forms {
-		values = append(values, key)
-		values = append(values, val)
-	}
-	return values
-}
-
-func (hm *Hashmap) Keys() []Base {
-	keys := make([]Base, 0, len(hm.Forms))
-	for k := range hm.Forms {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
-func (hm *Hashmap) Vals() []Base {
-	vals := make([]Base, 0, len(hm.Forms))
-	for _, v := range hm.Forms {
-		vals = append(vals, v)
-	}
-	return vals
+// Map is implemented by the associative collections, hash maps and sorted maps
+type Map interface {
+	Count() int
+	Get(key Base) (Base, bool)
+	Contains(key Base) bool
+	Range(fn func(key, val Base) bool)
+	ToList() []Base
+	Keys() []Base
+	Vals() []Base
 }
 
 type StdFunc struct {
@@ -105,48 +46,67 @@ func Func(fn func(Env, []Base) (Base, error)) *StdFunc {
 	return &StdFunc{Fn: fn}
 }
 
+// ExtFunc is a function defined in wot with fn*. It has one or more arities and
+// a call is dispatched to the arity that accepts the number of arguments.
 type ExtFunc struct {
-	AST     Base
-	Params  []Base
+	Name    string
+	Arities []*Arity
 	Env     Env
 	IsMacro bool
-	eval    func(Env, Base) (Base, error)
+	eval    func(context.Context, Env, *Arity, []Base) (Base, error)
 	Meta    Base
 }
 
-func NewFunc(env Env, eval func(Env, Base) (Base, error), args ...Base) (*ExtFunc, error) {
-	if len(args) < 2 {
-		return nil, errors.New("improperly formatted fn* statement")
+// NewFunc creates a function from the arguments to fn*, either a single
+// parameter list followed by the body or a list of arities like
+// ([x] body) ([x y] body). eval is called with the env of the function to bind
+// the arguments to the parameters of an arity and evaluate its body.
+func NewFunc(env Env, eval func(context.Context, Env, *Arity, []Base) (Base, error), args ...Base) (*ExtFunc, error) {
+	if len(args) < 1 {
+		return nil, Errorf(SyntaxError, "improperly formatted fn* statement")
 	}
 
-	var params []Base
-	switch tparams := args[0].(type) {
-	case Collection:
-		params = tparams.Data()
-	default:
-		return nil, errors.New("invalid fn* param declaration")
+	var arities []*Arity
+	if isMultiArity(args) {
+		for _, arg := range args {
+			arity, err := newArity(arg.(*List).Data())
+			if err != nil {
+				return nil, err
+			}
+			arities = append(arities, arity)
+		}
+	} else {
+		arity, err := newArity(args)
+		if err != nil {
+			return nil, err
+		}
+		arities = append(arities, arity)
+	}
+
+	if err := checkArities(arities); err != nil {
+		return nil, err
 	}
 
 	return &ExtFunc{
-		AST:    args[1],
-		Params: params,
-		Env:    env,
-		eval:   eval,
+		Arities: arities,
+		Env:     env,
+		eval:    eval,
 	}, nil
 }
 
-func (fn *ExtFunc) Apply(arguments []Base) (Base, error) {
-	newEnv, err := fn.Env.Child(fn.Params, arguments)
+// Apply calls the function with the arguments, evaluating its body with ctx
+func (fn *ExtFunc) Apply(ctx context.Context, arguments []Base) (Base, error) {
+	arity, err := fn.Dispatch(arguments)
 	if err != nil {
 		return nil, err
 	}
-	return fn.eval(newEnv, fn.AST)
+	return fn.eval(ctx, fn.Env, arity, arguments)
 }
 
 func (fn *ExtFunc) Clone() *ExtFunc {
 	return &ExtFunc{
-		AST:     fn.AST,
-		Params:  fn.Params,
+		Name:    fn.Name,
+		Arities: fn.Arities,
 		Env:     fn.Env,
 		eval:    fn.eval,
 		IsMacro: fn.IsMacro,
@@ -158,16 +118,85 @@ func CallFunc(e Env, baseFn Base, arguments []Base) (Base, error) {
 	case *StdFunc:
 		return fn.Fn(e, arguments)
 	case *ExtFunc:
-		return fn.Apply(arguments)
+		return fn.Apply(ContextOf(e), arguments)
+	case *Set:
+		if len(arguments) != 1 {
+			return nil, Errorf(ArityError, "wrong number of arguments passed to set")
+		}
+		val, _ := fn.Get(arguments[0])
+		return val, nil
+	case *SortedSet:
+		if len(arguments) != 1 {
+			return nil, Errorf(ArityError, "wrong number of arguments passed to set")
+		}
+		val, _ := fn.Get(arguments[0])
+		return val, nil
 	default:
-		return nil, fmt.Errorf("attempt to call non-function %v", baseFn)
+		return nil, Errorf(TypeError, "attempt to call non-function %v", baseFn)
 	}
 }
 
-type UserError struct {
-	Val Base
-}
-
-func (err UserError) Error() string {
-	return "User Error"
+// TypeName returns a human readable name for the type of a value for use in
+// error messages.
+func TypeName(val Base) string {
+	switch val.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case Symbol:
+		return "symbol"
+	case Keyword:
+		return "keyword"
+	case int64, *big.Int:
+		return "integer"
+	case *big.Rat:
+		return "ratio"
+	case *Decimal:
+		return "decimal"
+	case float64:
+		return "float"
+	case *List:
+		return "list"
+	case *Vector:
+		return "vector"
+	case Seq, *LazySeq:
+		return "seq"
+	case *Hashmap:
+		return "map"
+	case *Set:
+		return "set"
+	case *SortedMap:
+		return "sorted-map"
+	case *SortedSet:
+		return "sorted-set"
+	case *StdFunc, *ExtFunc:
+		return "function"
+	case *Atom:
+		return "atom"
+	case *Ref:
+		return "ref"
+	case *Agent:
+		return "agent"
+	case *Var:
+		return "var"
+	case *Future:
+		return "future"
+	case *Promise:
+		return "promise"
+	case *Chan:
+		return "channel"
+	case *Mult:
+		return "mult"
+	case *ExInfo:
+		return "error"
+	case *Stream:
+		return "stream"
+	case *GoValue:
+		return fmt.Sprintf("%T", val.(*GoValue).Val)
+	default:
+		return fmt.Sprintf("%T", val)
+	}
 }
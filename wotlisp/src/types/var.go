@@ -0,0 +1,95 @@
+package types
+
+import (
+	"context"
+	"sync"
+)
+
+// Var is a global whose value can be rebound with binding when it is dynamic.
+// Bindings are kept in the context so they follow the evaluation down the call
+// stack, and into futures started from it, without being seen by other
+// goroutines.
+type Var struct {
+	Name    Symbol
+	Dynamic bool
+	mu      sync.RWMutex
+	root    Base
+}
+
+func NewVar(name Symbol, val Base, dynamic bool) *Var {
+	return &Var{Name: name, Dynamic: dynamic, root: val}
+}
+
+// Value is the value the var is bound to in ctx, or its root value if it is
+// not bound
+func (v *Var) Value(ctx context.Context) Base {
+	if b := bindingOf(ctx, v); b != nil {
+		return b.get()
+	}
+	return v.Root()
+}
+
+// Root is the value of the var outside of any binding
+func (v *Var) Root() Base {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.root
+}
+
+// SetRoot sets the value of the var outside of any binding
+func (v *Var) SetRoot(val Base) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.root = val
+}
+
+// Set changes the value of the binding of the var in ctx, it is an error if
+// the var is not bound
+func (v *Var) Set(ctx context.Context, val Base) error {
+	b := bindingOf(ctx, v)
+	if b == nil {
+		return Errorf(StateError, "cannot set! %v outside of a binding", v.Name)
+	}
+	b.set(val)
+	return nil
+}
+
+type bindingsKey struct{}
+
+// varBinding is the value of a var in a binding form. set! changes it in
+// place so every function called in the form sees the change.
+type varBinding struct {
+	mu  sync.RWMutex
+	val Base
+}
+
+func (b *varBinding) get() Base {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.val
+}
+
+func (b *varBinding) set(val Base) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.val = val
+}
+
+// WithBindings returns ctx with the vars bound to the values, on top of any
+// bindings already in ctx
+func WithBindings(ctx context.Context, vals map[*Var]Base) context.Context {
+	outer, _ := ctx.Value(bindingsKey{}).(map[*Var]*varBinding)
+	bindings := make(map[*Var]*varBinding, len(outer)+len(vals))
+	for v, b := range outer {
+		bindings[v] = b
+	}
+	for v, val := range vals {
+		bindings[v] = &varBinding{val: val}
+	}
+	return context.WithValue(ctx, bindingsKey{}, bindings)
+}
+
+func bindingOf(ctx context.Context, v *Var) *varBinding {
+	bindings, _ := ctx.Value(bindingsKey{}).(map[*Var]*varBinding)
+	return bindings[v]
+}
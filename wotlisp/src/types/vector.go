@@ -0,0 +1,211 @@
+package types
+
+// Vector is a persistent vector stored as a 32 way trie with the last partial
+// leaf kept on the side as the tail. Lookups, updates and appends only touch
+// a path of log32(n) nodes so unchanged parts of the trie are shared between
+// versions.
+type Vector struct {
+	count int
+	shift uint
+	root  *vectorNode
+	tail  []Base
+	Meta  Base
+	// pos is the span of a vector read from source and positions are the
+	// positions of its symbols. They are kept out of Meta so user code does
+	// not see them.
+	pos       *Position
+	positions []Position
+}
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// vectorNode is a branch of the trie when children is set and a leaf holding
+// up to 32 values otherwise.
+type vectorNode struct {
+	children []*vectorNode
+	values   []Base
+}
+
+var emptyVectorNode = &vectorNode{}
+
+func NewVect(forms ...Base) *Vector {
+	return (&Vector{shift: vectorBits, root: emptyVectorNode}).Conj(forms...)
+}
+
+// Count returns the length of the vector
+func (v *Vector) Count() int { return v.count }
+
+// Nth returns the value at index i and reports if the index was in range
+func (v *Vector) Nth(i int) (Base, bool) {
+	if i < 0 || i >= v.count {
+		return nil, false
+	}
+	return v.leafFor(i)[i&vectorMask], true
+}
+
+// Conj returns a new vector with the values added to the end
+func (v *Vector) Conj(vals ...Base) *Vector {
+	result := &Vector{count: v.count, shift: v.shift, root: v.root, tail: v.tail}
+	ownsTail := false
+	for _, val := range vals {
+		if len(result.tail) == vectorWidth {
+			result.pushTail()
+			result.tail, ownsTail = make([]Base, 0, vectorWidth), true
+		} else if !ownsTail {
+			result.tail, ownsTail = append(make([]Base, 0, vectorWidth), result.tail...), true
+		}
+		result.tail = append(result.tail, val)
+		result.count++
+	}
+	return result
+}
+
+// Assoc returns a new vector with the value at index i replaced. Associating at
+// the index just past the end appends the value.
+func (v *Vector) Assoc(i int, val Base) (*Vector, error) {
+	if i == v.count {
+		return v.Conj(val), nil
+	} else if i < 0 || i > v.count {
+		return nil, Errorf(IndexError, "index out of bounds").With(Keyword("index"), int64(i), Keyword("count"), int64(v.count))
+	}
+	result := &Vector{count: v.count, shift: v.shift, root: v.root, tail: v.tail}
+	if i >= v.tailOffset() {
+		result.tail = append([]Base{}, v.tail...)
+		result.tail[i&vectorMask] = val
+	} else {
+		result.root = assocNode(v.shift, v.root, i, val)
+	}
+	return result, nil
+}
+
+// Pop returns a new vector without its last value
+func (v *Vector) Pop() (*Vector, error) {
+	switch {
+	case v.count == 0:
+		return nil, Errorf(IndexError, "cannot pop empty vector")
+	case v.count == 1:
+		return NewVect(), nil
+	case v.count-v.tailOffset() > 1:
+		return &Vector{count: v.count - 1, shift: v.shift, root: v.root, tail: v.tail[:len(v.tail)-1]}, nil
+	}
+	result := &Vector{count: v.count - 1, shift: v.shift, tail: v.leafFor(v.count - 2)}
+	result.root = v.popTail(v.shift, v.root)
+	if result.root == nil {
+		result.root = emptyVectorNode
+	}
+	if result.shift > vectorBits && len(result.root.children) == 1 {
+		result.root = result.root.children[0]
+		result.shift -= vectorBits
+	}
+	return result, nil
+}
+
+// WithMeta returns the same vector with different metadata
+func (v *Vector) WithMeta(meta Base) *Vector {
+	return &Vector{count: v.count, shift: v.shift, root: v.root, tail: v.tail, Meta: meta, pos: v.pos, positions: v.positions}
+}
+
+// WithPosition returns the same vector with its span in the source, see
+// PositionOf
+func (v *Vector) WithPosition(pos Position) *Vector {
+	return &Vector{count: v.count, shift: v.shift, root: v.root, tail: v.tail, Meta: v.Meta, pos: &pos, positions: v.positions}
+}
+
+// WithPositions returns the same vector with the source positions of its
+// symbols, see SymbolPosition
+func (v *Vector) WithPositions(positions []Position) *Vector {
+	return &Vector{count: v.count, shift: v.shift, root: v.root, tail: v.tail, Meta: v.Meta, pos: v.pos, positions: positions}
+}
+
+func (v *Vector) Data() []Base {
+	data := make([]Base, 0, v.count)
+	for i := 0; i < v.count; i += vectorWidth {
+		data = append(data, v.leafFor(i)...)
+	}
+	return data
+}
+
+func (v *Vector) tailOffset() int {
+	if v.count < vectorWidth {
+		return 0
+	}
+	return ((v.count - 1) >> vectorBits) << vectorBits
+}
+
+func (v *Vector) leafFor(i int) []Base {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values
+}
+
+// pushTail moves a full tail into the trie, growing the trie by a level when
+// the root is full.
+func (v *Vector) pushTail() {
+	leaf := &vectorNode{values: v.tail}
+	if (v.count >> vectorBits) > (1 << v.shift) {
+		v.root = &vectorNode{children: []*vectorNode{v.root, newVectorPath(v.shift, leaf)}}
+		v.shift += vectorBits
+		return
+	}
+	v.root = v.pushLeaf(v.shift, v.root, leaf)
+}
+
+func (v *Vector) pushLeaf(level uint, parent, leaf *vectorNode) *vectorNode {
+	idx := ((v.count - 1) >> level) & vectorMask
+	children := make([]*vectorNode, idx+1)
+	copy(children, parent.children)
+	if level == vectorBits {
+		children[idx] = leaf
+	} else if idx < len(parent.children) {
+		children[idx] = v.pushLeaf(level-vectorBits, parent.children[idx], leaf)
+	} else {
+		children[idx] = newVectorPath(level-vectorBits, leaf)
+	}
+	return &vectorNode{children: children}
+}
+
+func (v *Vector) popTail(level uint, node *vectorNode) *vectorNode {
+	idx := ((v.count - 2) >> level) & vectorMask
+	if level > vectorBits {
+		child := v.popTail(level-vectorBits, node.children[idx])
+		if child == nil && idx == 0 {
+			return nil
+		} else if child == nil {
+			return &vectorNode{children: append([]*vectorNode{}, node.children[:idx]...)}
+		}
+		children := append([]*vectorNode{}, node.children[:idx+1]...)
+		children[idx] = child
+		return &vectorNode{children: children}
+	} else if idx == 0 {
+		return nil
+	}
+	return &vectorNode{children: append([]*vectorNode{}, node.children[:idx]...)}
+}
+
+func newVectorPath(level uint, leaf *vectorNode) *vectorNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode{children: []*vectorNode{newVectorPath(level-vectorBits, leaf)}}
+}
+
+func assocNode(level uint, node *vectorNode, i int, val Base) *vectorNode {
+	if level == 0 {
+		values := append([]Base{}, node.values...)
+		values[i&vectorMask] = val
+		return &vectorNode{values: values}
+	}
+	idx := (i >> level) & vectorMask
+	children := append([]*vectorNode{}, node.children...)
+	children[idx] = assocNode(level-vectorBits, node.children[idx], i, val)
+	return &vectorNode{children: children}
+}
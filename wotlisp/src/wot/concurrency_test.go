@@ -0,0 +1,337 @@
+package wot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tanema/mal/wotlisp/src/printer"
+)
+
+// TestConcurrentEvaluation runs evaluations over the same root env at the
+// same time. Run it with go test -race.
+func TestConcurrentEvaluation(t *testing.T) {
+	ctx := context.Background()
+	interp := New(WithStdout(ioutil.Discard))
+	if _, err := interp.EvalString(ctx, `
+		(def! counter (atom 0))
+		(def! changes (atom 0))
+		(add-watch counter :count (fn* [k a old new] (swap! changes inc)))
+		(def! bump (fn* [n] (loop* [i 0] (if (< i n) (do (swap! counter inc) (recur (+ i 1))) n))))`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			src := fmt.Sprintf(`(do (def! local-%v (map inc (range 10))) (bump 250) (apply + local-%v))`, i, i)
+			if _, err := interp.EvalString(ctx, src); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for name, expected := range map[string]int64{"(deref counter)": 2000, "(deref changes)": 2000} {
+		val, err := interp.EvalString(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		} else if val != expected {
+			t.Errorf("expected %v to be %v, got %v", name, expected, val)
+		}
+	}
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	ctx := context.Background()
+	interp := New(WithStdout(ioutil.Discard))
+	if _, err := interp.EvalString(ctx, `(def! seen (atom #{})) (def! see (fn* [x] (swap! seen conj x)))`); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := interp.Call(ctx, "see", i); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	count, err := interp.EvalString(ctx, "(count @seen)")
+	if err != nil {
+		t.Fatal(err)
+	} else if count != int64(100) {
+		t.Fatalf("expected 100 values to be seen, got %v", count)
+	}
+}
+
+// printCase is source to evaluate and how its result should print
+type printCase struct {
+	src      string
+	expected string
+}
+
+// evalPrinted runs the cases in order, each with a fresh interpreter so that
+// one case cannot leave goroutines or definitions behind for the next.
+func evalPrinted(t *testing.T, cases []printCase) {
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			val, err := New(WithStdout(ioutil.Discard)).EvalString(context.Background(), c.src)
+			if err != nil {
+				t.Fatal(err)
+			} else if printed := printer.Print(val, true); printed != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, printed)
+			}
+		})
+	}
+}
+
+func TestFutures(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{"(pmap (fn* [x] (* x x)) (range 20))", "(0 1 4 9 16 25 36 49 64 81 100 121 144 169 196 225 256 289 324 361)"},
+		{"(pcalls (fn* [] 1) (fn* [] 2) (fn* [] 3))", "(1 2 3)"},
+		{"(let* [p (promise)] (do (future (deliver p 1)) @p))", "1"},
+		{"(deref (promise) 10 :timeout)", ":timeout"},
+		{"(try* @(future (throw :oops)) (catch* e e))", ":oops"},
+		{"(let* [f (future (loop* [] (recur)))] (do (future-cancel f) (future-cancelled? f)))", "true"},
+	})
+}
+
+func TestFutureCancelledWithContext(t *testing.T) {
+	interp := New(WithStdout(ioutil.Discard))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := interp.EvalString(ctx, "@(future (loop* [] (recur)))"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to stop the deref, got %v", err)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	evalPrinted(t, []printCase{
+		{"(let* [c (chan 1)] (do (>!! c 1) (close! c) [(<!! c) (<!! c)]))", "[1 nil]"},
+		{"(let* [c (chan (sliding-buffer 2))] (do (>!! c 1) (>!! c 2) (>!! c 3) (<!! c)))", "2"},
+		{"(let* [c (chan (dropping-buffer 2))] (do (>!! c 1) (>!! c 2) (>!! c 3) (<!! c)))", "1"},
+		{"(<!! (go (+ 1 2)))", "3"},
+		{"(<!! (go (throw :oops)))", ":oops"},
+		{"(first (alts!! [(chan) (timeout 10)]))", "nil"},
+		{"(alts!! [(chan)] :default :none)", "[:none :default]"},
+		{"(let* [c (chan)] (do (go (>!! c :hi)) (first (alts!! [(chan) c]))))", ":hi"},
+		{"(let* [c (chan 1)] (do (alts!! [[c :x]]) (<!! c)))", ":x"},
+		{"(let* [from (chan) to (pipe from (chan 2))] (do (>!! from 1) (close! from) [(<!! to) (<!! to)]))", "[1 nil]"},
+		{"(let* [c (chan) m (mult c) a (tap m (chan 1)) b (tap m (chan 1))] (do (>!! c 1) [(<!! a) (<!! b)]))", "[1 1]"},
+		{"(let* [a (chan 1) b (chan 1) c (merge-chans [a b])] (do (>!! a 1) (>!! b 2) (close! a) (close! b) (+ (<!! c) (<!! c))))", "3"},
+		{"(let* [chans (map (fn* [x] (let* [c (chan 1)] (do (>!! c x) (close! c) c))) [1 2]) c (merge-chans chans)] (+ (<!! c) (<!! c)))", "3"},
+		{"(let* [c (chan 1)] (do (>!! c :x) (first (alts!! (map (fn* [x] x) [c])))))", ":x"},
+		{"(let* [c (chan 1)] (do (alts!! (list [c :y])) (<!! c)))", ":y"},
+	})
+}
+
+// TestGoBlockCancelledWithContext checks that a go block stuck waiting on a
+// channel stops when the evaluation that started it is cancelled.
+func TestGoBlockCancelledWithContext(t *testing.T) {
+	interp := New(WithStdout(ioutil.Discard))
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := interp.EvalString(ctx, "(def! stuck (go (<!! (chan))))"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitCtx, stop := context.WithTimeout(context.Background(), time.Second)
+	defer stop()
+	if val, err := interp.EvalString(waitCtx, "(<!! stuck)"); err != nil || val != nil {
+		t.Fatalf("expected the go block to close its channel, got %v %v", val, err)
+	}
+}
+
+// TestRefConservation transfers between refs from many futures at once, the
+// total must stay the same.
+func TestRefConservation(t *testing.T) {
+	ctx := context.Background()
+	interp := New(WithStdout(ioutil.Discard))
+	if _, err := interp.EvalString(ctx, `
+		(def! accounts (apply vector (map (fn* [_] (ref 100)) (range 5))))
+		(def! transfer (fn* [from to amount]
+			(dosync
+				(if (>= @(nth accounts from) amount)
+					(do (alter (nth accounts from) - amount)
+						(alter (nth accounts to) + amount))))))
+		(def! transfers (fn* [n]
+			(loop* [i 0]
+				(if (< i n)
+					(do (transfer (mod i 5) (mod (+ i n) 5) (mod i 30)) (recur (+ i 1)))
+					n))))
+		(def! total (fn* [] (dosync (apply + (map deref accounts)))))`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := interp.Call(ctx, "transfers", int64(100+i)); err != nil {
+				t.Error(err)
+			}
+			if total, err := interp.Call(ctx, "total"); err != nil || total != int64(500) {
+				t.Errorf("expected a total of 500, got %v %v", total, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestAgents sends to an agent from many goroutines, every action must run
+// once and actions sent in a transaction only once it commits.
+func TestAgents(t *testing.T) {
+	ctx := context.Background()
+	interp := New(WithStdout(ioutil.Discard))
+	if _, err := interp.EvalString(ctx, `
+		(def! counter (agent 0))
+		(def! log (agent []))
+		(def! r (ref 0))
+		(def! bump (fn* [i]
+			(do (send counter inc)
+				(send-off log conj i)
+				(try* (dosync (alter r inc) (send counter + 1000) (throw :abort)) (catch* e e)))))`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := interp.Call(ctx, "bump", int64(i*50+j)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	val, err := interp.EvalString(ctx, "(do (await counter log) [@counter (count @log) @r])")
+	if err != nil {
+		t.Fatal(err)
+	} else if printed := printer.Print(val, true); printed != "[400 400 0]" {
+		t.Fatalf("expected [400 400 0], got %v", printed)
+	}
+}
+
+// TestDynamicBindings binds a var on many goroutines at once, each evaluation
+// and the futures it starts must only see its own binding.
+func TestDynamicBindings(t *testing.T) {
+	ctx := context.Background()
+	var stderr bytes.Buffer
+	interp := New(WithStdout(ioutil.Discard), WithStderr(&stderr))
+	if _, err := interp.EvalString(ctx, `
+		(def! ^:dynamic *request-id* nil)
+		(def! current (fn* [] *request-id*))
+		(def! handle (fn* [id]
+			(binding [*request-id* id]
+				(if (= id @(future (current)))
+					(do (set! *request-id* (+ id 1)) (current))))))`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id := int64(i*100 + j)
+				if val, err := interp.Call(ctx, "handle", id); err != nil || val != id+1 {
+					t.Errorf("expected %v, got %v %v", id+1, val, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := interp.EvalString(ctx, `(binding [*out* *err* *print-readably* false] (prn "to stderr"))`); err != nil {
+		t.Fatal(err)
+	} else if stderr.String() != "to stderr\n" {
+		t.Fatalf("expected prn to write to *err*, got %q", stderr.String())
+	}
+}
+
+// TestConcurrentRequire requires a namespace on many goroutines at once, its
+// file must be loaded only once and every require must wait for it to load.
+func TestConcurrentRequire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wotpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := `(ns lib.slow-counter) (swap! user/loads inc) (<!! (timeout 20)) (def! ready true)`
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib", "slow_counter.wot"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	interp := New(WithStdout(ioutil.Discard), WithLoadPath(dir))
+	if _, err := interp.EvalString(ctx, `(def! loads (atom 0))`); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if val, err := interp.EvalString(ctx, `(do (require 'lib.slow-counter) lib.slow-counter/ready)`); err != nil || val != true {
+				t.Errorf("expected the namespace to be loaded, got %v %v", val, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val, err := interp.EvalString(ctx, `@loads`); err != nil || val != int64(1) {
+		t.Fatalf("expected the file to be loaded once, got %v %v", val, err)
+	}
+}
+
+// TestFailedFutureStack derefs a failed future on many goroutines at once,
+// each error must have the frames of its own deref only.
+func TestFailedFutureStack(t *testing.T) {
+	ctx := context.Background()
+	interp := New(WithStdout(ioutil.Discard))
+	if _, err := interp.EvalString(ctx, `(def! failed (future (throw "boom")))`); err != nil {
+		t.Fatal(err)
+	}
+	_, err := interp.EvalString(ctx, `@failed`)
+	if err == nil {
+		t.Fatal("expected the deref to fail")
+	}
+	expected := printer.Print(err, true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := interp.EvalString(ctx, `@failed`); err == nil || printer.Print(err, true) != expected {
+					t.Errorf("expected the same trace every time, got %v", printer.Print(err, true))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,24 @@
+package wot
+
+import (
+	"github.com/tanema/mal/wotlisp/src/interop"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// ToValue converts a go value to a wot value. Go numbers become integers or
+// floats, slices become vectors, maps become hash maps and functions become
+// builtins that convert their arguments and results. Structs, pointers and
+// other go values are wrapped so wot code can use their fields with
+// (.-Field obj) and call their methods with (. obj Method args).
+func ToValue(value interface{}) (types.Base, error) {
+	return interop.ToValue(value)
+}
+
+// FromValue converts a wot value to a go value. Lists, vectors, sets and seqs
+// become []interface{}, maps become map[string]interface{} when all of their
+// keys are strings, keywords or symbols and map[interface{}]interface{}
+// otherwise. Keywords and symbols become their names. Numbers and anything
+// else are returned as they are.
+func FromValue(val types.Base) (interface{}, error) {
+	return interop.FromValue(val)
+}
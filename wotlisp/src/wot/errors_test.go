@@ -0,0 +1,190 @@
+package wot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tanema/mal/wotlisp/src/printer"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// TestCaughtStackTrace checks the value catch* binds keeps the call stack of
+// the error for stack-trace.
+func TestCaughtStackTrace(t *testing.T) {
+	ctx := context.Background()
+	interp := New()
+	if _, err := interp.EvalString(ctx, `
+		(def! fail (fn* [] (nth [] 1)))
+		(def! throws (fn* [] (throw (ex-info "bad" {}))))`); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{
+		`(try* (fail) (catch* e (stack-trace e)))`,
+		`(try* (throws) (catch* e (stack-trace e)))`,
+	} {
+		val, err := interp.EvalString(ctx, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stack, ok := val.(*types.Vector)
+		if !ok || stack.Count() == 0 {
+			t.Errorf("expected %v to have a stack, got %v", src, val)
+		}
+	}
+}
+
+// TestCatchClauses checks which catch* clauses have tests, a symbol in the
+// test position is the binding so plain mal catch* forms keep working.
+func TestCatchClauses(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected types.Base
+	}{
+		{`(do (def! x 1) (try* (throw 2) (catch* e x e)))`, int64(2)},
+		{`(try* (nth [] 1) (catch* :index-error e :index))`, types.Keyword("index")},
+		{`(try* (nth [] 1) (catch* :type-error e :type) (catch* :default e :default))`, types.Keyword("default")},
+		{`(try* (throw "s") (catch* (fn* [v] (string? v)) e :string))`, types.Keyword("string")},
+		{`(try* (throw "s") (catch* [:index-error string?] e :any))`, types.Keyword("any")},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			val, err := New().EvalString(context.Background(), c.src)
+			if err != nil || !types.Equal(val, c.expected) {
+				t.Fatalf("expected %v, got %v %v", c.expected, val, err)
+			}
+		})
+	}
+}
+
+// TestTryLazyResults checks try* only realizes the first cell of a lazy result
+// so it can return infinite seqs and still catches errors raised computing it.
+func TestTryLazyResults(t *testing.T) {
+	cases := []struct {
+		src      string
+		expected string
+	}{
+		{`(take 3 (try* (iterate inc 0) (catch* e e)))`, `(0 1 2)`},
+		{`(take 2 (try* (cycle [1 2 3]) (catch* e e)))`, `(1 2)`},
+		{`(try* (map (fn* [x] (throw :oops)) [1]) (catch* e :caught))`, `:caught`},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			val, err := New().EvalString(ctx, c.src)
+			if err != nil {
+				t.Fatal(err)
+			} else if printed := printer.Print(val, true); printed != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, printed)
+			}
+		})
+	}
+}
+
+// TestUnboundSymbolPosition checks symbols that are not found are reported at
+// their own position, not the position of the form around them.
+func TestUnboundSymbolPosition(t *testing.T) {
+	cases := []struct {
+		src    string
+		line   int
+		column int
+	}{
+		{"(+ 1 foo)", 1, 6},
+		{"(let* [a 1]\n  (do a\n      bar))", 3, 7},
+		{"(str [1 2\n   baz])", 2, 4},
+		{"(def! f (fn* [] (+ 1 zork)))\n(f)", 1, 22},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			_, err := New().EvalString(context.Background(), c.src)
+			var srcErr types.SourceError
+			if !errors.As(err, &srcErr) {
+				t.Fatalf("expected an error with a position, got %v", err)
+			} else if srcErr.Pos.Line != c.line || srcErr.Pos.Column != c.column {
+				t.Fatalf("expected %v:%v, got %v", c.line, c.column, srcErr.Pos)
+			}
+		})
+	}
+}
+
+// TestUserMetaIsNotAPosition checks metadata that looks like a position does
+// not change where errors are reported, the form is still reported where it
+// was read.
+func TestUserMetaIsNotAPosition(t *testing.T) {
+	_, err := New().EvalString(context.Background(), `(eval (with-meta '(+ 1 "a") {:line 9 :column 9}))`)
+	var srcErr types.SourceError
+	if !errors.As(err, &srcErr) {
+		t.Fatalf("expected an error with a position, got %v", err)
+	} else if srcErr.Pos.Line != 1 || srcErr.Pos.Column != 19 {
+		t.Fatalf("expected 1:19, got %v", srcErr.Pos)
+	}
+}
+
+// TestSpecialFormSyntaxErrors checks malformed special forms are syntax errors
+func TestSpecialFormSyntaxErrors(t *testing.T) {
+	for _, src := range []string{
+		"(def!)",
+		"(def! 1 2)",
+		"(let*)",
+		"(let* [a] a)",
+		"(let* a a)",
+		"(loop*)",
+		"(loop* a a)",
+		"(if)",
+		"(fn*)",
+		"(fn* a)",
+		"(try*)",
+		"(try* 1 (catch* 2))",
+		"(try* 1 (finally* 2) (finally* 3))",
+		"(try* 1 (catch* e 2) 3)",
+		"(recur 1)",
+		"(. 1)",
+		"(. 1 2)",
+		"(.-Name)",
+		"(binding)",
+		"(binding [x])",
+		"(set!)",
+		"(do)",
+		"(quasiquote)",
+		"(macroexpand)",
+	} {
+		t.Run(src, func(t *testing.T) {
+			if _, err := New().EvalString(context.Background(), src); !errors.Is(err, types.SyntaxError) {
+				t.Fatalf("expected a syntax error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestErrorKinds raises an error of each kind and checks it only matches its
+// own kind with errors.Is
+func TestErrorKinds(t *testing.T) {
+	kinds := []types.ErrorType{
+		types.ArityError, types.TypeError, types.UnboundSymbolError, types.IndexError, types.IOError,
+		types.ReaderError, types.SyntaxError, types.ArithmeticError, types.LimitError, types.StateError,
+	}
+	cases := map[types.ErrorType]string{
+		types.ArityError:         "((fn* [a] a))",
+		types.TypeError:          `(+ 1 "a")`,
+		types.UnboundSymbolError: "undefined",
+		types.IndexError:         "(nth [] 1)",
+		types.IOError:            `(slurp "/does/not/exist")`,
+		types.ReaderError:        "(1 2",
+		types.SyntaxError:        "(if)",
+		types.ArithmeticError:    "(/ 1 0)",
+		types.LimitError:         "(loop* [i 0] (recur (+ i 1)))",
+		types.StateError:         "(do (def! ^:dynamic *x* 1) (set! *x* 2))",
+	}
+	for _, kind := range kinds {
+		t.Run(string(kind), func(t *testing.T) {
+			_, err := New(WithLimits(Limits{MaxSteps: 1000})).EvalString(context.Background(), cases[kind])
+			for _, other := range kinds {
+				if errors.Is(err, other) != (other == kind) {
+					t.Errorf("expected errors.Is(%v, %v) to be %v", err, other, other == kind)
+				}
+			}
+		})
+	}
+}
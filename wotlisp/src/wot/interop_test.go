@@ -0,0 +1,41 @@
+package wot
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// TestCallbackErrors passes a wot function that throws to a go function that
+// cannot return the error, it must be raised in wot and not crash the host.
+func TestCallbackErrors(t *testing.T) {
+	ctx := context.Background()
+	interp := New()
+	if err := interp.Define("apply-int", func(f func(int) int) int { return f(1) }); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := interp.EvalString(ctx, `(try* (apply-int (fn* [x] (throw "boom"))) (catch* e e))`); err != nil || val != "boom" {
+		t.Fatalf("expected the error to be caught, got %v %v", val, err)
+	}
+	if _, err := interp.EvalString(ctx, `(apply-int (fn* [x] (throw "boom")))`); err == nil {
+		t.Fatal("expected the error to be returned")
+	}
+	if val, err := interp.EvalString(ctx, `(apply-int inc)`); err != nil || val != int64(2) {
+		t.Fatalf("expected 2, got %v %v", val, err)
+	}
+}
+
+// TestStreamsAreOpaque checks scripts cannot reach the host's files through
+// the methods and fields of *out*, *err* and *in*.
+func TestStreamsAreOpaque(t *testing.T) {
+	ctx := context.Background()
+	interp := New(WithStdout(ioutil.Discard))
+	for _, src := range []string{"(. *out* Close)", "(. *err* Fd)", "(. *in* Name)", "(.-Name *out*)"} {
+		if _, err := interp.EvalString(ctx, src); !errors.Is(err, types.TypeError) {
+			t.Errorf("expected %v to be a type error, got %v", src, err)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Package wot embeds the wot interpreter in go programs so it can be used as a
+// configuration or scripting language.
+package wot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/tanema/mal/wotlisp/src/core"
+	"github.com/tanema/mal/wotlisp/src/env"
+	"github.com/tanema/mal/wotlisp/src/printer"
+	"github.com/tanema/mal/wotlisp/src/reader"
+	"github.com/tanema/mal/wotlisp/src/runtime"
+	"github.com/tanema/mal/wotlisp/src/types"
+)
+
+// Interpreter evaluates wot code in its own namespaces
+type Interpreter struct {
+	env    *env.Namespace
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+	limits Limits
+	// readLine is shared by the REPL and readline so they read from the same
+	// buffered input
+	readLine func(prompt string) (string, error)
+}
+
+// Limits bound the steps, depth and allocations of evaluations, see WithLimits
+type Limits = runtime.Limits
+
+// The errors returned when an evaluation goes over its limits, they can be
+// matched with errors.Is.
+var (
+	ErrStepLimit  = runtime.ErrStepLimit
+	ErrDepthLimit = runtime.ErrDepthLimit
+	ErrAllocLimit = runtime.ErrAllocLimit
+)
+
+// Option configures an Interpreter
+type Option func(*Interpreter, *core.Options)
+
+// WithStdout sets where prn and println write unless *out* is rebound,
+// os.Stdout by default
+func WithStdout(w io.Writer) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		interp.stdout = w
+		opts.Out = w
+	}
+}
+
+// WithStderr sets where the REPL reports errors and the root of *err*,
+// os.Stderr by default
+func WithStderr(w io.Writer) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		interp.stderr = w
+		opts.Err = w
+	}
+}
+
+// WithStdin sets where readline and the REPL read lines from, os.Stdin by
+// default
+func WithStdin(r io.Reader) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		interp.stdin = r
+	}
+}
+
+// WithLineReader sets the function readline and the REPL read lines with in
+// place of reading from stdin, like one with line editing and history. It
+// returns io.EOF when the input runs out.
+func WithLineReader(readLine func(prompt string) (string, error)) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		interp.readLine = readLine
+	}
+}
+
+// WithBuiltins installs only the named builtins
+func WithBuiltins(names ...string) Option {
+	allowed := nameSet(names)
+	return func(interp *Interpreter, opts *core.Options) {
+		opts.Include = includeAnd(opts.Include, func(name types.Symbol) bool { return allowed[name] })
+	}
+}
+
+// WithoutBuiltins installs every builtin except the named ones
+func WithoutBuiltins(names ...string) Option {
+	denied := nameSet(names)
+	return func(interp *Interpreter, opts *core.Options) {
+		opts.Include = includeAnd(opts.Include, func(name types.Symbol) bool { return !denied[name] })
+	}
+}
+
+// Capability is a set of builtins that reach outside of the interpreter
+type Capability = core.Capability
+
+// The capabilities that can be given to WithCapabilities
+const (
+	Pure    = core.Pure
+	IORead  = core.IORead
+	IOWrite = core.IOWrite
+	Process = core.Process
+	Network = core.Network
+)
+
+// WithCapabilities installs only the builtins of the capabilities along with
+// the pure builtins which are always installed. By default every builtin is.
+func WithCapabilities(caps ...Capability) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		opts.Capabilities = append([]Capability{Pure}, caps...)
+	}
+}
+
+// WithRoot limits slurp, spit and load-file to files inside of the directory.
+// Relative paths are relative to it and paths that lead outside of it, with ..
+// or through a symlink, are errors.
+func WithRoot(dir string) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		opts.Root = dir
+	}
+}
+
+// WithLoadPath sets the directories require looks for namespaces in, the
+// directories in WOTPATH by default. The file of the namespace a.b-c is
+// a/b_c.wot in one of them.
+func WithLoadPath(dirs ...string) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		opts.LoadPath = dirs
+	}
+}
+
+// WithLimits limits every call to evaluate code or call a function. Each call
+// gets the full limits, they are not shared between calls.
+func WithLimits(limits Limits) Option {
+	return func(interp *Interpreter, opts *core.Options) {
+		interp.limits = limits
+	}
+}
+
+func nameSet(names []string) map[types.Symbol]bool {
+	set := map[types.Symbol]bool{}
+	for _, name := range names {
+		set[types.Symbol(name)] = true
+	}
+	return set
+}
+
+// includeAnd combines builtin filters so options can be given more than once
+func includeAnd(prev, next func(types.Symbol) bool) func(types.Symbol) bool {
+	if prev == nil {
+		return next
+	}
+	return func(name types.Symbol) bool { return prev(name) && next(name) }
+}
+
+// New creates an interpreter with fresh namespaces
+func New(opts ...Option) *Interpreter {
+	interp := &Interpreter{stdout: os.Stdout, stderr: os.Stderr}
+	nsOpts := core.Options{Out: os.Stdout, Err: os.Stderr}
+	for _, opt := range opts {
+		opt(interp, &nsOpts)
+	}
+	if interp.readLine == nil {
+		interp.readLine = core.LineReader(interp.stdin, interp.stdout)
+	}
+	nsOpts.ReadLine = interp.readLine
+	interp.env = core.NewNamespace(nsOpts)
+	return interp
+}
+
+// Env returns the user namespace of the interpreter, where evaluation starts
+func (interp *Interpreter) Env() *env.Namespace {
+	return interp.env
+}
+
+// EvalString evaluates every form in the source and returns the value of the
+// last one. The evaluation stops with the error of ctx when it is done.
+func (interp *Interpreter) EvalString(ctx context.Context, source string) (types.Base, error) {
+	return interp.evalSource(ctx, "", source)
+}
+
+// EvalReader evaluates every form read from r and returns the value of the
+// last one.
+func (interp *Interpreter) EvalReader(ctx context.Context, r io.Reader) (types.Base, error) {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, types.Errorf(types.IOError, "problem reading source: %v", err).Wrap(err)
+	}
+	return interp.evalSource(ctx, "", string(source))
+}
+
+// LoadFile evaluates every form in a file and returns the value of the last
+// one. Errors point to positions in the file.
+func (interp *Interpreter) LoadFile(ctx context.Context, path string) (types.Base, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, types.Errorf(types.IOError, "problem reading source file: %v", err).
+			With(types.Keyword("path"), path).Wrap(err)
+	}
+	return interp.evalSource(core.BindNamespace(ctx, interp.env), path, string(source))
+}
+
+func (interp *Interpreter) evalSource(ctx context.Context, file, source string) (types.Base, error) {
+	forms, err := reader.ReadFile(file, source)
+	if err != nil {
+		return nil, err
+	}
+	return interp.evalForms(ctx, forms)
+}
+
+// evalForms evaluates the forms in order in the current namespace, keeping the
+// last error in *e
+func (interp *Interpreter) evalForms(ctx context.Context, forms []types.Base) (result types.Base, err error) {
+	ctx = interp.limited(ctx)
+	for _, form := range forms {
+		if result, err = runtime.Eval(ctx, interp.current(ctx), form); err != nil {
+			interp.env.Set("*e", err)
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// current is the namespace *ns* is set to, the user namespace if it is not
+// installed
+func (interp *Interpreter) current(ctx context.Context) *env.Namespace {
+	if ns := core.CurrentNamespace(ctx, interp.env); ns != nil {
+		return ns
+	}
+	return interp.env
+}
+
+// Define binds the name to the value in the user namespace, converting it from a go
+// value with ToValue.
+func (interp *Interpreter) Define(name string, value interface{}) error {
+	val, err := ToValue(value)
+	if err != nil {
+		return err
+	}
+	interp.env.Set(types.Symbol(name), val)
+	return nil
+}
+
+// Call calls the function bound to the name in the current namespace with the arguments converted from
+// go values with ToValue.
+func (interp *Interpreter) Call(ctx context.Context, fnName string, args ...interface{}) (types.Base, error) {
+	fn, err := interp.current(ctx).Get(types.Symbol(fnName))
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]types.Base, len(args))
+	for i, arg := range args {
+		if vals[i], err = ToValue(arg); err != nil {
+			return nil, err
+		}
+	}
+	return types.CallFunc(types.WithContext(interp.env, interp.limited(ctx)), fn, vals)
+}
+
+// limited gives the call its own limits if the interpreter has any
+func (interp *Interpreter) limited(ctx context.Context) context.Context {
+	if interp.limits == (Limits{}) {
+		return ctx
+	}
+	return runtime.WithLimits(ctx, interp.limits)
+}
+
+// REPL reads lines, evaluates them and prints their values until the input
+// runs out or ctx is done. Errors are printed to stderr.
+func (interp *Interpreter) REPL(ctx context.Context, prompt string) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := interp.readLine(prompt)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		forms, err := reader.ReadFile("", line)
+		if err == nil && len(forms) == 0 {
+			continue
+		}
+		var val types.Base
+		if err == nil {
+			val, err = interp.evalForms(ctx, forms)
+		}
+		if err != nil {
+			fmt.Fprintln(interp.stderr, printer.Print(err, true))
+			continue
+		}
+		fmt.Fprintln(interp.stdout, printer.Print(val, true))
+	}
+}